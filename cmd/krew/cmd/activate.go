@@ -0,0 +1,59 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package cmd
+
+import (
+	"fmt"
+	"os"
+
+	"github.com/GoogleContainerTools/krew/pkg/index/indexscanner"
+	"github.com/GoogleContainerTools/krew/pkg/installation"
+	krewversion "github.com/GoogleContainerTools/krew/pkg/version"
+	"github.com/pkg/errors"
+
+	"github.com/spf13/cobra"
+)
+
+// activateCmd represents the activate command
+var activateCmd = &cobra.Command{
+	Use:   "activate PLUGIN VERSION",
+	Short: "Activate a staged version of a plugin",
+	Long: `Activate a staged version of a plugin.
+This links a version staged with "kubectl plugin install --stage-only" without
+downloading it.`,
+	RunE: func(cmd *cobra.Command, args []string) error {
+		name, version := args[0], args[1]
+		plugin, err := indexscanner.LoadPluginFileFromFS(paths.IndexPath(), name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to load plugin %q from the index", name)
+		}
+		opts := installation.Options{
+			// The plugin is loaded from the index, which may activate krew.
+			AllowReservedName: true,
+			KrewVersion:       krewversion.GitTag(),
+		}
+		if err := installation.ActivateWithOptions(paths, plugin, version, opts); err != nil {
+			return errors.Wrapf(err, "failed to activate plugin %s", name)
+		}
+		fmt.Fprintf(os.Stderr, "Activated plugin %s (version %s)\n", name, version)
+		return nil
+	},
+	PreRunE: checkIndex,
+	Args:    cobra.ExactArgs(2),
+}
+
+func init() {
+	rootCmd.AddCommand(activateCmd)
+}
@@ -25,6 +25,7 @@ import (
 
 	"github.com/pkg/errors"
 	"github.com/spf13/cobra"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 // infoCmd represents the info command
@@ -51,7 +52,9 @@ Use this command to find out about plugin requirements and caveats.`,
 
 func printPluginInfo(out io.Writer, plugin index.Plugin) {
 	fmt.Fprintf(out, "NAME: %s\n", plugin.Name)
-	if platform, ok, err := installation.GetMatchingPlatform(plugin); err == nil && ok {
+	if i, ok, err := installation.GetMatchingPlatformIndex(plugin); err == nil && ok {
+		platform := plugin.Spec.Platforms[i]
+		fmt.Fprintf(out, "PLATFORM: #%d (%s)\n", i, metav1.FormatLabelSelector(platform.Selector))
 		if platform.Head != "" {
 			fmt.Fprintf(out, "HEAD: %s\n", platform.Head)
 		}
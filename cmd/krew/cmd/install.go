@@ -22,6 +22,7 @@ import (
 
 	"github.com/GoogleContainerTools/krew/pkg/index/indexscanner"
 	"github.com/GoogleContainerTools/krew/pkg/installation"
+	"github.com/GoogleContainerTools/krew/pkg/version"
 
 	"github.com/GoogleContainerTools/krew/pkg/index"
 	"github.com/golang/glog"
@@ -32,7 +33,12 @@ import (
 
 func init() {
 	var forceHEAD *bool
+	var force *bool
 	var manifest *string
+	var installRequired *bool
+	var keepTemp *bool
+	var stageOnly *bool
+	var fallbackToHEAD *bool
 
 	// installCmd represents the install command
 	installCmd := &cobra.Command{
@@ -64,12 +70,16 @@ All plugins will be downloaded and made available to: "kubectl plugin <name>"`,
 			}
 
 			var install []index.Plugin
+			// Only plugins of the index can take the names reserved for
+			// krew, e.g. to install krew itself.
+			fromIndex := make(map[string]bool)
 			for _, name := range pluginNames {
 				plugin, err := indexscanner.LoadPluginFileFromFS(paths.IndexPath(), name)
 				if err != nil {
 					return errors.Wrapf(err, "failed to load plugin %q from the index", name)
 				}
 				install = append(install, plugin)
+				fromIndex[plugin.Name] = true
 			}
 
 			if *manifest != "" {
@@ -104,13 +114,36 @@ All plugins will be downloaded and made available to: "kubectl plugin <name>"`,
 			// Do install
 			for _, plugin := range install {
 				glog.V(2).Infof("Installing plugin: %s\n", plugin.Name)
-				err := installation.Install(paths, plugin, *forceHEAD)
-				if err == installation.ErrIsAlreadyInstalled {
+				opts := installation.Options{
+					ForceHEAD:         *forceHEAD,
+					Force:             *force,
+					AllowReservedName: fromIndex[plugin.Name],
+					InstallRequired:   *installRequired,
+					KeepTempDirs:      *keepTemp,
+					FallbackToHEAD:    *fallbackToHEAD,
+					KrewVersion:       version.GitTag(),
+					CABundle:          os.Getenv("KREW_CA_BUNDLE"),
+					Resolver: func(name string) (index.Plugin, error) {
+						return indexscanner.LoadPluginFileFromFS(paths.IndexPath(), name)
+					},
+				}
+				if *stageOnly {
+					stagedVersion, err := installation.StageWithOptions(paths, plugin, opts)
+					if err != nil {
+						glog.Warningf("failed to stage plugin %q: %v", plugin.Name, err)
+						failed = append(failed, plugin.Name)
+						continue
+					}
+					fmt.Fprintf(os.Stderr, "Staged plugin: %s (version %s), activate it with \"kubectl plugin activate %s %s\"\n", plugin.Name, stagedVersion, plugin.Name, stagedVersion)
+					continue
+				}
+				err := installation.InstallWithOptions(paths, plugin, opts)
+				if errors.Cause(err) == installation.ErrIsAlreadyInstalled {
 					glog.Warningf("Skipping plugin %s, it is already installed", plugin.Name)
 					continue
 				}
 				if err != nil {
-					glog.Warningf("failed to install plugin %q", plugin.Name)
+					glog.Warningf("failed to install plugin %q: %v", plugin.Name, err)
 					failed = append(failed, plugin.Name)
 					continue
 				}
@@ -128,7 +161,12 @@ All plugins will be downloaded and made available to: "kubectl plugin <name>"`,
 	}
 
 	forceHEAD = installCmd.Flags().Bool("HEAD", false, "Force HEAD if versioned and HEAD installs are possible.")
+	force = installCmd.Flags().Bool("force", false, "Reinstall plugins that are already installed, keeping the installed version if it fails.")
 	manifest = installCmd.Flags().String("source", "", "(Development-only) specify plugin manifest directly.")
+	keepTemp = installCmd.Flags().Bool("keep-temp", false, "(Development-only) keep the extracted archive and staging directories for inspection.")
+	stageOnly = installCmd.Flags().Bool("stage-only", false, "Download the plugins into their versioned directories without linking them, to activate them later.")
+	fallbackToHEAD = installCmd.Flags().Bool("fallback-to-head", false, "Install the unverified HEAD version of plugins whose versioned download is not found.")
+	installRequired = installCmd.Flags().Bool("install-required", false, "Install the missing plugins required by the plugins from the index.")
 
 	rootCmd.AddCommand(installCmd)
 }
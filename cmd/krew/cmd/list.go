@@ -36,15 +36,22 @@ func init() {
 		Long: `List all installed plugin names.
 Plugins will be shown as "PLUGIN,VERSION"`,
 		RunE: func(cmd *cobra.Command, args []string) error {
-			plugins, err := installation.ListInstalledPlugins(paths.InstallPath(), paths.BinPath())
+			plugins, err := installation.ListInstalledPlugins(paths.InstallPath(), paths.BinPath(), paths.BinPrefix())
 			if err != nil {
 				return errors.Wrap(err, "failed to find all installed versions")
 			}
+			versions := make(map[string]string, len(plugins))
+			for name, plugin := range plugins {
+				versions[name] = plugin.Version
+				if plugin.IsHEAD {
+					versions[name] = "(HEAD)"
+				}
+			}
 			if !(isatty.IsTerminal(os.Stdout.Fd()) || isatty.IsCygwinTerminal(os.Stdout.Fd())) {
-				fmt.Fprintf(os.Stdout, "%s\n", strings.Join(sortedKeys(plugins), "\n"))
+				fmt.Fprintf(os.Stdout, "%s\n", strings.Join(sortedKeys(versions), "\n"))
 				return nil
 			}
-			printAlignedColumns(os.Stdout, "PLUGIN", "VERSION", plugins)
+			printAlignedColumns(os.Stdout, "PLUGIN", "VERSION", versions)
 			return nil
 		},
 		PreRunE: checkIndex,
@@ -47,7 +47,7 @@ Search accepts a list of words as options.`,
 			pluginMap[p.Name] = p
 		}
 
-		installed, err := installation.ListInstalledPlugins(paths.InstallPath(), paths.BinPath())
+		installed, err := installation.ListInstalledPlugins(paths.InstallPath(), paths.BinPath(), paths.BinPrefix())
 		if err != nil {
 			return errors.Wrap(err, "failed to load installed plugins")
 		}
@@ -20,6 +20,7 @@ import (
 
 	"github.com/GoogleContainerTools/krew/pkg/index/indexscanner"
 	"github.com/GoogleContainerTools/krew/pkg/installation"
+	"github.com/GoogleContainerTools/krew/pkg/version"
 
 	"github.com/golang/glog"
 	"github.com/pkg/errors"
@@ -41,7 +42,7 @@ kubectl plugin upgrade foo bar"`,
 		var pluginNames []string
 		// Upgrade all plugins.
 		if len(args) == 0 {
-			installed, err := installation.ListInstalledPlugins(paths.InstallPath(), paths.BinPath())
+			installed, err := installation.ListInstalledPlugins(paths.InstallPath(), paths.BinPath(), paths.BinPrefix())
 			if err != nil {
 				return errors.Wrap(err, "failed to find all installed versions")
 			}
@@ -60,8 +61,13 @@ kubectl plugin upgrade foo bar"`,
 			}
 
 			glog.V(2).Infof("Upgrading plugin: %s\n", plugin.Name)
-			err = installation.Upgrade(paths, plugin, krewExecutedVersion)
-			if ignoreUpgraded && err == installation.ErrIsAlreadyUpgraded {
+			err = installation.UpgradeWithOptions(paths, plugin, krewExecutedVersion, installation.Options{
+				// The plugin is loaded from the index, which may upgrade krew.
+				AllowReservedName: true,
+				KrewVersion:       version.GitTag(),
+				CABundle:          os.Getenv("KREW_CA_BUNDLE"),
+			})
+			if ignoreUpgraded && errors.Cause(err) == installation.ErrIsAlreadyUpgraded {
 				fmt.Fprintf(os.Stderr, "Skipping plugin %s, it is already on the newest version\n", plugin.Name)
 				continue
 			}
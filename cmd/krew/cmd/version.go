@@ -33,7 +33,7 @@ BasePath is the root path for all krew related binaries.
 IndexPath is the path to the index repo see git(1).
 IndexURI is the URI where the index is updated from.
 InstallPath is the base path for all plugin installations.
-DownloadPath is the path used to store download binaries.`,
+DownloadPath is the path plugins are downloaded and extracted to, see KREW_DOWNLOAD_DIR.`,
 	Run: func(cmd *cobra.Command, args []string) {
 		conf := map[string]string{
 			"IsPlugin":        fmt.Sprintf("%v", krewExecutedVersion != ""),
@@ -0,0 +1,62 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"bufio"
+	"io"
+	"strings"
+
+	"github.com/GoogleContainerTools/krew/pkg/logging"
+	"github.com/pkg/errors"
+)
+
+// GetChecksumFromFile downloads a checksums file with "<hex>  <filename>"
+// lines, as written by sha256sum for all assets of a release, and returns the
+// checksum of the filename.
+func GetChecksumFromFile(uri, filename string, fetcher Fetcher) (string, error) {
+	logging.V(2).Infof("Fetching checksums file %q", uri)
+	body, err := fetcher.Get(uri)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not download checksums file %q", uri)
+	}
+	defer body.Close()
+	checksum, err := findChecksum(body, filename)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to read checksums file %q", uri)
+	}
+	return checksum, nil
+}
+
+// findChecksum returns the checksum of the filename from the lines of a
+// checksums file.
+func findChecksum(r io.Reader, filename string) (string, error) {
+	scanner := bufio.NewScanner(r)
+	for scanner.Scan() {
+		fields := strings.Fields(scanner.Text())
+		if len(fields) != 2 {
+			continue
+		}
+		// sha256sum marks files read in binary mode with "*".
+		name := strings.TrimPrefix(strings.TrimPrefix(fields[1], "*"), "./")
+		if name == filename {
+			return fields[0], nil
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return "", err
+	}
+	return "", errors.Errorf("no checksum found for %q", filename)
+}
@@ -0,0 +1,52 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"io/ioutil"
+	"strings"
+	"testing"
+)
+
+func TestGetChecksumFromFile(t *testing.T) {
+	const checksums = `b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9  foo-linux-amd64.tar.gz
+a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447 *foo-darwin-amd64.tar.gz
+
+# comments and malformed lines are ignored
+f2ca1bb6c7e907d06dafe4687e579fce76b37e4e93b7605022da52e6ccc26fd2  ./foo-windows-amd64.zip
+`
+	tests := []struct {
+		filename string
+		want     string
+		wantErr  bool
+	}{
+		{"foo-linux-amd64.tar.gz", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", false},
+		{"foo-darwin-amd64.tar.gz", "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447", false},
+		{"foo-windows-amd64.zip", "f2ca1bb6c7e907d06dafe4687e579fce76b37e4e93b7605022da52e6ccc26fd2", false},
+		{"foo-linux-arm.tar.gz", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			fetcher := FakeFetcher{ioutil.NopCloser(strings.NewReader(checksums))}
+			got, err := GetChecksumFromFile("https://example.com/checksums.txt", tt.filename, fetcher)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetChecksumFromFile(%s) error = %v, wantErr %v", tt.filename, err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("GetChecksumFromFile(%s) = %q, want %q", tt.filename, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,83 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleContainerTools/krew/pkg/logging"
+	"github.com/pkg/errors"
+)
+
+// extractedSizeFactor estimates the size of an extracted archive from the
+// size of the archive.
+const extractedSizeFactor = 3
+
+// CheckFreeSpace fails if the filesystem of path has less than need bytes
+// available. The path does not have to exist yet. If the available space can't
+// be determined, the check is skipped.
+func CheckFreeSpace(path string, need uint64) error {
+	dir, err := existingDir(path)
+	if err != nil {
+		logging.V(2).Infof("Skipping disk space check of %q: %v", path, err)
+		return nil
+	}
+	have, err := freeSpace(dir)
+	if err != nil {
+		logging.V(2).Infof("Skipping disk space check of %q: %v", dir, err)
+		return nil
+	}
+	logging.V(4).Infof("Filesystem of %q has %d bytes available, need %d", dir, have, need)
+	if have < need {
+		return errors.Errorf("insufficient disk space in %q: need ~%s, have %s", dir, formatBytes(need), formatBytes(have))
+	}
+	return nil
+}
+
+// existingDir returns path or its closest parent that exists.
+func existingDir(path string) (string, error) {
+	path, err := filepath.Abs(path)
+	if err != nil {
+		return "", err
+	}
+	for {
+		if _, err := os.Stat(path); err == nil {
+			return path, nil
+		} else if !os.IsNotExist(err) {
+			return "", err
+		}
+		parent := filepath.Dir(path)
+		if parent == path {
+			return "", errors.Errorf("no parent of %q exists", path)
+		}
+		path = parent
+	}
+}
+
+// formatBytes formats a number of bytes with a binary unit, e.g. "14.2MiB".
+func formatBytes(n uint64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%dB", n)
+	}
+	div, exp := uint64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f%ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
@@ -0,0 +1,30 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+//go:build !linux && !darwin && !freebsd && !dragonfly && !windows
+// +build !linux,!darwin,!freebsd,!dragonfly,!windows
+
+package download
+
+import (
+	"runtime"
+
+	"github.com/pkg/errors"
+)
+
+// freeSpace can't determine the available bytes on this OS, so the disk space
+// check is skipped.
+func freeSpace(dir string) (uint64, error) {
+	return 0, errors.Errorf("free disk space is unknown on %s", runtime.GOOS)
+}
@@ -0,0 +1,61 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package download
+
+import (
+	"io/ioutil"
+	"math"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestCheckFreeSpace(t *testing.T) {
+	dir, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	if _, err := freeSpace(dir); err != nil {
+		t.Skipf("available disk space can't be determined: %v", err)
+	}
+
+	notExisting := filepath.Join(dir, "not", "existing")
+	if err := CheckFreeSpace(notExisting, 1); err != nil {
+		t.Errorf("CheckFreeSpace(%q) error = %v", notExisting, err)
+	}
+	if err := CheckFreeSpace(dir, math.MaxUint64); err == nil || !strings.Contains(err.Error(), "insufficient disk space") {
+		t.Errorf("CheckFreeSpace() of more than available error = %v, want insufficient disk space", err)
+	}
+}
+
+func Test_formatBytes(t *testing.T) {
+	tests := []struct {
+		in   uint64
+		want string
+	}{
+		{0, "0B"},
+		{1023, "1023B"},
+		{1024, "1.0KiB"},
+		{14*1024*1024 + 200*1024, "14.2MiB"},
+		{3 << 30, "3.0GiB"},
+	}
+	for _, tt := range tests {
+		if got := formatBytes(tt.in); got != tt.want {
+			t.Errorf("formatBytes(%d) = %q, want %q", tt.in, got, tt.want)
+		}
+	}
+}
@@ -19,62 +19,280 @@ import (
 	"archive/zip"
 	"bytes"
 	"compress/gzip"
+	"fmt"
 	"io"
 	"io/ioutil"
+	"net/http"
+	"net/url"
 	"os"
 	"path"
 	"path/filepath"
 	"strings"
+	"time"
 
-	"github.com/golang/glog"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
 	"github.com/pkg/errors"
 )
 
+var (
+	zipMagic      = []byte("PK\x03\x04")
+	emptyZipMagic = []byte("PK\x05\x06")
+	gzipMagic     = []byte{0x1f, 0x8b}
+)
+
+// Options configures how a download is extracted. The zero value extracts all
+// entries of a download read into memory.
+type Options struct {
+	// Filter selects the archive entries that are extracted.
+	Filter Filter
+	// StrictArchiveEntries makes extraction fail on archive entries that are
+	// neither regular files nor directories (e.g. symlinks, devices or
+	// FIFOs). Otherwise they are skipped with a warning.
+	StrictArchiveEntries bool
+	// StrictCaseCollisions makes extraction fail on archives with files whose
+	// paths only differ in case, e.g. README and readme, which overwrite each
+	// other on case-insensitive file systems like the default ones of macOS
+	// and Windows. Otherwise they are extracted with a warning.
+	StrictCaseCollisions bool
+	// StreamArchives makes tar.gz archives and bare executables extract while
+	// they are downloaded and verified, instead of being read into memory
+	// first. The extracted files are discarded if the verification fails.
+	// The free disk space is not checked up front since the size of a
+	// streamed download is unknown. Zip archives are always read into memory
+	// as they can't be read sequentially.
+	StreamArchives bool
+	// PreserveModTimes makes extracted files keep the modification time of
+	// their archive entry instead of the time they are extracted at. Entries
+	// without a time, or with a time before the epoch or in the future, get
+	// the current time, so the installed files never look modified in the
+	// future.
+	PreserveModTimes bool
+}
+
+// sniffLen is the number of bytes read to detect the type of a download.
+const sniffLen = 512
+
+// Formats of a download, see DetectFormat.
+const (
+	FormatZIP   = "zip"
+	FormatTarGZ = "tar.gz"
+	// FormatRaw is a download that is not an archive, which is saved as an
+	// executable.
+	FormatRaw = "raw"
+)
+
 // download gets a file from the internet in memory and writes it content
 // to a verifier.
-func download(url string, verifier verifier, fetcher Fetcher) (io.ReaderAt, int64, error) {
-	glog.V(2).Infof("Fetching %q", url)
+func download(url string, verifier Verifier, fetcher Fetcher) (io.ReaderAt, int64, error) {
+	logging.V(2).Infof("Fetching %q", url)
 	body, err := fetcher.Get(url)
 	if err != nil {
 		return nil, 0, errors.Wrapf(err, "could not download %q", url)
 	}
 	defer body.Close()
 
-	glog.V(3).Infof("Reading download data into memory")
-	data, err := ioutil.ReadAll(io.TeeReader(body, verifier))
+	head, err := readHead(url, body)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	logging.V(3).Infof("Reading download data into memory")
+	data, err := ioutil.ReadAll(io.TeeReader(io.MultiReader(bytes.NewReader(head), body), verifier))
 	if err != nil {
 		return nil, 0, errors.Wrap(err, "could not read download content")
 	}
-	glog.V(2).Infof("Read %d bytes of download data into memory", len(data))
+	logging.V(2).Infof("Read %d bytes of download data into memory", len(data))
 
 	return bytes.NewReader(data), int64(len(data)), verifier.Verify()
 }
 
+// readHead reads the first bytes of the download from url and checks that
+// they are not empty and look like the expected archive.
+func readHead(url string, body io.Reader) ([]byte, error) {
+	head := make([]byte, sniffLen)
+	n, err := io.ReadFull(body, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return nil, errors.Wrap(err, "could not read download content")
+	}
+	if n == 0 {
+		return nil, errors.Errorf("downloaded file from %q is empty", url)
+	}
+	head = head[:n]
+	if err := checkArchiveHeader(urlFilename(url), head); err != nil {
+		return nil, errors.Wrapf(err, "unexpected content downloaded from %q", url)
+	}
+	return head, nil
+}
+
+// Filter reports whether the archive entry with the given slash-separated
+// name is extracted. A nil Filter extracts all entries.
+type Filter func(name string) bool
+
+func (f Filter) includes(name string) bool {
+	if f == nil {
+		return true
+	}
+	return f(strings.TrimPrefix(path.Clean(name), "/"))
+}
+
+// checkArchiveHeader inspects the first bytes of a download to fail early if
+// the server returned an error page or content that does not match the
+// archive type of the filename.
+func checkArchiveHeader(filename string, head []byte) error {
+	contentType := http.DetectContentType(head)
+	if i := strings.Index(contentType, ";"); i >= 0 {
+		contentType = contentType[:i]
+	}
+	if contentType == "text/html" || contentType == "text/xml" {
+		return errors.Errorf("server did not return an archive (got %s?)", contentType)
+	}
+	if strings.HasSuffix(filename, ".zip") && !bytes.HasPrefix(head, zipMagic) && !bytes.HasPrefix(head, emptyZipMagic) {
+		return errors.Errorf("server did not return a zip archive (got %s?)", contentType)
+	}
+	if strings.HasSuffix(filename, ".tar.gz") && !bytes.HasPrefix(head, gzipMagic) {
+		return errors.Errorf("server did not return a gzip archive (got %s?)", contentType)
+	}
+	return nil
+}
+
+// normalizeEntryName converts the backslash separators used by some archives
+// created on Windows to slashes.
+func normalizeEntryName(name string) string {
+	return strings.Replace(name, "\\", "/", -1)
+}
+
+// checkEntryName rejects slash-separated archive entry names that are absolute
+// or contain ".." components, so that extraction can't escape the target
+// directory.
+func checkEntryName(name string) error {
+	if path.IsAbs(name) || (len(name) >= 2 && name[1] == ':') {
+		return errors.Errorf("archive contains unsafe path %q", name)
+	}
+	for _, part := range strings.Split(name, "/") {
+		if part == ".." {
+			return errors.Errorf("archive contains unsafe path %q", name)
+		}
+	}
+	return nil
+}
+
+// skipEntry returns an error for an archive entry of an unsupported type if
+// o.StrictArchiveEntries is set, otherwise it logs that the entry is skipped.
+func (o Options) skipEntry(name, kind string) error {
+	if o.StrictArchiveEntries {
+		return errors.Errorf("unable to handle %s of %q in archive", kind, name)
+	}
+	logging.Warningf("Skipping %q in archive, it is not a regular file or directory (%s)", name, kind)
+	return nil
+}
+
+// extractedPaths records the files written by an extraction, so that it only
+// overwrites files it created itself, e.g. for duplicate archive entries, but
+// not stale files of a previous extraction or planted symlinks.
+type extractedPaths map[string]bool
+
+// checkWrite checks that the file at path in the target directory can be
+// written: no element of the path may be a symlink and an existing file must
+// have been written by this extraction.
+func (e extractedPaths) checkWrite(targetDir, path string) error {
+	rel, err := filepath.Rel(targetDir, path)
+	if err != nil {
+		return errors.Wrapf(err, "failed to get the path of %q relative to %q", path, targetDir)
+	}
+	cur := targetDir
+	parts := strings.Split(rel, string(filepath.Separator))
+	for i, part := range parts {
+		cur = filepath.Join(cur, part)
+		fi, err := os.Lstat(cur)
+		if os.IsNotExist(err) {
+			return nil
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to read %q", cur)
+		}
+		if fi.Mode()&os.ModeSymlink != 0 {
+			return errors.Errorf("refusing to extract %q through the existing symlink %q", path, cur)
+		}
+		if i == len(parts)-1 && !fi.IsDir() && !e[path] {
+			return errors.Errorf("refusing to overwrite %q, which was not extracted from this archive", path)
+		}
+	}
+	return nil
+}
+
+// caseFolds maps the lowercased paths of the extracted files to their path, to
+// detect files that collide on case-insensitive file systems.
+type caseFolds map[string]string
+
+// check warns about a file whose slash-separated name only differs in case from
+// an earlier one, or rejects it if strict is set.
+func (c caseFolds) check(name string, strict bool) error {
+	folded := strings.ToLower(name)
+	prev, ok := c[folded]
+	if !ok {
+		c[folded] = name
+		return nil
+	}
+	if prev == name {
+		return nil
+	}
+	if strict {
+		return errors.Errorf("archive entries %q and %q collide on case-insensitive file systems", prev, name)
+	}
+	logging.Warningf("Archive entries %q and %q collide on case-insensitive file systems, one overwrites the other there", prev, name)
+	return nil
+}
+
 // extractZIP extracts a zip file into the target directory.
-func extractZIP(targetDir string, read io.ReaderAt, size int64) error {
-	glog.V(4).Infof("Extracting download zip to %q", targetDir)
+func extractZIP(targetDir string, read io.ReaderAt, size int64, opts Options) error {
+	logging.V(4).Infof("Extracting download zip to %q", targetDir)
 	zipReader, err := zip.NewReader(read, size)
 	if err != nil {
 		return err
 	}
 
+	written := make(extractedPaths)
+	folds := make(caseFolds)
 	for _, f := range zipReader.File {
-		path := filepath.Join(targetDir, filepath.FromSlash(f.Name))
-		if f.FileInfo().IsDir() {
+		name := normalizeEntryName(f.Name)
+		if err := checkEntryName(name); err != nil {
+			return err
+		}
+		if !opts.Filter.includes(name) {
+			logging.V(4).Infof("zip: skipping %q not matched by the filter", f.Name)
+			continue
+		}
+		path := filepath.Join(targetDir, filepath.FromSlash(name))
+		if err := written.checkWrite(targetDir, path); err != nil {
+			return err
+		}
+		if f.FileInfo().IsDir() || strings.HasSuffix(name, "/") {
 			os.MkdirAll(path, f.Mode())
 			continue
 		}
+		if !f.Mode().IsRegular() {
+			if err := opts.skipEntry(f.Name, f.Mode().String()); err != nil {
+				return err
+			}
+			continue
+		}
+		if err := folds.check(name, opts.StrictCaseCollisions); err != nil {
+			return err
+		}
 
 		src, err := f.Open()
 		if err != nil {
 			return errors.Wrap(err, "could not open inflating zip file")
 		}
 
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			return errors.Wrap(err, "failed to create directory for zip")
+		}
 		dst, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, f.Mode())
 		if err != nil {
 			return errors.Wrap(err, "can't create file in zip destination dir")
 		}
 
+		written[path] = true
 		if _, err := io.Copy(dst, src); err != nil {
 			return errors.Wrap(err, "can't copy content to zip destination file")
 		}
@@ -83,14 +301,17 @@ func extractZIP(targetDir string, read io.ReaderAt, size int64) error {
 		// Don't be blocking
 		src.Close()
 		dst.Close()
+		if err := opts.setModTime(path, f.Modified); err != nil {
+			return err
+		}
 	}
 
 	return nil
 }
 
 // extractTARGZ extracts a gzipped tar file into the target directory.
-func extractTARGZ(targetDir string, in io.Reader) error {
-	glog.V(4).Infof("tar: extracting to %q", targetDir)
+func extractTARGZ(targetDir string, in io.Reader, opts Options) error {
+	logging.V(4).Infof("tar: extracting to %q", targetDir)
 
 	gzr, err := gzip.NewReader(in)
 	if err != nil {
@@ -99,6 +320,8 @@ func extractTARGZ(targetDir string, in io.Reader) error {
 	defer gzr.Close()
 
 	tr := tar.NewReader(gzr)
+	written := make(extractedPaths)
+	folds := make(caseFolds)
 	for {
 		hdr, err := tr.Next()
 		if err == io.EOF {
@@ -107,57 +330,249 @@ func extractTARGZ(targetDir string, in io.Reader) error {
 		if err != nil {
 			return errors.Wrap(err, "tar extraction error")
 		}
-		glog.V(4).Infof("tar: processing %q (type=%d, mode=%s)", hdr.Name, hdr.Typeflag, os.FileMode(hdr.Mode))
+		logging.V(4).Infof("tar: processing %q (type=%d, mode=%s)", hdr.Name, hdr.Typeflag, os.FileMode(hdr.Mode))
 		// see https://golang.org/cl/78355 for handling pax_global_header
 		if hdr.Name == "pax_global_header" {
-			glog.V(4).Infof("tar: skipping pax_global_header file")
+			logging.V(4).Infof("tar: skipping pax_global_header file")
+			continue
+		}
+		name := normalizeEntryName(hdr.Name)
+		if err := checkEntryName(name); err != nil {
+			return err
+		}
+		if !opts.Filter.includes(name) {
+			logging.V(4).Infof("tar: skipping %q not matched by the filter", hdr.Name)
 			continue
 		}
 
-		path := filepath.Join(targetDir, filepath.FromSlash(hdr.Name))
+		path := filepath.Join(targetDir, filepath.FromSlash(name))
+		if hdr.Typeflag == tar.TypeDir || hdr.Typeflag == tar.TypeReg {
+			if err := written.checkWrite(targetDir, path); err != nil {
+				return err
+			}
+		}
 		switch hdr.Typeflag {
 		case tar.TypeDir:
 			if err := os.MkdirAll(path, os.FileMode(hdr.Mode)); err != nil {
 				return errors.Wrap(err, "failed to create directory from tar")
 			}
 		case tar.TypeReg:
-			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY, os.FileMode(hdr.Mode))
+			if err := folds.check(name, opts.StrictCaseCollisions); err != nil {
+				return err
+			}
+			dir := filepath.Dir(path)
+			logging.V(4).Infof("tar: ensuring parent dirs exist for regular file, dir=%s", dir)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				return errors.Wrap(err, "failed to create directory for tar")
+			}
+			f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, os.FileMode(hdr.Mode))
 			if err != nil {
 				return errors.Wrapf(err, "failed to create file %q", path)
 			}
-			if _, err := io.Copy(f, tr); err != nil {
+			written[path] = true
+			n, err := io.Copy(f, tr)
+			if n != hdr.Size {
+				f.Close()
+				return errors.Errorf("truncated entry %q: expected %d bytes, got %d", hdr.Name, hdr.Size, n)
+			}
+			if err != nil {
+				f.Close()
 				return errors.Wrapf(err, "failed to copy %q from tar into file", hdr.Name)
 			}
+			// Cleanup the open fd. Don't use defer in case of many files.
+			if err := f.Close(); err != nil {
+				return errors.Wrapf(err, "failed to close file %q", path)
+			}
+			if err := opts.setModTime(path, hdr.ModTime); err != nil {
+				return err
+			}
 		default:
-			return errors.Errorf("unable to handle file type %d for %q in tar", hdr.Typeflag, hdr.Name)
+			if err := opts.skipEntry(hdr.Name, fmt.Sprintf("tar type %q", hdr.Typeflag)); err != nil {
+				return err
+			}
+			continue
 		}
-		glog.V(4).Infof("tar: processed %q", hdr.Name)
+		logging.V(4).Infof("tar: processed %q", hdr.Name)
 	}
-	glog.V(4).Infof("tar extraction to %s complete", targetDir)
+	logging.V(4).Infof("tar extraction to %s complete", targetDir)
 	return nil
 }
 
+// setModTime sets the modification time of the extracted file at path to the
+// time of its archive entry if o.PreserveModTimes is set.
+func (o Options) setModTime(path string, mtime time.Time) error {
+	if !o.PreserveModTimes {
+		return nil
+	}
+	now := time.Now()
+	if mtime.Unix() <= 0 || mtime.After(now) {
+		logging.V(4).Infof("Clamping the modification time %s of %q to now", mtime, path)
+		mtime = now
+	}
+	return errors.Wrapf(os.Chtimes(path, now, mtime), "failed to set the modification time of %q", path)
+}
+
 // GetWithSha256 downloads a zip, verifies it and extracts it to the dir.
 func GetWithSha256(uri, dir, sha string, fetcher Fetcher) error {
-	name := path.Base(uri)
-	body, size, err := download(uri, newSha256Verifier(sha), fetcher)
+	return getAndExtract(uri, dir, newSha256Verifier(sha), fetcher, Options{})
+}
+
+// GetWithChecksum downloads a zip, verifies it against the checksum and
+// extracts it to the dir as configured by opts. The checksum is a
+// hex digest optionally prefixed with its hash algorithm (e.g.
+// "sha512:<hex>"), otherwise sha256 is assumed.
+func GetWithChecksum(uri, dir, checksum string, fetcher Fetcher, opts Options) error {
+	v, err := newChecksumVerifier(checksum)
+	if err != nil {
+		return err
+	}
+	return getAndExtract(uri, dir, v, fetcher, opts)
+}
+
+// GetWithChecksumAndSize is like GetWithChecksum, but also verifies that the
+// download has the size in bytes. The download is aborted as soon as it
+// exceeds the size. A size of zero is not verified.
+func GetWithChecksumAndSize(uri, dir, checksum string, size int64, fetcher Fetcher, opts Options) error {
+	v, err := newChecksumVerifier(checksum)
 	if err != nil {
 		return err
 	}
-	return extractArchive(name, dir, body, size)
+	if size > 0 {
+		v = NewSizeVerifier(v, size)
+	}
+	return getAndExtract(uri, dir, v, fetcher, opts)
 }
 
-// GetInsecure downloads a zip and extracts it to the dir.
-func GetInsecure(uri, dir string, fetcher Fetcher) error {
-	name := path.Base(uri)
-	body, size, err := download(uri, newTrueVerifier(), fetcher)
+// GetWithVerifier downloads a zip, checks it with the verifier and extracts it
+// to the dir as configured by opts.
+func GetWithVerifier(uri, dir string, v Verifier, fetcher Fetcher, opts Options) error {
+	return getAndExtract(uri, dir, v, fetcher, opts)
+}
+
+// GetInsecure downloads a zip and extracts it to the dir as configured by
+// opts.
+func GetInsecure(uri, dir string, fetcher Fetcher, opts Options) error {
+	return getAndExtract(uri, dir, newTrueVerifier(), fetcher, opts)
+}
+
+// getAndExtract downloads the uri, checks it with the verifier and extracts it
+// to the dir as configured by opts.
+func getAndExtract(uri, dir string, v Verifier, fetcher Fetcher, opts Options) error {
+	name := urlFilename(uri)
+	if opts.StreamArchives {
+		return streamAndExtract(uri, name, dir, v, fetcher, opts)
+	}
+	body, size, err := download(uri, v, fetcher)
 	if err != nil {
 		return err
 	}
-	return extractArchive(name, dir, body, size)
+	return extractArchive(name, dir, body, size, opts)
 }
 
-func extractArchive(filename, dst string, r io.ReaderAt, size int64) error {
+// streamAndExtract extracts the download from uri into the dir while it is
+// read and verified. The download is extracted to a temporary directory in dir
+// first, whose entries are only moved to dir once the download is verified.
+func streamAndExtract(uri, filename, dir string, v Verifier, fetcher Fetcher, opts Options) error {
+	logging.V(2).Infof("Fetching %q", uri)
+	body, err := fetcher.Get(uri)
+	if err != nil {
+		return errors.Wrapf(err, "could not download %q", uri)
+	}
+	defer body.Close()
+
+	head, err := readHead(uri, body)
+	if err != nil {
+		return err
+	}
+	r := io.TeeReader(io.MultiReader(bytes.NewReader(head), body), v)
+	format := detectFormat(filename, head)
+	if format == FormatZIP {
+		logging.V(3).Infof("Zip archives can't be streamed, reading download data into memory")
+		data, err := ioutil.ReadAll(r)
+		if err != nil {
+			return errors.Wrap(err, "could not read download content")
+		}
+		if err := v.Verify(); err != nil {
+			return err
+		}
+		return extractArchive(filename, dir, bytes.NewReader(data), int64(len(data)), opts)
+	}
+
+	tmp, err := ioutil.TempDir(dir, ".krew-stream-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create temporary extraction directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	var extractErr error
+	if format == FormatTarGZ {
+		extractErr = extractTARGZ(tmp, r, opts)
+	} else if extractErr = checkExecutableName(filename); extractErr == nil {
+		logging.V(4).Infof("no archive detected, saving %q as a bare executable", filename)
+		extractErr = saveExecutable(filepath.Join(tmp, filename), r)
+	}
+	// Read what the extraction left, e.g. the padding after the end of a tar
+	// archive, so that all of the download is verified. A corrupted download
+	// is reported as such rather than as the extraction error it caused.
+	if _, err := io.Copy(ioutil.Discard, r); err != nil && extractErr == nil {
+		return errors.Wrap(err, "could not read download content")
+	}
+	if err := v.Verify(); err != nil {
+		return err
+	}
+	if extractErr != nil {
+		return extractErr
+	}
+
+	entries, err := ioutil.ReadDir(tmp)
+	if err != nil {
+		return errors.Wrapf(err, "failed to read extracted files in %q", tmp)
+	}
+	for _, e := range entries {
+		if err := os.Rename(filepath.Join(tmp, e.Name()), filepath.Join(dir, e.Name())); err != nil {
+			return errors.Wrapf(err, "failed to move extracted file %q", e.Name())
+		}
+	}
+	return nil
+}
+
+// DetectFormat reads the first bytes of the file at uri to report its format
+// without downloading it fully.
+func DetectFormat(uri string, fetcher Fetcher) (string, error) {
+	body, err := fetcher.Get(uri)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not download %q", uri)
+	}
+	defer body.Close()
+
+	head, err := readHead(uri, body)
+	if err != nil {
+		return "", err
+	}
+	return detectFormat(urlFilename(uri), head), nil
+}
+
+// detectFormat returns the format of a download from the suffix of its
+// filename, or else from the magic bytes at the start of its content.
+func detectFormat(filename string, head []byte) string {
+	switch {
+	case strings.HasSuffix(filename, ".zip"):
+		logging.V(4).Infof("detected .zip file")
+		return FormatZIP
+	case strings.HasSuffix(filename, ".tar.gz"):
+		logging.V(4).Infof("detected .tar.gz file")
+		return FormatTarGZ
+	case bytes.HasPrefix(head, zipMagic) || bytes.HasPrefix(head, emptyZipMagic):
+		logging.V(4).Infof("detected zip magic bytes")
+		return FormatZIP
+	case bytes.HasPrefix(head, gzipMagic):
+		logging.V(4).Infof("detected gzip magic bytes")
+		return FormatTarGZ
+	}
+	return FormatRaw
+}
+
+func extractArchive(filename, dst string, r io.ReaderAt, size int64, opts Options) error {
 	// TODO(ahmetb) This package is not architected well, this method should not
 	// be receiving this many args. Primary problem is at GetInsecure and
 	// GetWithSha256 methods that embed extraction in them, which is orthogonal.
@@ -165,12 +580,121 @@ func extractArchive(filename, dst string, r io.ReaderAt, size int64) error {
 	// TODO(ahmetb) write tests with this by mocking extractZIP function into a
 	// zipExtractor variable and check its execution.
 
-	if strings.HasSuffix(filename, ".zip") {
-		glog.V(4).Infof("detected .zip file")
-		return extractZIP(dst, r, size)
-	} else if strings.HasSuffix(filename, ".tar.gz") {
-		glog.V(4).Infof("detected .tar.gz file")
-		return extractTARGZ(dst, io.NewSectionReader(r, 0, size))
+	magic := make([]byte, 4)
+	n, err := r.ReadAt(magic, 0)
+	if err != nil && err != io.EOF {
+		return errors.Wrap(err, "failed to read magic bytes of the download")
+	}
+	format := detectFormat(filename, magic[:n])
+	need := uint64(size)
+	if format != FormatRaw {
+		need *= extractedSizeFactor
+	}
+	if err := CheckFreeSpace(dst, need); err != nil {
+		return err
+	}
+	switch format {
+	case FormatZIP:
+		return extractZIP(dst, r, size, opts)
+	case FormatTarGZ:
+		return extractTARGZ(dst, io.NewSectionReader(r, 0, size), opts)
+	}
+	if err := checkExecutableName(filename); err != nil {
+		return err
+	}
+	logging.V(4).Infof("no archive detected, saving %q as a bare executable", filename)
+	return saveExecutable(filepath.Join(dst, filename), io.NewSectionReader(r, 0, size))
+}
+
+// ExtractFile extracts the zip or tar.gz archive at file, e.g. an archive
+// inside a download, into dir with the same checks as a download. Unlike a
+// download, a file that is not an archive is an error.
+func ExtractFile(file, dir string, opts Options) error {
+	f, err := os.Open(file)
+	if err != nil {
+		return errors.Wrapf(err, "failed to open archive %q", file)
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return errors.Wrapf(err, "failed to stat archive %q", file)
+	}
+	head := make([]byte, sniffLen)
+	n, err := f.ReadAt(head, 0)
+	if err != nil && err != io.EOF {
+		return errors.Wrapf(err, "failed to read archive %q", file)
+	}
+	if detectFormat(filepath.Base(file), head[:n]) == FormatRaw {
+		return errors.Errorf("%q is not a zip or tar.gz archive", file)
+	}
+	return extractArchive(filepath.Base(file), dir, f, fi.Size(), opts)
+}
+
+// ExtractStats summarizes the extracted files of a download.
+type ExtractStats struct {
+	Files int
+	Dirs  int
+	// Bytes is the total size of the files.
+	Bytes uint64
+}
+
+func (s ExtractStats) String() string {
+	return fmt.Sprintf("%d files, %d directories, %d bytes", s.Files, s.Dirs, s.Bytes)
+}
+
+// StatExtracted returns the stats of the files a download was extracted to in
+// dir, not counting dir itself.
+func StatExtracted(dir string) (ExtractStats, error) {
+	var s ExtractStats
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		switch {
+		case path == dir:
+		case info.IsDir():
+			s.Dirs++
+		case info.Mode().IsRegular():
+			s.Files++
+			s.Bytes += uint64(info.Size())
+		}
+		return nil
+	})
+	return s, errors.Wrapf(err, "failed to read the extracted files in %q", dir)
+}
+
+// urlFilename returns the last element of the path of the uri, without its
+// query or fragment, e.g. "kubectl-foo" for
+// "https://example.com/kubectl-foo?token=x".
+func urlFilename(uri string) string {
+	if u, err := url.Parse(uri); err == nil {
+		return path.Base(u.Path)
+	}
+	if i := strings.IndexAny(uri, "?#"); i >= 0 {
+		uri = uri[:i]
+	}
+	return path.Base(uri)
+}
+
+// checkExecutableName checks that the last element of the url can be used as
+// the file name of a bare executable.
+func checkExecutableName(filename string) error {
+	if filename == "." || filename == ".." || filename == "/" {
+		return errors.Errorf("cannot infer a file name for the bare executable from the url (%q)", filename)
+	}
+	return nil
+}
+
+// saveExecutable writes the download that is not an archive as an executable
+// file to the path.
+func saveExecutable(path string, r io.Reader) error {
+	f, err := os.OpenFile(path, os.O_CREATE|os.O_WRONLY|os.O_TRUNC, 0755)
+	if err != nil {
+		return errors.Wrapf(err, "failed to create file %q", path)
+	}
+	if _, err := io.Copy(f, r); err != nil {
+		f.Close()
+		return errors.Wrapf(err, "failed to write executable %q", path)
 	}
-	return errors.Errorf("cannot infer a supported archive type from filename in the url (%q)", filename)
+	return f.Close()
 }
@@ -15,12 +15,23 @@
 package download
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"strings"
 	"testing"
+	"time"
+
+	"github.com/pkg/errors"
 )
 
 func testdataPath() string {
@@ -62,7 +73,7 @@ func Test_extractZIP(t *testing.T) {
 		}
 		defer zipReader.Close()
 		stat, _ := zipReader.Stat()
-		if err := extractZIP(zipDst, zipReader, stat.Size()); err != nil {
+		if err := extractZIP(zipDst, zipReader, stat.Size(), Options{}); err != nil {
 			t.Fatalf("extractZIP(%s) error = %v", tt.in, err)
 		}
 
@@ -104,7 +115,7 @@ func Test_extractTARGZ(t *testing.T) {
 		}
 		defer tf.Close()
 
-		if err := extractTARGZ(tarDst, tf); err != nil {
+		if err := extractTARGZ(tarDst, tf, Options{}); err != nil {
 			t.Fatalf("failed to extract %q. error=%v", tt.in, err)
 		}
 
@@ -115,6 +126,808 @@ func Test_extractTARGZ(t *testing.T) {
 	}
 }
 
+func Test_extractTARGZ_withoutDirectoryEntries(t *testing.T) {
+	tarDst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tarDst)
+
+	in := tarGZArchive(t, map[string]string{"test/nested/foo": "bar"})
+	if err := extractTARGZ(tarDst, in, Options{}); err != nil {
+		t.Fatalf("failed to extract archive without dir entries. error=%v", err)
+	}
+	expected := []string{"/test/", "/test/nested/", "/test/nested/foo"}
+	if outFiles := collectFiles(t, tarDst); !reflect.DeepEqual(outFiles, expected) {
+		t.Fatalf("expected=%#v, got=%#v", expected, outFiles)
+	}
+}
+
+func Test_extractArchive_sniffsArchiveType(t *testing.T) {
+	tests := []struct {
+		in    string
+		files []string
+	}{
+		{in: "test-with-directory.zip", files: []string{"/test/", "/test/foo"}},
+		{in: "test-with-directory.tar.gz", files: []string{"/test/", "/test/foo"}},
+	}
+	for _, tt := range tests {
+		dst, err := ioutil.TempDir("", "")
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer os.RemoveAll(dst)
+		data, err := ioutil.ReadFile(filepath.Join(testdataPath(), tt.in))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if err := extractArchive("download", dst, bytes.NewReader(data), int64(len(data)), Options{}); err != nil {
+			t.Fatalf("extractArchive(%s) without suffix error = %v", tt.in, err)
+		}
+		if outFiles := collectFiles(t, dst); !reflect.DeepEqual(outFiles, tt.files) {
+			t.Fatalf("for %q, expected=%#v, got=%#v", tt.in, tt.files, outFiles)
+		}
+	}
+}
+
+func Test_urlFilename(t *testing.T) {
+	tests := []struct {
+		uri  string
+		want string
+	}{
+		{"https://example.com/kubectl-foo", "kubectl-foo"},
+		{"https://example.com/foo.tar.gz?X-Amz-Signature=abc", "foo.tar.gz"},
+		{"https://example.com/kubectl-foo#bar", "kubectl-foo"},
+		{"kubectl-foo", "kubectl-foo"},
+		{"https://example.com/%zz?a=b", "%zz"},
+		{"https://example.com/", "/"},
+	}
+	for _, tt := range tests {
+		if got := urlFilename(tt.uri); got != tt.want {
+			t.Errorf("urlFilename(%q) = %q, want %q", tt.uri, got, tt.want)
+		}
+	}
+}
+
+func Test_extractArchive_bareExecutable(t *testing.T) {
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	data := []byte("#!/bin/sh\necho hello\n")
+	if err := extractArchive("kubectl-foo", dst, bytes.NewReader(data), int64(len(data)), Options{}); err != nil {
+		t.Fatalf("extractArchive() with bare executable error = %v", err)
+	}
+	path := filepath.Join(dst, "kubectl-foo")
+	got, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.Equal(got, data) {
+		t.Fatalf("extracted content = %q, want %q", got, data)
+	}
+	fi, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi.Mode()&0100 == 0 {
+		t.Fatalf("extracted file mode = %s, expected it to be executable", fi.Mode())
+	}
+
+	if err := extractArchive("..", dst, bytes.NewReader(data), int64(len(data)), Options{}); err == nil {
+		t.Fatalf("extractArchive() with bare executable named \"..\" expected error")
+	}
+}
+
+func Test_extractTARGZ_filter(t *testing.T) {
+	tarDst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tarDst)
+
+	in := tarGZArchive(t, map[string]string{
+		"bin/foo":      "foo",
+		"doc/README":   "readme",
+		"./bin/bar":    "bar",
+		"LICENSE":      "license",
+		"bin/sub/baz":  "baz",
+		"other/bin/fo": "fo",
+	})
+	filter := func(name string) bool { return strings.HasPrefix(name, "bin/") }
+	if err := extractTARGZ(tarDst, in, Options{Filter: filter}); err != nil {
+		t.Fatalf("failed to extract archive with filter. error=%v", err)
+	}
+	expected := []string{"/bin/", "/bin/bar", "/bin/foo", "/bin/sub/", "/bin/sub/baz"}
+	if outFiles := collectFiles(t, tarDst); !reflect.DeepEqual(outFiles, expected) {
+		t.Fatalf("expected=%#v, got=%#v", expected, outFiles)
+	}
+}
+
+func Test_extractZIP_filterWithoutDirEntries(t *testing.T) {
+	dst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	for _, name := range []string{"bin/foo", "bin/sub/bar", "doc/README"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if _, err := w.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	filter := func(name string) bool { return strings.HasPrefix(name, "bin/") }
+	if err := extractZIP(dst, bytes.NewReader(buf.Bytes()), int64(buf.Len()), Options{Filter: filter}); err != nil {
+		t.Fatalf("failed to extract zip without directory entries with filter. error=%v", err)
+	}
+	expected := []string{"/bin/", "/bin/foo", "/bin/sub/", "/bin/sub/bar"}
+	if outFiles := collectFiles(t, dst); !reflect.DeepEqual(outFiles, expected) {
+		t.Fatalf("expected=%#v, got=%#v", expected, outFiles)
+	}
+}
+
+func Test_checkArchiveHeader(t *testing.T) {
+	zip, err := ioutil.ReadFile(filepath.Join(testdataPath(), "test-with-directory.zip"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	targz, err := ioutil.ReadFile(filepath.Join(testdataPath(), "test-with-directory.tar.gz"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	html := []byte("<!DOCTYPE html><html><body>Not Found</body></html>")
+	tests := []struct {
+		name     string
+		filename string
+		head     []byte
+		wantErr  bool
+	}{
+		{"zip", "foo.zip", zip, false},
+		{"tar.gz", "foo.tar.gz", targz, false},
+		{"zip without suffix", "foo", zip, false},
+		{"bare executable", "kubectl-foo", []byte("#!/bin/sh\necho foo\n"), false},
+		{"html error page", "foo.tar.gz", html, true},
+		{"html without suffix", "foo", html, true},
+		{"zip instead of tar.gz", "foo.tar.gz", zip, true},
+		{"tar.gz instead of zip", "foo.zip", targz, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkArchiveHeader(tt.filename, tt.head); (err != nil) != tt.wantErr {
+				t.Errorf("checkArchiveHeader(%s) error = %v, wantErr %v", tt.filename, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_download_rejectsHTML(t *testing.T) {
+	body := ioutil.NopCloser(strings.NewReader("<html><body>404 page not found</body></html>"))
+	_, _, err := download("https://example.com/foo.tar.gz", newTrueVerifier(), FakeFetcher{body})
+	if err == nil || !strings.Contains(err.Error(), "server did not return an archive (got text/html?)") {
+		t.Fatalf("download() of html page error = %v, want server did not return an archive", err)
+	}
+}
+
+func Test_extract_preserveModTimes(t *testing.T) {
+	old := time.Date(2001, 2, 3, 4, 5, 6, 0, time.UTC)
+	entries := []struct {
+		name  string
+		mtime time.Time
+	}{
+		{"old", old},
+		{"epoch", time.Unix(0, 0)},
+		{"future", time.Now().Add(24 * time.Hour)},
+	}
+	var tarBuf bytes.Buffer
+	gzw := gzip.NewWriter(&tarBuf)
+	tw := tar.NewWriter(gzw)
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for _, e := range entries {
+		if err := tw.WriteHeader(&tar.Header{Name: e.name, Typeflag: tar.TypeReg, Mode: 0644, ModTime: e.mtime}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := zw.CreateHeader(&zip.FileHeader{Name: e.name, Modified: e.mtime}); err != nil {
+			t.Fatal(err)
+		}
+	}
+	for _, c := range []io.Closer{tw, gzw, zw} {
+		if err := c.Close(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	extractors := map[string]func(dir string, opts Options) error{
+		"tar.gz": func(dir string, opts Options) error { return extractTARGZ(dir, bytes.NewReader(tarBuf.Bytes()), opts) },
+		"zip": func(dir string, opts Options) error {
+			return extractZIP(dir, bytes.NewReader(zipBuf.Bytes()), int64(zipBuf.Len()), opts)
+		},
+	}
+
+	for format, extract := range extractors {
+		for _, preserve := range []bool{false, true} {
+			dir, err := ioutil.TempDir("", "krew-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			start := time.Now().Add(-time.Minute)
+			if err := extract(dir, Options{PreserveModTimes: preserve}); err != nil {
+				t.Fatalf("%s: extraction error = %v", format, err)
+			}
+			end := time.Now().Add(time.Minute)
+			for _, e := range entries {
+				fi, err := os.Stat(filepath.Join(dir, e.name))
+				if err != nil {
+					t.Fatal(err)
+				}
+				if preserve && e.name == "old" {
+					if !fi.ModTime().Equal(old) {
+						t.Errorf("%s: mtime of %s = %s, want %s", format, e.name, fi.ModTime(), old)
+					}
+				} else if fi.ModTime().Before(start) || fi.ModTime().After(end) {
+					t.Errorf("%s (preserve=%v): mtime of %s = %s, want about now", format, preserve, e.name, fi.ModTime())
+				}
+			}
+		}
+	}
+}
+
+func TestExtractFile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archive := filepath.Join(dir, "inner.tar.gz")
+	if err := ioutil.WriteFile(archive, tarGZArchive(t, map[string]string{"bin/foo": "foo"}).Bytes(), 0644); err != nil {
+		t.Fatal(err)
+	}
+	raw := filepath.Join(dir, "raw")
+	if err := ioutil.WriteFile(raw, []byte("#!/bin/sh\n"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	out := filepath.Join(dir, "out")
+	if err := os.Mkdir(out, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ExtractFile(archive, out, Options{}); err != nil {
+		t.Fatalf("ExtractFile() error = %v", err)
+	}
+	if expected, got := []string{"/bin/", "/bin/foo"}, collectFiles(t, out); !reflect.DeepEqual(got, expected) {
+		t.Errorf("ExtractFile() extracted %v, want %v", got, expected)
+	}
+	if err := ExtractFile(archive, out, Options{}); err == nil {
+		t.Error("ExtractFile() over extracted files expected error")
+	}
+	if err := ExtractFile(raw, out, Options{}); err == nil {
+		t.Error("ExtractFile() of a file that is not an archive expected error")
+	}
+}
+
+func TestStatExtracted(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	archive := tarGZArchive(t, map[string]string{"foo": "foo", "bar/baz": "baz!", "bar/qux/quux": ""})
+	if err := extractTARGZ(dir, archive, Options{}); err != nil {
+		t.Fatal(err)
+	}
+
+	got, err := StatExtracted(dir)
+	if err != nil {
+		t.Fatalf("StatExtracted() error = %v", err)
+	}
+	if want := (ExtractStats{Files: 3, Dirs: 2, Bytes: 7}); got != want {
+		t.Errorf("StatExtracted() = %+v, want %+v", got, want)
+	}
+	if got, want := got.String(), "3 files, 2 directories, 7 bytes"; got != want {
+		t.Errorf("String() = %q, want %q", got, want)
+	}
+	if _, err := StatExtracted(filepath.Join(dir, "not-exists")); err == nil {
+		t.Error("StatExtracted() of a missing dir expected error")
+	}
+}
+
+func Test_extractZIP_backslashSeparators(t *testing.T) {
+	zipDst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(zipDst)
+
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if _, err := zw.Create(`test\`); err != nil {
+		t.Fatal(err)
+	}
+	w, err := zw.Create(`test\nested\foo`)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := w.Write([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := extractZIP(zipDst, bytes.NewReader(buf.Bytes()), int64(buf.Len()), Options{}); err != nil {
+		t.Fatalf("extractZIP() with backslash separators error = %v", err)
+	}
+	expected := []string{"/test/", "/test/nested/", "/test/nested/foo"}
+	if outFiles := collectFiles(t, zipDst); !reflect.DeepEqual(outFiles, expected) {
+		t.Fatalf("expected=%#v, got=%#v", expected, outFiles)
+	}
+}
+
+func Test_extractTARGZ_backslashSeparators(t *testing.T) {
+	tarDst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tarDst)
+
+	in := tarGZArchive(t, map[string]string{`test\nested\foo`: "foo"})
+	if err := extractTARGZ(tarDst, in, Options{}); err != nil {
+		t.Fatalf("extractTARGZ() with backslash separators error = %v", err)
+	}
+	expected := []string{"/test/", "/test/nested/", "/test/nested/foo"}
+	if outFiles := collectFiles(t, tarDst); !reflect.DeepEqual(outFiles, expected) {
+		t.Fatalf("expected=%#v, got=%#v", expected, outFiles)
+	}
+}
+
+func Test_extractTARGZ_rejectsUnsafePaths(t *testing.T) {
+	for _, name := range []string{"/etc/passwd", "../foo", "test/../../foo", `..\foo`, "C:/foo"} {
+		t.Run(name, func(t *testing.T) {
+			tarDst, err := ioutil.TempDir("", "")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(tarDst)
+
+			in := tarGZArchive(t, map[string]string{name: "foo"})
+			if err := extractTARGZ(tarDst, in, Options{}); err == nil || !strings.Contains(err.Error(), "archive contains unsafe path") {
+				t.Fatalf("extractTARGZ() of %q error = %v, want unsafe path", name, err)
+			}
+			if outFiles := collectFiles(t, tarDst); len(outFiles) != 0 {
+				t.Fatalf("expected no files extracted, got=%#v", outFiles)
+			}
+		})
+	}
+}
+
+func Test_extractZIP_rejectsUnsafePaths(t *testing.T) {
+	var buf bytes.Buffer
+	zw := zip.NewWriter(&buf)
+	if _, err := zw.Create("../foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	zipDst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(zipDst)
+
+	if err := extractZIP(zipDst, bytes.NewReader(buf.Bytes()), int64(buf.Len()), Options{}); err == nil || !strings.Contains(err.Error(), "archive contains unsafe path") {
+		t.Fatalf("extractZIP() error = %v, want unsafe path", err)
+	}
+}
+
+func TestDetectFormat(t *testing.T) {
+	tests := []struct {
+		name    string
+		uri     string
+		content string
+		want    string
+		wantErr bool
+	}{
+		{"zip suffix", "https://example.com/foo.zip", "PK\x03\x04...", FormatZIP, false},
+		{"tar.gz suffix", "https://example.com/foo.tar.gz", "\x1f\x8b...", FormatTarGZ, false},
+		{"zip magic", "https://example.com/download?id=1", "PK\x03\x04...", FormatZIP, false},
+		{"gzip magic", "https://example.com/download?id=1", "\x1f\x8b...", FormatTarGZ, false},
+		{"raw", "https://example.com/kubectl-foo", "\x7fELF...", FormatRaw, false},
+		{"html error page", "https://example.com/foo.tar.gz", "<!DOCTYPE html><html></html>", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := DetectFormat(tt.uri, FakeFetcher{ioutil.NopCloser(strings.NewReader(tt.content))})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("DetectFormat() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("DetectFormat() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_extractArchive_specialEntries(t *testing.T) {
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	hdr := &zip.FileHeader{Name: "link"}
+	hdr.SetMode(os.ModeNamedPipe | 0644)
+	if _, err := zw.CreateHeader(hdr); err != nil {
+		t.Fatal(err)
+	}
+	if w, err := zw.Create("foo"); err != nil {
+		t.Fatal(err)
+	} else if _, err := w.Write([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	var tarBuf bytes.Buffer
+	gzw := gzip.NewWriter(&tarBuf)
+	tw := tar.NewWriter(gzw)
+	if err := tw.WriteHeader(&tar.Header{Name: "link", Typeflag: tar.TypeSymlink, Linkname: "foo"}); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.WriteHeader(&tar.Header{Name: "foo", Typeflag: tar.TypeReg, Mode: 0644, Size: 3}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write([]byte("foo")); err != nil {
+		t.Fatal(err)
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, archive := range []struct {
+		filename string
+		content  []byte
+	}{{"foo.zip", zipBuf.Bytes()}, {"foo.tar.gz", tarBuf.Bytes()}} {
+		for _, strict := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s strict=%v", archive.filename, strict), func(t *testing.T) {
+				dst, err := ioutil.TempDir("", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.RemoveAll(dst)
+
+				err = extractArchive(archive.filename, dst, bytes.NewReader(archive.content), int64(len(archive.content)), Options{StrictArchiveEntries: strict})
+				if (err != nil) != strict {
+					t.Fatalf("extractArchive() error = %v, want error %v", err, strict)
+				}
+				if strict {
+					return
+				}
+				if outFiles, expected := collectFiles(t, dst), []string{"/foo"}; !reflect.DeepEqual(outFiles, expected) {
+					t.Fatalf("expected=%#v, got=%#v", expected, outFiles)
+				}
+			})
+		}
+	}
+}
+
+func Test_extractArchive_caseCollisions(t *testing.T) {
+	var zipBuf bytes.Buffer
+	zw := zip.NewWriter(&zipBuf)
+	for _, name := range []string{"README", "readme"} {
+		if w, err := zw.Create(name); err != nil {
+			t.Fatal(err)
+		} else if _, err := w.Write([]byte(name)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := zw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	tarBuf := tarGZArchive(t, map[string]string{"README": "README", "readme": "readme"})
+
+	for _, archive := range []struct {
+		filename string
+		content  []byte
+	}{{"foo.zip", zipBuf.Bytes()}, {"foo.tar.gz", tarBuf.Bytes()}} {
+		for _, strict := range []bool{false, true} {
+			t.Run(fmt.Sprintf("%s strict=%v", archive.filename, strict), func(t *testing.T) {
+				dst, err := ioutil.TempDir("", "")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.RemoveAll(dst)
+
+				err = extractArchive(archive.filename, dst, bytes.NewReader(archive.content), int64(len(archive.content)), Options{StrictCaseCollisions: strict})
+				if (err != nil) != strict {
+					t.Fatalf("extractArchive() error = %v, want error %v", err, strict)
+				}
+				if err != nil && !strings.Contains(err.Error(), "collide on case-insensitive file systems") {
+					t.Errorf("extractArchive() error = %v, want it to report the collision", err)
+				}
+			})
+		}
+	}
+}
+
+func Test_extractTARGZ_truncatedEntry(t *testing.T) {
+	tarDst, err := ioutil.TempDir("", "")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tarDst)
+
+	var buf bytes.Buffer
+	tw := tar.NewWriter(&buf)
+	if err := tw.WriteHeader(&tar.Header{Name: "foo", Typeflag: tar.TypeReg, Mode: 0644, Size: 2048}); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := tw.Write(bytes.Repeat([]byte("a"), 2048)); err != nil {
+		t.Fatal(err)
+	}
+	// Cut the archive in the middle of the entry content.
+	var gz bytes.Buffer
+	gzw := gzip.NewWriter(&gz)
+	if _, err := gzw.Write(buf.Bytes()[:512+1000]); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	err = extractTARGZ(tarDst, &gz, Options{})
+	if err == nil || !strings.Contains(err.Error(), `truncated entry "foo": expected 2048 bytes, got 1000`) {
+		t.Fatalf("extractTARGZ() of truncated archive error = %v, want truncated entry", err)
+	}
+}
+
+func Test_extractTARGZ_preexistingPaths(t *testing.T) {
+	tests := []struct {
+		name    string
+		setup   func(t *testing.T, dir, outside string)
+		wantErr string
+	}{
+		{
+			name:  "empty dir",
+			setup: func(*testing.T, string, string) {},
+		},
+		{
+			name: "stale file",
+			setup: func(t *testing.T, dir, _ string) {
+				if err := ioutil.WriteFile(filepath.Join(dir, "foo"), []byte("stale"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "which was not extracted from this archive",
+		},
+		{
+			name: "symlinked parent dir",
+			setup: func(t *testing.T, dir, outside string) {
+				if err := os.Symlink(outside, filepath.Join(dir, "sub")); err != nil {
+					t.Fatal(err)
+				}
+			},
+			wantErr: "through the existing symlink",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "krew-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+			outside, err := ioutil.TempDir("", "krew-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(outside)
+			tt.setup(t, dir, outside)
+
+			archive := tarGZArchive(t, map[string]string{"foo": "a", "sub/bar": "b"})
+			err = extractTARGZ(dir, archive, Options{})
+			if tt.wantErr == "" {
+				if err != nil {
+					t.Fatalf("extractTARGZ() error = %v", err)
+				}
+				return
+			}
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Fatalf("extractTARGZ() error = %v, want %q", err, tt.wantErr)
+			}
+			if files := collectFiles(t, outside); len(files) != 0 {
+				t.Fatalf("extractTARGZ() wrote %v outside of the target dir", files)
+			}
+		})
+	}
+}
+
+func Test_extractTARGZ_duplicateEntries(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for _, content := range []string{"first version", "second"} {
+		if err := tw.WriteHeader(&tar.Header{Name: "foo", Typeflag: tar.TypeReg, Mode: 0644, Size: int64(len(content))}); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := extractTARGZ(dir, &buf, Options{}); err != nil {
+		t.Fatalf("extractTARGZ() error = %v", err)
+	}
+	if got, err := ioutil.ReadFile(filepath.Join(dir, "foo")); err != nil || string(got) != "second" {
+		t.Fatalf("extracted content = %q, err = %v, want the last entry", got, err)
+	}
+}
+
+func Test_download_rejectsEmpty(t *testing.T) {
+	body := ioutil.NopCloser(strings.NewReader(""))
+	_, _, err := download("https://example.com/foo.tar.gz", newTrueVerifier(), FakeFetcher{body})
+	if err == nil || !strings.Contains(err.Error(), "is empty") {
+		t.Fatalf("download() of empty file error = %v, want downloaded file is empty", err)
+	}
+}
+
+func TestGetWithChecksum_streamArchives(t *testing.T) {
+	archive := tarGZArchive(t, map[string]string{"foo": "hello", "bar": "world"}).Bytes()
+	sum := sha256.Sum256(archive)
+	tests := []struct {
+		name      string
+		uri       string
+		content   []byte
+		checksum  string
+		wantFiles []string
+		wantErr   bool
+	}{
+		{"tar.gz", "https://example.com/foo.tar.gz", archive, hex.EncodeToString(sum[:]), []string{"/bar", "/foo"}, false},
+		{"tar.gz mismatch", "https://example.com/foo.tar.gz", archive, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", nil, true},
+		{"bare executable", "https://example.com/kubectl-foo", []byte("hello world"), "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", []string{"/kubectl-foo"}, false},
+		{"bare executable with query", "https://example.com/kubectl-foo?token=x#y", []byte("hello world"), "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", []string{"/kubectl-foo"}, false},
+		{"corrupted tar.gz", "https://example.com/foo.tar.gz", archive[:len(archive)/2], hex.EncodeToString(sum[:]), nil, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dst, err := ioutil.TempDir("", "krew-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dst)
+
+			fetcher := FakeFetcher{ioutil.NopCloser(bytes.NewReader(tt.content))}
+			err = GetWithChecksum(tt.uri, dst, tt.checksum, fetcher, Options{StreamArchives: true})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("GetWithChecksum() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				if _, ok := errors.Cause(err).(*ChecksumMismatchError); !ok {
+					t.Errorf("GetWithChecksum() error = %v, want a checksum mismatch", err)
+				}
+			}
+			if got := collectFiles(t, dst); !reflect.DeepEqual(got, tt.wantFiles) {
+				t.Errorf("GetWithChecksum() extracted %v, want %v", got, tt.wantFiles)
+			}
+		})
+	}
+}
+
+// paddingReader returns zeros until limit bytes were read.
+type paddingReader struct {
+	read, limit int
+}
+
+func (r *paddingReader) Read(p []byte) (int, error) {
+	if r.read >= r.limit {
+		return 0, io.EOF
+	}
+	if len(p) > r.limit-r.read {
+		p = p[:r.limit-r.read]
+	}
+	for i := range p {
+		p[i] = 0
+	}
+	r.read += len(p)
+	return len(p), nil
+}
+
+func TestGetWithChecksumAndSize(t *testing.T) {
+	archive := tarGZArchive(t, map[string]string{"foo": "hello"}).Bytes()
+	sum := sha256.Sum256(archive)
+	checksum := hex.EncodeToString(sum[:])
+	const padding = 64 << 20
+	tests := []struct {
+		name    string
+		size    int64
+		padding int
+		wantErr bool
+	}{
+		{name: "matching size", size: int64(len(archive))},
+		{name: "size not declared", size: 0},
+		{name: "smaller than declared", size: int64(len(archive)) + 1, wantErr: true},
+		{name: "padded download", size: int64(len(archive)), padding: padding, wantErr: true},
+	}
+	for _, stream := range []bool{false, true} {
+		for _, tt := range tests {
+			t.Run(fmt.Sprintf("%s/stream=%v", tt.name, stream), func(t *testing.T) {
+				dst, err := ioutil.TempDir("", "krew-test")
+				if err != nil {
+					t.Fatal(err)
+				}
+				defer os.RemoveAll(dst)
+
+				pad := &paddingReader{limit: tt.padding}
+				fetcher := FakeFetcher{ioutil.NopCloser(io.MultiReader(bytes.NewReader(archive), pad))}
+				err = GetWithChecksumAndSize("https://example.com/foo.tar.gz", dst, checksum, tt.size, fetcher, Options{StreamArchives: stream})
+				if (err != nil) != tt.wantErr {
+					t.Fatalf("GetWithChecksumAndSize() error = %v, wantErr %v", err, tt.wantErr)
+				}
+				if pad.read == padding {
+					t.Errorf("GetWithChecksumAndSize() read all %d bytes of padding, want it to abort early", padding)
+				}
+				if err != nil {
+					if got := collectFiles(t, dst); len(got) != 0 {
+						t.Errorf("GetWithChecksumAndSize() extracted %v, want nothing", got)
+					}
+				}
+			})
+		}
+	}
+}
+
+// tarGZArchive creates a gzipped tar archive in memory that contains only
+// regular file entries for the given name to content mapping.
+func tarGZArchive(t *testing.T, files map[string]string) *bytes.Buffer {
+	var buf bytes.Buffer
+	gzw := gzip.NewWriter(&buf)
+	tw := tar.NewWriter(gzw)
+	for name, content := range files {
+		hdr := &tar.Header{
+			Name:     name,
+			Typeflag: tar.TypeReg,
+			Mode:     0644,
+			Size:     int64(len(content)),
+		}
+		if err := tw.WriteHeader(hdr); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := tw.Write([]byte(content)); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := tw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if err := gzw.Close(); err != nil {
+		t.Fatal(err)
+	}
+	return &buf
+}
+
 // collectFiles lists the files by walking the path. It prefixes elements with
 // "/" and appends "/" to directories.
 func collectFiles(t *testing.T, scanPath string) []string {
@@ -15,10 +15,28 @@
 package download
 
 import (
+	"compress/gzip"
+	"crypto/tls"
+	"crypto/x509"
+	"fmt"
 	"io"
+	"io/ioutil"
 	"net/http"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/GoogleContainerTools/krew/pkg/logging"
+	"github.com/GoogleContainerTools/krew/pkg/version"
+	"github.com/pkg/errors"
 )
 
+// DefaultUserAgent returns the User-Agent header HTTPFetcher sends unless it
+// sets its own. Some CDNs block the default user agent of Go.
+func DefaultUserAgent() string {
+	return "krew/" + version.GitTag()
+}
+
 // Fetcher is used to get files from a URI.
 type Fetcher interface {
 	// Get gets the file and returns an stream to read the file.
@@ -26,13 +44,192 @@ type Fetcher interface {
 }
 
 // HTTPFetcher is used to get a file from a http:// or https:// schema path.
-type HTTPFetcher struct{}
+type HTTPFetcher struct {
+	// Timeout limits the time to download the file, including reading the
+	// response body. Zero means no timeout.
+	Timeout time.Duration
+
+	// UserAgent overrides the User-Agent header of the requests, which is
+	// DefaultUserAgent() by default.
+	UserAgent string
+
+	// Transport makes the requests, e.g. to authenticate with a client
+	// certificate. Nil means http.DefaultTransport.
+	Transport http.RoundTripper
+}
+
+// HTTPStatusError is returned by HTTPFetcher when the server responds with a
+// status other than 2xx, e.g. http.StatusNotFound for a deleted asset.
+type HTTPStatusError struct {
+	StatusCode int
+	URI        string
+}
+
+func (e *HTTPStatusError) Error() string {
+	return fmt.Sprintf("download failed: HTTP %d for %s", e.StatusCode, e.URI)
+}
+
+// NewHTTPFetcherWithTransport returns an HTTPFetcher that makes its requests
+// with rt instead of the default transport.
+func NewHTTPFetcherWithTransport(rt http.RoundTripper) HTTPFetcher {
+	return HTTPFetcher{Transport: rt}
+}
+
+// NewTransportWithCABundle returns a transport like the default one that also
+// trusts the CA certificates in the PEM file at path, e.g. of an internal
+// mirror, besides the system roots.
+func NewTransportWithCABundle(path string) (*http.Transport, error) {
+	pem, err := ioutil.ReadFile(path)
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to read CA bundle %q", path)
+	}
+	pool, err := x509.SystemCertPool()
+	if err != nil {
+		logging.V(2).Infof("Failed to load the system CA certificates, only trusting %q: %v", path, err)
+		pool = x509.NewCertPool()
+	}
+	if !pool.AppendCertsFromPEM(pem) {
+		return nil, errors.Errorf("no CA certificates found in %q", path)
+	}
+	t := http.DefaultTransport.(*http.Transport).Clone()
+	t.TLSClientConfig = &tls.Config{RootCAs: pool}
+	return t, nil
+}
 
-// Get gets the file and returns an stream to read the file.
-func (HTTPFetcher) Get(uri string) (io.ReadCloser, error) {
-	resp, err := http.Get(uri)
+// Get gets the file and returns an stream to read the file. Responses with a
+// non-2xx status code are returned as an error, since their body is not the
+// file.
+func (f HTTPFetcher) Get(uri string) (io.ReadCloser, error) {
+	req, err := http.NewRequest(http.MethodGet, uri, nil)
+	if err != nil {
+		return nil, err
+	}
+	userAgent := DefaultUserAgent()
+	if f.UserAgent != "" {
+		userAgent = f.UserAgent
+	}
+	req.Header.Set("User-Agent", userAgent)
+	client := &http.Client{Timeout: f.Timeout, Transport: f.Transport}
+	resp, err := client.Do(req)
 	if err != nil {
 		return nil, err
 	}
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		resp.Body.Close()
+		return nil, &HTTPStatusError{StatusCode: resp.StatusCode, URI: uri}
+	}
+	if contentType := resp.Header.Get("Content-Type"); strings.HasPrefix(contentType, "text/html") {
+		logging.Warningf("%s was served as %s, which suggests an error page instead of the file", uri, contentType)
+	}
+	// The default transport only decodes the responses it requested gzip
+	// for, so a custom transport can pass on a gzipped archive gzipped again.
+	if strings.EqualFold(resp.Header.Get("Content-Encoding"), "gzip") && !resp.Uncompressed {
+		logging.V(2).Infof("Decoding the gzip Content-Encoding of %s", uri)
+		gzr, err := gzip.NewReader(resp.Body)
+		if err != nil {
+			resp.Body.Close()
+			return nil, errors.Wrapf(err, "failed to decode the gzip Content-Encoding of %s", uri)
+		}
+		return gzipBody{Reader: gzr, body: resp.Body}, nil
+	}
 	return resp.Body, nil
 }
+
+// gzipBody reads a response body with gzip Content-Encoding decoded.
+type gzipBody struct {
+	*gzip.Reader
+	body io.Closer
+}
+
+// Close closes the gzip reader and the response body.
+func (b gzipBody) Close() error {
+	b.Reader.Close()
+	return b.body.Close()
+}
+
+// readerFetcher serves the content of a reader once, regardless of the uri.
+type readerFetcher struct {
+	r        io.Reader
+	consumed bool
+}
+
+// NewReaderFetcher returns a Fetcher that returns the content of r for the
+// first Get, e.g. to install an archive piped to stdin. The uri is ignored.
+// Subsequent calls fail since the reader can only be consumed once.
+func NewReaderFetcher(r io.Reader) Fetcher {
+	return &readerFetcher{r: r}
+}
+
+// Get returns the reader of the fetcher if it has not been consumed yet.
+func (f *readerFetcher) Get(uri string) (io.ReadCloser, error) {
+	if f.consumed {
+		return nil, errors.New("the reader has already been consumed")
+	}
+	f.consumed = true
+	if rc, ok := f.r.(io.ReadCloser); ok {
+		return rc, nil
+	}
+	return ioutil.NopCloser(f.r), nil
+}
+
+// fileFetcher serves a local file, regardless of the uri.
+type fileFetcher struct {
+	path string
+}
+
+// NewFileFetcher returns a Fetcher that returns the content of the file at
+// path for every Get, e.g. to install a plugin from an archive that was
+// downloaded before. The uri is ignored.
+func NewFileFetcher(path string) Fetcher {
+	return fileFetcher{path: path}
+}
+
+// Get opens the file of the fetcher.
+func (f fileFetcher) Get(uri string) (io.ReadCloser, error) {
+	logging.V(2).Infof("Reading local file %q instead of %q", f.path, uri)
+	return os.Open(f.path)
+}
+
+// rateLimitedFetcher limits the rate its bodies are read at.
+type rateLimitedFetcher struct {
+	fetcher        Fetcher
+	bytesPerSecond int64
+}
+
+// NewRateLimitedFetcher returns a Fetcher that reads the files of f at no more
+// than bytesPerSecond on average, e.g. to not saturate a shared network. The
+// limit applies to each file separately.
+func NewRateLimitedFetcher(f Fetcher, bytesPerSecond int64) Fetcher {
+	return rateLimitedFetcher{fetcher: f, bytesPerSecond: bytesPerSecond}
+}
+
+// Get gets the file and returns a rate limited stream to read the file.
+func (f rateLimitedFetcher) Get(uri string) (io.ReadCloser, error) {
+	body, err := f.fetcher.Get(uri)
+	if err != nil {
+		return nil, err
+	}
+	return &rateLimitedReader{ReadCloser: body, bytesPerSecond: f.bytesPerSecond, start: time.Now()}, nil
+}
+
+type rateLimitedReader struct {
+	io.ReadCloser
+	bytesPerSecond int64
+	start          time.Time
+	read           int64
+}
+
+// Read reads at most a second worth of bytes and then sleeps until reading
+// them was allowed.
+func (r *rateLimitedReader) Read(p []byte) (int, error) {
+	if int64(len(p)) > r.bytesPerSecond {
+		p = p[:r.bytesPerSecond]
+	}
+	n, err := r.ReadCloser.Read(p)
+	r.read += int64(n)
+	allowed := time.Duration(float64(r.read) / float64(r.bytesPerSecond) * float64(time.Second))
+	if wait := allowed - time.Since(r.start); wait > 0 {
+		time.Sleep(wait)
+	}
+	return n, err
+}
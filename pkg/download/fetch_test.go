@@ -14,7 +14,20 @@
 
 package download
 
-import "io"
+import (
+	"bytes"
+	"compress/gzip"
+	"encoding/pem"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
 
 // FakeFetcher is used for testing.
 type FakeFetcher struct {
@@ -25,3 +38,236 @@ type FakeFetcher struct {
 func (ff FakeFetcher) Get(uri string) (io.ReadCloser, error) {
 	return ff.ReadCloser, nil
 }
+
+func TestHTTPFetcher_Get_status(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		w.Write([]byte("foo"))
+	}))
+	defer server.Close()
+
+	body, err := HTTPFetcher{}.Get(server.URL + "/found")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	body.Close()
+	_, err = HTTPFetcher{}.Get(server.URL + "/missing")
+	if want := "download failed: HTTP 404 for " + server.URL + "/missing"; err == nil || err.Error() != want {
+		t.Fatalf("Get() error = %v, want %q", err, want)
+	}
+	if statusErr, ok := err.(*HTTPStatusError); !ok || statusErr.StatusCode != http.StatusNotFound {
+		t.Errorf("Get() error = %#v, want an HTTPStatusError with status 404", err)
+	}
+}
+
+func TestNewTransportWithCABundle(t *testing.T) {
+	server := httptest.NewTLSServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("foo"))
+	}))
+	defer server.Close()
+	tmp, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	bundle := filepath.Join(tmp, "ca.pem")
+	cert := pem.EncodeToMemory(&pem.Block{Type: "CERTIFICATE", Bytes: server.Certificate().Raw})
+	if err := ioutil.WriteFile(bundle, cert, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := (HTTPFetcher{}).Get(server.URL); err == nil {
+		t.Fatal("Get() without the CA bundle expected a certificate error")
+	}
+	rt, err := NewTransportWithCABundle(bundle)
+	if err != nil {
+		t.Fatalf("NewTransportWithCABundle() error = %v", err)
+	}
+	body, err := HTTPFetcher{Transport: rt}.Get(server.URL)
+	if err != nil {
+		t.Fatalf("Get() with the CA bundle error = %v", err)
+	}
+	body.Close()
+
+	empty := filepath.Join(tmp, "empty.pem")
+	if err := ioutil.WriteFile(empty, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTransportWithCABundle(empty); err == nil {
+		t.Error("NewTransportWithCABundle() of a bundle without certificates expected error")
+	}
+	if _, err := NewTransportWithCABundle(filepath.Join(tmp, "missing.pem")); err == nil {
+		t.Error("NewTransportWithCABundle() of a missing bundle expected error")
+	}
+}
+
+func TestHTTPFetcher_Get_contentEncoding(t *testing.T) {
+	var encoded bytes.Buffer
+	gzw := gzip.NewWriter(&encoded)
+	gzw.Write([]byte("archive"))
+	gzw.Close()
+	for _, tt := range []struct {
+		name         string
+		encoding     string
+		uncompressed bool
+		want         string
+	}{
+		{"gzip", "gzip", false, "archive"},
+		{"decoded by the transport", "", true, encoded.String()},
+		{"no encoding", "", false, encoded.String()},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			rt := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+				header := http.Header{}
+				if tt.encoding != "" {
+					header.Set("Content-Encoding", tt.encoding)
+				}
+				return &http.Response{
+					StatusCode:   http.StatusOK,
+					Header:       header,
+					Body:         ioutil.NopCloser(bytes.NewReader(encoded.Bytes())),
+					Uncompressed: tt.uncompressed,
+					Request:      r,
+				}, nil
+			})
+			body, err := NewHTTPFetcherWithTransport(rt).Get("https://example.invalid/foo.tar.gz")
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			defer body.Close()
+			if got, err := ioutil.ReadAll(body); err != nil || string(got) != tt.want {
+				t.Errorf("Get() content = %q, %v, want %q", got, err, tt.want)
+			}
+		})
+	}
+}
+
+func TestNewReaderFetcher(t *testing.T) {
+	f := NewReaderFetcher(strings.NewReader("foo"))
+	body, err := f.Get("ignored")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	if got, err := ioutil.ReadAll(body); err != nil || string(got) != "foo" {
+		t.Fatalf("Get() content = %q, err = %v, want %q", got, err, "foo")
+	}
+	if _, err := f.Get("ignored"); err == nil {
+		t.Fatalf("second Get() expected error")
+	}
+}
+
+func TestNewFileFetcher(t *testing.T) {
+	f, err := ioutil.TempFile("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.Remove(f.Name())
+	if _, err := f.WriteString("foo"); err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+
+	fetcher := NewFileFetcher(f.Name())
+	for i := 0; i < 2; i++ {
+		body, err := fetcher.Get("https://example.com/ignored")
+		if err != nil {
+			t.Fatalf("Get() error = %v", err)
+		}
+		got, err := ioutil.ReadAll(body)
+		body.Close()
+		if err != nil || string(got) != "foo" {
+			t.Fatalf("Get() content = %q, err = %v, want %q", got, err, "foo")
+		}
+	}
+	if _, err := NewFileFetcher(f.Name() + "-not-exists").Get("ignored"); err == nil {
+		t.Fatal("Get() of missing file expected error")
+	}
+}
+
+func TestNewRateLimitedFetcher(t *testing.T) {
+	content := strings.Repeat("a", 300)
+	f := NewRateLimitedFetcher(NewReaderFetcher(strings.NewReader(content)), 1000)
+
+	start := time.Now()
+	body, err := f.Get("ignored")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	got, err := ioutil.ReadAll(body)
+	if err != nil || string(got) != content {
+		t.Fatalf("Get() content = %q, err = %v, want %q", got, err, content)
+	}
+	if elapsed := time.Since(start); elapsed < 250*time.Millisecond {
+		t.Fatalf("reading 300 bytes at 1000 bytes/s took %s, want at least 300ms", elapsed)
+	}
+}
+
+type roundTripperFunc func(*http.Request) (*http.Response, error)
+
+func (f roundTripperFunc) RoundTrip(r *http.Request) (*http.Response, error) { return f(r) }
+
+func TestNewHTTPFetcherWithTransport(t *testing.T) {
+	var gotURL string
+	rt := roundTripperFunc(func(r *http.Request) (*http.Response, error) {
+		gotURL = r.URL.String()
+		return &http.Response{
+			StatusCode: http.StatusOK,
+			Body:       ioutil.NopCloser(strings.NewReader("from transport")),
+			Request:    r,
+		}, nil
+	})
+
+	body, err := NewHTTPFetcherWithTransport(rt).Get("https://example.invalid/foo.tar.gz")
+	if err != nil {
+		t.Fatalf("Get() error = %v", err)
+	}
+	defer body.Close()
+	got, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(got) != "from transport" {
+		t.Errorf("Get() = %q, want the response of the transport", got)
+	}
+	if want := "https://example.invalid/foo.tar.gz"; gotURL != want {
+		t.Errorf("transport got request for %q, want %q", gotURL, want)
+	}
+}
+
+func TestHTTPFetcher_userAgent(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(r.UserAgent()))
+	}))
+	defer server.Close()
+
+	tests := []struct {
+		name    string
+		fetcher HTTPFetcher
+		want    string
+	}{
+		{"default", HTTPFetcher{}, DefaultUserAgent()},
+		{"override", HTTPFetcher{UserAgent: "custom/1.0"}, "custom/1.0"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			body, err := tt.fetcher.Get(server.URL)
+			if err != nil {
+				t.Fatalf("Get() error = %v", err)
+			}
+			defer body.Close()
+			got, err := ioutil.ReadAll(body)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(got) != tt.want {
+				t.Errorf("Get() sent User-Agent %q, want %q", got, tt.want)
+			}
+		})
+	}
+	if got := DefaultUserAgent(); !strings.HasPrefix(got, "krew/") {
+		t.Errorf("DefaultUserAgent() = %q, want prefix krew/", got)
+	}
+}
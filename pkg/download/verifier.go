@@ -17,47 +17,256 @@ package download
 import (
 	"bytes"
 	"crypto/sha256"
+	"crypto/sha512"
+	"encoding/base64"
 	"encoding/hex"
+	"fmt"
 	"hash"
 	"io"
 	"io/ioutil"
+	"strings"
 
 	"github.com/pkg/errors"
 )
 
+const defaultChecksumAlgorithm = "sha256"
+
 // Verifier can check a reader against it's correctness.
-type verifier interface {
+type Verifier interface {
 	io.Writer
 	Verify() error
 }
 
-var _ verifier = sha256Verifier{}
+var _ Verifier = hashVerifier{}
+
+// sizeVerifier counts the bytes written to a verifier.
+type sizeVerifier struct {
+	v       Verifier
+	size    int64
+	written int64
+}
+
+// NewSizeVerifier returns a Verifier that checks that exactly size bytes are
+// written, and then verifies them with v. Writes fail as soon as they exceed
+// the size, so that an oversized or padded download is aborted early.
+func NewSizeVerifier(v Verifier, size int64) Verifier {
+	return &sizeVerifier{v: v, size: size}
+}
+
+func (s *sizeVerifier) Write(p []byte) (int, error) {
+	if s.written+int64(len(p)) > s.size {
+		return 0, errors.Errorf("download exceeds its expected size of %d bytes", s.size)
+	}
+	s.written += int64(len(p))
+	return s.v.Write(p)
+}
 
-type sha256Verifier struct {
+func (s *sizeVerifier) Verify() error {
+	if s.written != s.size {
+		return errors.Errorf("download has %d bytes, expected %d", s.written, s.size)
+	}
+	return s.v.Verify()
+}
+
+type hashVerifier struct {
 	hash.Hash
 	wantedHash []byte
 }
 
-// newSha256Verifier creates a Verifier that tests against the given hash.
-func newSha256Verifier(hash string) verifier {
+// newSha256Verifier creates a Verifier that tests against the given sha256 hash.
+func newSha256Verifier(hash string) Verifier {
 	raw, _ := hex.DecodeString(hash)
-	return sha256Verifier{
-		Hash:       sha256.New(),
-		wantedHash: raw,
+	return newHashVerifier(sha256.New(), raw)
+}
+
+func newHashVerifier(h hash.Hash, wanted []byte) Verifier {
+	return hashVerifier{
+		Hash:       h,
+		wantedHash: wanted,
+	}
+}
+
+// newChecksumVerifier creates a Verifier for a checksum in one of the forms
+// accepted by ParseChecksum.
+func newChecksumVerifier(checksum string) (Verifier, error) {
+	digests := IntegrityDigests(checksum)
+	if len(digests) > 1 {
+		return NewIntegrityVerifier(checksum)
+	} else if len(digests) == 0 {
+		return nil, errors.New("checksum has no digest")
+	}
+	algorithm, digest, err := ParseChecksum(digests[0])
+	if err != nil {
+		return nil, err
+	}
+	return newHashVerifier(newHash(algorithm), digest), nil
+}
+
+// IntegrityDigests returns the space-separated digests of a checksum or a
+// subresource integrity string without their options, i.e. what follows a "?"
+// in a digest.
+func IntegrityDigests(integrity string) []string {
+	var digests []string
+	for _, field := range strings.Fields(integrity) {
+		if i := strings.Index(field, "?"); i >= 0 {
+			field = field[:i]
+		}
+		digests = append(digests, field)
+	}
+	return digests
+}
+
+// newHash returns the hash of an algorithm accepted by ParseChecksum.
+func newHash(algorithm string) hash.Hash {
+	switch algorithm {
+	case "sha384":
+		return sha512.New384()
+	case "sha512":
+		return sha512.New()
 	}
+	return sha256.New()
 }
 
-func (v sha256Verifier) Verify() error {
+// ParseChecksum returns the hash algorithm and the raw digest of a checksum in
+// one of the following forms:
+//
+//	<hex>                  a sha256 digest
+//	<algorithm>:<hex>      e.g. "sha512:<hex>"
+//	<algorithm>-<base64>   subresource integrity style, e.g. "sha256-<base64>"
+//
+// Supported algorithms are sha256, sha384 and sha512.
+func ParseChecksum(checksum string) (algorithm string, digest []byte, err error) {
+	encoded := checksum
+	decode := hex.DecodeString
+	algorithm = defaultChecksumAlgorithm
+	if i := strings.Index(checksum, ":"); i >= 0 {
+		algorithm, encoded = checksum[:i], checksum[i+1:]
+	} else if i := strings.Index(checksum, "-"); i >= 0 {
+		algorithm, encoded = checksum[:i], checksum[i+1:]
+		decode = base64.StdEncoding.DecodeString
+	}
+	algorithm = strings.ToLower(algorithm)
+	if algorithm != "sha256" && algorithm != "sha384" && algorithm != "sha512" {
+		return "", nil, errors.Errorf("unsupported checksum algorithm %q", algorithm)
+	}
+	digest, err = decode(encoded)
+	if err != nil {
+		return "", nil, errors.Wrapf(err, "failed to decode checksum %q", checksum)
+	}
+	if len(digest) == 0 {
+		return "", nil, errors.Errorf("checksum %q has an empty digest", checksum)
+	}
+	return algorithm, digest, nil
+}
+
+func (v hashVerifier) Verify() error {
 	if bytes.Equal(v.wantedHash, v.Sum(nil)) {
 		return nil
 	}
-	return errors.Errorf("checksum does not match, want: %x, got %x", v.wantedHash, v.Sum(nil))
+	return &ChecksumMismatchError{
+		Want: hex.EncodeToString(v.wantedHash),
+		Got:  hex.EncodeToString(v.Sum(nil)),
+	}
+}
+
+// ChecksumMismatchError is returned when the downloaded content does not
+// match the expected checksum. Want and Got are hex digests.
+type ChecksumMismatchError struct {
+	Want, Got string
+}
+
+func (e *ChecksumMismatchError) Error() string {
+	return fmt.Sprintf("checksum does not match, want: %s, got %s", e.Want, e.Got)
+}
+
+// multiSha256Verifier accepts the content if its sha256 digest matches any of
+// the wanted hashes.
+type multiSha256Verifier struct {
+	hash.Hash
+	wantedHashes []string
+}
+
+var _ Verifier = multiSha256Verifier{}
+
+// NewMultiSHA256Verifier creates a Verifier that accepts any of the given hex
+// sha256 hashes, e.g. while the artifacts of a release are rebuilt.
+func NewMultiSHA256Verifier(hashes ...string) Verifier {
+	return multiSha256Verifier{Hash: sha256.New(), wantedHashes: hashes}
+}
+
+func (v multiSha256Verifier) Verify() error {
+	got := v.Sum(nil)
+	for _, want := range v.wantedHashes {
+		if raw, err := hex.DecodeString(want); err == nil && bytes.Equal(raw, got) {
+			return nil
+		}
+	}
+	return errors.Errorf("digest %s matched none of %d expected values: %s", hex.EncodeToString(got), len(v.wantedHashes), strings.Join(v.wantedHashes, ", "))
+}
+
+// integrityVerifier accepts the content if any of the digests of a
+// subresource integrity string matches.
+type integrityVerifier struct {
+	io.Writer
+	hashes  map[string]hash.Hash
+	digests []integrityDigest
+}
+
+type integrityDigest struct {
+	algorithm string
+	digest    []byte
+}
+
+var _ Verifier = integrityVerifier{}
+
+// NewIntegrityVerifier creates a Verifier for a subresource integrity string,
+// i.e. space-separated "<algorithm>-<base64>" digests such as
+// "sha384-<base64> sha512-<base64>". The content is accepted if it matches
+// any of them. Options after a "?" in a digest are ignored.
+func NewIntegrityVerifier(integrity string) (Verifier, error) {
+	v := integrityVerifier{hashes: make(map[string]hash.Hash)}
+	var writers []io.Writer
+	for _, field := range IntegrityDigests(integrity) {
+		i := strings.Index(field, "-")
+		if i < 0 {
+			return nil, errors.Errorf("integrity %q has no algorithm", field)
+		}
+		algorithm, digest, err := ParseChecksum(field)
+		if err != nil {
+			return nil, errors.Wrapf(err, "invalid integrity %q", integrity)
+		}
+		if _, ok := v.hashes[algorithm]; !ok {
+			v.hashes[algorithm] = newHash(algorithm)
+			writers = append(writers, v.hashes[algorithm])
+		}
+		v.digests = append(v.digests, integrityDigest{algorithm: algorithm, digest: digest})
+	}
+	if len(v.digests) == 0 {
+		return nil, errors.New("integrity has no digests")
+	}
+	v.Writer = io.MultiWriter(writers...)
+	return v, nil
+}
+
+func (v integrityVerifier) Verify() error {
+	sums := make(map[string][]byte, len(v.hashes))
+	for algorithm, h := range v.hashes {
+		sums[algorithm] = h.Sum(nil)
+	}
+	var wanted []string
+	for _, d := range v.digests {
+		if bytes.Equal(d.digest, sums[d.algorithm]) {
+			return nil
+		}
+		wanted = append(wanted, d.algorithm+"-"+base64.StdEncoding.EncodeToString(d.digest))
+	}
+	return errors.Errorf("content matched none of the integrity digests: %s", strings.Join(wanted, " "))
 }
 
-var _ verifier = trueVerifier{}
+var _ Verifier = trueVerifier{}
 
 type trueVerifier struct{ io.Writer }
 
 // newTrueVerifier returns a Verifier that always verifies to true.
-func newTrueVerifier() verifier    { return trueVerifier{ioutil.Discard} }
+func newTrueVerifier() Verifier    { return trueVerifier{ioutil.Discard} }
 func (trueVerifier) Verify() error { return nil }
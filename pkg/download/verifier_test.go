@@ -16,7 +16,10 @@ package download
 
 import (
 	"bytes"
+	"fmt"
 	"io"
+	"reflect"
+	"strings"
 	"testing"
 )
 
@@ -59,6 +62,221 @@ func TestSha256Verifier(t *testing.T) {
 	}
 }
 
+func TestChecksumVerifier(t *testing.T) {
+	tests := []struct {
+		name        string
+		checksum    string
+		write       []byte
+		wantInitErr bool
+		wantError   bool
+	}{
+		{
+			name:     "sha256 without prefix",
+			checksum: "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+			write:    []byte("hello world"),
+		},
+		{
+			name:     "sha256 with prefix",
+			checksum: "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+			write:    []byte("hello world"),
+		},
+		{
+			name:     "sha512 with prefix",
+			checksum: "sha512:309ecc489c12d6eb4cc40f50c902f2b4d0ed77ee511a7c7a9bcd3ca86d4cd86f989dd35bc5ff499670da34255b45b0cfd830e81f605dcf7dc5542e93ae9cd76f",
+			write:    []byte("hello world"),
+		},
+		{
+			name:      "sha512 wrong hash",
+			checksum:  "sha512:309ecc489c12d6eb4cc40f50c902f2b4d0ed77ee511a7c7a9bcd3ca86d4cd86f989dd35bc5ff499670da34255b45b0cfd830e81f605dcf7dc5542e93ae9cd76f",
+			write:     []byte("HELLO WORLD"),
+			wantError: true,
+		},
+		{
+			name:     "sha256 base64",
+			checksum: "sha256-uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=",
+			write:    []byte("hello world"),
+		},
+		{
+			name:     "sha256 with prefix and options",
+			checksum: "sha256:b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9?opts",
+			write:    []byte("hello world"),
+		},
+		{
+			name:     "sha256 base64 with options",
+			checksum: "sha256-uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=?opts",
+			write:    []byte("hello world"),
+		},
+		{
+			name:     "sha512 base64",
+			checksum: "sha512-MJ7MSJwS1utMxA9QyQLytNDtd+5RGnx6m808qG1M2G+YndNbxf9JlnDaNCVbRbDP2DDoH2Bdz33FVC6TrpzXbw==",
+			write:    []byte("hello world"),
+		},
+		{
+			name:      "sha256 base64 wrong hash",
+			checksum:  "sha256-uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=",
+			write:     []byte("HELLO WORLD"),
+			wantError: true,
+		},
+		{
+			name:        "invalid base64",
+			checksum:    "sha256-not*base64",
+			wantInitErr: true,
+		},
+		{
+			name:        "invalid hex",
+			checksum:    "sha256:xyz",
+			wantInitErr: true,
+		},
+		{
+			name:        "empty digest",
+			checksum:    "sha256:",
+			wantInitErr: true,
+		},
+		{
+			name:        "unsupported algorithm",
+			checksum:    "md5:5eb63bbbe01eeed093cb22bb8f5acdc3",
+			wantInitErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := newChecksumVerifier(tt.checksum)
+			if (err != nil) != tt.wantInitErr {
+				t.Fatalf("newChecksumVerifier(%s) error = %v, want %v", tt.checksum, err, tt.wantInitErr)
+			}
+			if err != nil {
+				return
+			}
+			io.Copy(v, bytes.NewReader(tt.write))
+			if err := v.Verify(); (err != nil) != tt.wantError {
+				t.Errorf("newChecksumVerifier(%s).Write(%x).Verify() = %v, want %v", tt.checksum, tt.write, err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestMultiSHA256Verifier(t *testing.T) {
+	const (
+		helloWorld = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+		other      = "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447"
+	)
+	tests := []struct {
+		name      string
+		hashes    []string
+		write     []byte
+		wantError bool
+	}{
+		{"matches first", []string{helloWorld, other}, []byte("hello world"), false},
+		{"matches second", []string{other, helloWorld}, []byte("hello world"), false},
+		{"matches none", []string{helloWorld, other}, []byte("HELLO WORLD"), true},
+		{"no hashes", nil, []byte("hello world"), true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewMultiSHA256Verifier(tt.hashes...)
+			io.Copy(v, bytes.NewReader(tt.write))
+			err := v.Verify()
+			if (err != nil) != tt.wantError {
+				t.Fatalf("NewMultiSHA256Verifier().Write(%x).Verify() = %v, want %v", tt.write, err, tt.wantError)
+			}
+			if err != nil && !strings.Contains(err.Error(), fmt.Sprintf("matched none of %d expected values", len(tt.hashes))) {
+				t.Errorf("NewMultiSHA256Verifier().Verify() error = %v, want it to list the expected values", err)
+			}
+		})
+	}
+}
+
+func TestNewIntegrityVerifier(t *testing.T) {
+	const (
+		sha256HelloWorld = "sha256-uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek="
+		sha384HelloWorld = "sha384-/b2OdaZ/KfcBpOBAOF4uI5hjA+oQI5IRr5B/y7g1eLPkF8txzmRu/QgZ3YwIjeG9"
+		sha512HelloWorld = "sha512-MJ7MSJwS1utMxA9QyQLytNDtd+5RGnx6m808qG1M2G+YndNbxf9JlnDaNCVbRbDP2DDoH2Bdz33FVC6TrpzXbw=="
+		sha384Other      = "sha384-AAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAAA"
+	)
+	tests := []struct {
+		name        string
+		integrity   string
+		write       []byte
+		wantInitErr bool
+		wantError   bool
+	}{
+		{name: "sha384", integrity: sha384HelloWorld, write: []byte("hello world")},
+		{name: "sha384 mismatch", integrity: sha384HelloWorld, write: []byte("HELLO WORLD"), wantError: true},
+		{name: "any of several", integrity: sha384Other + " " + sha512HelloWorld, write: []byte("hello world")},
+		{name: "same algorithm twice", integrity: sha384Other + "  " + sha384HelloWorld, write: []byte("hello world")},
+		{name: "options are ignored", integrity: sha256HelloWorld + "?foo", write: []byte("hello world")},
+		{name: "none match", integrity: sha384Other + " " + sha512HelloWorld, write: []byte("HELLO WORLD"), wantError: true},
+		{name: "unsupported algorithm", integrity: "md5-XrY7u+Ae7tCTyyK7j1rNww== " + sha384HelloWorld, wantInitErr: true},
+		{name: "hex checksum", integrity: "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", wantInitErr: true},
+		{name: "empty", integrity: " ", wantInitErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v, err := NewIntegrityVerifier(tt.integrity)
+			if (err != nil) != tt.wantInitErr {
+				t.Fatalf("NewIntegrityVerifier(%s) error = %v, want %v", tt.integrity, err, tt.wantInitErr)
+			}
+			if err != nil {
+				return
+			}
+			io.Copy(v, bytes.NewReader(tt.write))
+			if err := v.Verify(); (err != nil) != tt.wantError {
+				t.Errorf("NewIntegrityVerifier(%s).Write(%x).Verify() = %v, want %v", tt.integrity, tt.write, err, tt.wantError)
+			}
+		})
+	}
+}
+
+func TestIntegrityDigests(t *testing.T) {
+	tests := []struct {
+		integrity string
+		want      []string
+	}{
+		{"", nil},
+		{"deadbeef", []string{"deadbeef"}},
+		{"sha256:deadbeef?opts", []string{"sha256:deadbeef"}},
+		{" sha384-abc?a?b  sha512-def ", []string{"sha384-abc", "sha512-def"}},
+	}
+	for _, tt := range tests {
+		if got := IntegrityDigests(tt.integrity); !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("IntegrityDigests(%q) = %q, want %q", tt.integrity, got, tt.want)
+		}
+	}
+}
+
+func TestSizeVerifier(t *testing.T) {
+	const helloWorld = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	tests := []struct {
+		name         string
+		size         int64
+		write        []string
+		wantWriteErr bool
+		wantError    bool
+	}{
+		{name: "exact size", size: 11, write: []string{"hello ", "world"}},
+		{name: "too short", size: 12, write: []string{"hello world"}, wantError: true},
+		{name: "exceeds size", size: 6, write: []string{"hello ", "world"}, wantWriteErr: true, wantError: true},
+		{name: "wrong hash", size: 11, write: []string{"HELLO WORLD"}, wantError: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			v := NewSizeVerifier(newSha256Verifier(helloWorld), tt.size)
+			var writeErr error
+			for _, w := range tt.write {
+				if _, writeErr = v.Write([]byte(w)); writeErr != nil {
+					break
+				}
+			}
+			if (writeErr != nil) != tt.wantWriteErr {
+				t.Fatalf("NewSizeVerifier(%d).Write() error = %v, want %v", tt.size, writeErr, tt.wantWriteErr)
+			}
+			if err := v.Verify(); (err != nil) != tt.wantError {
+				t.Errorf("NewSizeVerifier(%d).Verify() = %v, want %v", tt.size, err, tt.wantError)
+			}
+		})
+	}
+}
+
 func TestTrueVerifier(t *testing.T) {
 	tests := []struct {
 		name      string
@@ -25,15 +25,22 @@ import (
 	"github.com/GoogleContainerTools/krew/pkg/pathutil"
 )
 
+// defaultBinPrefix is the prefix of plugin executables discovered by kubectl.
+const defaultBinPrefix = "kubectl-"
+
 // Paths contains all important environment paths
 type Paths struct {
-	base string
-	tmp  string
+	base      string
+	tmp       string
+	bin       string
+	download  string
+	binPrefix string
 }
 
 // MustGetKrewPaths returns the inferred paths for krew. By default, it assumes
 // $HOME/.krew as the base path, but can be overriden via KREW_ROOT environment
-// variable.
+// variable. The download directory can be relocated via KREW_DOWNLOAD_DIR
+// environment variable, e.g. to a larger disk.
 func MustGetKrewPaths() Paths {
 	base := filepath.Join(homedir.HomeDir(), ".krew")
 	if fromEnv := os.Getenv("KREW_ROOT"); fromEnv != "" {
@@ -44,11 +51,37 @@ func MustGetKrewPaths() Paths {
 	if err != nil {
 		panic(errors.Wrap(err, "cannot get absolute path"))
 	}
-	return newPaths(base)
+	p := newPaths(base)
+	if fromEnv := os.Getenv("KREW_DOWNLOAD_DIR"); fromEnv != "" {
+		glog.V(4).Infof("using environment override KREW_DOWNLOAD_DIR=%s", fromEnv)
+		download, err := filepath.Abs(fromEnv)
+		if err != nil {
+			panic(errors.Wrap(err, "cannot get absolute path"))
+		}
+		p.download = download
+	}
+	return p
 }
 
 func newPaths(base string) Paths {
-	return Paths{base: base, tmp: os.TempDir()}
+	return Paths{base: base, tmp: os.TempDir(), binPrefix: defaultBinPrefix}
+}
+
+// WithBinPath returns a copy of the paths where plugin executable symbolic
+// links are created in dir instead of the bin directory of the krew root.
+// Plugins are still installed to InstallPath. It allows per-project plugin
+// sets without multiple krew roots.
+func (p Paths) WithBinPath(dir string) Paths {
+	p.bin = dir
+	return p
+}
+
+// WithBinPrefix returns a copy of the paths where plugin executables are named
+// with the given prefix instead of "kubectl-". It allows serving host commands
+// other than kubectl.
+func (p Paths) WithBinPrefix(prefix string) Paths {
+	p.binPrefix = prefix
+	return p
 }
 
 // BasePath returns krew base directory.
@@ -63,11 +96,36 @@ func (p Paths) IndexPath() string { return filepath.Join(p.base, "index") }
 // This path should be added to $PATH in client machine.
 //
 // e.g. {BinPath}/kubectl-foo
-func (p Paths) BinPath() string { return filepath.Join(p.base, "bin") }
+func (p Paths) BinPath() string {
+	if p.bin != "" {
+		return p.bin
+	}
+	return filepath.Join(p.base, "bin")
+}
+
+// BinPrefix returns the prefix of the plugin executable names in BinPath. The
+// host command discovers plugins by this prefix.
+//
+// e.g. {BinPath}/{BinPrefix}foo
+func (p Paths) BinPrefix() string { return p.binPrefix }
+
+// DownloadPath returns a temporary directory for downloading and extracting
+// plugins, before their files are moved to the StagingPath. It does not create
+// a new directory on each call.
+//
+// e.g. {DownloadPath}/{plugin-name}/{..extracted files..}
+func (p Paths) DownloadPath() string {
+	if p.download != "" {
+		return p.download
+	}
+	return filepath.Join(p.tmp, "krew-downloads")
+}
 
-// DownloadPath returns a temporary directory for downloading plugins. It does
-// not create a new directory on each call.
-func (p Paths) DownloadPath() string { return filepath.Join(p.tmp, "krew-downloads") }
+// StagingPath returns the directory where the files of a plugin are assembled
+// before they are moved to its install path. Unlike the DownloadPath, it is in
+// the krew root, so it is not removed by temp directory cleaners and it is
+// on the same file system as the InstallPath.
+func (p Paths) StagingPath() string { return filepath.Join(p.base, "staging") }
 
 // InstallPath returns the base directory for plugin installations.
 //
@@ -116,8 +174,10 @@ func GetExecutedVersion(installPath string, executionPath string, pathResolver f
 }
 
 // Realpath evaluates symbolic links. If the path is not a symbolic link, it
-// returns the cleaned path. Symbolic links with relative paths return error.
+// returns the cleaned path. Symbolic links with relative paths are resolved
+// relative to the directory of the link.
 func Realpath(path string) (string, error) {
+	link := path
 	s, err := os.Lstat(path)
 	if err != nil {
 		return "", errors.Wrapf(err, "failed to stat the currently executed path (%q)", path)
@@ -128,7 +188,7 @@ func Realpath(path string) (string, error) {
 			return "", errors.Wrap(err, "failed to resolve the symlink of the currently executed version")
 		}
 		if !filepath.IsAbs(path) {
-			return "", errors.Errorf("symbolic link is relative (%s)", path)
+			path = filepath.Join(filepath.Dir(link), path)
 		}
 	}
 	return filepath.Clean(path), nil
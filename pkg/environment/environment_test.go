@@ -44,6 +44,20 @@ func TestMustGetKrewPaths_envOverride(t *testing.T) {
 	}
 }
 
+func TestMustGetKrewPaths_downloadDirOverride(t *testing.T) {
+	custom := filepath.FromSlash("/custom/downloads")
+	os.Setenv("KREW_DOWNLOAD_DIR", custom)
+	defer os.Unsetenv("KREW_DOWNLOAD_DIR")
+
+	p := MustGetKrewPaths()
+	if expected, got := custom, p.DownloadPath(); got != expected {
+		t.Fatalf("DownloadPath()=%s; expected=%s", got, expected)
+	}
+	if expected, got := MustGetKrewPaths().InstallPath(), p.InstallPath(); got != expected {
+		t.Fatalf("InstallPath()=%s; expected=%s", got, expected)
+	}
+}
+
 func TestPaths(t *testing.T) {
 	base := filepath.FromSlash("/foo")
 	p := newPaths(base)
@@ -56,6 +70,9 @@ func TestPaths(t *testing.T) {
 	if got, expected := p.IndexPath(), filepath.FromSlash("/foo/index"); got != expected {
 		t.Fatalf("IndexPath()=%s; expected=%s", got, expected)
 	}
+	if got, expected := p.StagingPath(), filepath.FromSlash("/foo/staging"); got != expected {
+		t.Fatalf("StagingPath()=%s; expected=%s", got, expected)
+	}
 	if got, expected := p.InstallPath(), filepath.FromSlash("/foo/store"); got != expected {
 		t.Fatalf("InstallPath()=%s; expected=%s", got, expected)
 	}
@@ -68,6 +85,37 @@ func TestPaths(t *testing.T) {
 	if got := p.DownloadPath(); !strings.HasSuffix(got, "krew-downloads") {
 		t.Fatalf("DownloadPath()=%s; expected suffix 'krew-downloads'", got)
 	}
+	if got, expected := p.BinPrefix(), "kubectl-"; got != expected {
+		t.Fatalf("BinPrefix()=%s; expected=%s", got, expected)
+	}
+}
+
+func TestPaths_WithBinPath(t *testing.T) {
+	p := newPaths(filepath.FromSlash("/foo"))
+	custom := p.WithBinPath(filepath.FromSlash("/project/bin"))
+	if got, expected := custom.BinPath(), filepath.FromSlash("/project/bin"); got != expected {
+		t.Fatalf("BinPath()=%s; expected=%s", got, expected)
+	}
+	if got, expected := custom.InstallPath(), p.InstallPath(); got != expected {
+		t.Fatalf("InstallPath()=%s; expected=%s", got, expected)
+	}
+	if got, expected := p.BinPath(), filepath.FromSlash("/foo/bin"); got != expected {
+		t.Fatalf("original BinPath()=%s; expected=%s", got, expected)
+	}
+}
+
+func TestPaths_WithBinPrefix(t *testing.T) {
+	p := newPaths(filepath.FromSlash("/foo"))
+	custom := p.WithBinPrefix("oc-")
+	if got, expected := custom.BinPrefix(), "oc-"; got != expected {
+		t.Fatalf("BinPrefix()=%s; expected=%s", got, expected)
+	}
+	if got, expected := custom.BinPath(), p.BinPath(); got != expected {
+		t.Fatalf("BinPath()=%s; expected=%s", got, expected)
+	}
+	if got, expected := p.BinPrefix(), "kubectl-"; got != expected {
+		t.Fatalf("original BinPrefix()=%s; expected=%s", got, expected)
+	}
 }
 
 func TestGetExecutedVersion(t *testing.T) {
@@ -177,7 +225,7 @@ func TestRealpath(t *testing.T) {
 		{"regular file", filepath.Join(tmp, "regular-file"), filepath.Join(tmp, "regular-file"), false},
 		{"directory unclean", filepath.Join(tmp, "foo", ".."), tmp, false},
 		{"regular file unclean", filepath.Join(tmp, "regular-file", "foo", ".."), filepath.Join(tmp, "regular-file"), false},
-		{"relative symbolic link", filepath.Join(tmp, "symbolic-link-rel"), "", true},
+		{"relative symbolic link", filepath.Join(tmp, "symbolic-link-rel"), filepath.Join(tmp, "another-file"), false},
 		{"absolute symbolic link", filepath.Join(tmp, "symbolic-link-abs"), orig, false},
 	}
 	for _, tt := range tests {
@@ -0,0 +1,146 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"fmt"
+	"strings"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// Change is a difference between two versions of a plugin manifest.
+type Change struct {
+	// Platform is the selector of the changed platform, or empty for a change
+	// of the plugin spec.
+	Platform string
+	// Field is the changed field, or "platform" if the platform was added
+	// (Old is empty) or removed (New is empty).
+	Field    string
+	Old, New string
+	// Suspicious is set for changes that are unlikely to be intended, e.g. a
+	// checksum that changed for the same URI.
+	Suspicious bool
+}
+
+func (c Change) String() string {
+	s := fmt.Sprintf("%s: %q -> %q", c.Field, c.Old, c.New)
+	if c.Platform != "" {
+		s = fmt.Sprintf("platform (%s) %s", c.Platform, s)
+	}
+	if c.Suspicious {
+		s += " (suspicious)"
+	}
+	return s
+}
+
+// DiffPlugins reports the changes from the old to the new manifest of a plugin.
+// Platforms are matched by their selector, so a platform with a changed
+// selector is reported as removed and added.
+func DiffPlugins(old, new Plugin) []Change {
+	var changes []Change
+	add := func(platform, field, o, n string) {
+		if o != n {
+			changes = append(changes, Change{Platform: platform, Field: field, Old: o, New: n})
+		}
+	}
+	add("", "version", old.Spec.Version, new.Spec.Version)
+	add("", "shortDescription", old.Spec.ShortDescription, new.Spec.ShortDescription)
+	add("", "description", old.Spec.Description, new.Spec.Description)
+	add("", "caveats", old.Spec.Caveats, new.Spec.Caveats)
+	add("", "aliases", strings.Join(old.Spec.Aliases, ", "), strings.Join(new.Spec.Aliases, ", "))
+	add("", "minKrewVersion", old.Spec.MinKrewVersion, new.Spec.MinKrewVersion)
+	add("", "requires", strings.Join(old.Spec.Requires, ", "), strings.Join(new.Spec.Requires, ", "))
+
+	matched := make([]bool, len(old.Spec.Platforms))
+	for _, np := range new.Spec.Platforms {
+		sel := metav1.FormatLabelSelector(np.Selector)
+		i := matchingPlatform(old.Spec.Platforms, matched, sel)
+		if i < 0 {
+			add(sel, "platform", "", sel)
+			continue
+		}
+		matched[i] = true
+		op := old.Spec.Platforms[i]
+
+		add(sel, "head", op.Head, np.Head)
+		add(sel, "uri", op.URI, np.URI)
+		before := len(changes)
+		add(sel, "sha256", op.Sha256, np.Sha256)
+		if len(changes) > before && op.URI == np.URI && op.Sha256 != "" {
+			changes[before].Suspicious = true
+		}
+		before = len(changes)
+		add(sel, "integrity", op.Integrity, np.Integrity)
+		if len(changes) > before && op.URI == np.URI && op.Integrity != "" {
+			changes[before].Suspicious = true
+		}
+		add(sel, "checksums", formatChecksumsFile(op.Checksums), formatChecksumsFile(np.Checksums))
+		add(sel, "size", formatSize(op.Size), formatSize(np.Size))
+		add(sel, "timeout", op.Timeout, np.Timeout)
+		add(sel, "files", formatFileOperations(op.Files), formatFileOperations(np.Files))
+		add(sel, "bin", op.Bin, np.Bin)
+		add(sel, "bins", formatExtraBins(op.Bins), formatExtraBins(np.Bins))
+		add(sel, "nestedArchives", strings.Join(op.NestedArchives, ", "), strings.Join(np.NestedArchives, ", "))
+	}
+	for i, op := range old.Spec.Platforms {
+		if !matched[i] {
+			sel := metav1.FormatLabelSelector(op.Selector)
+			add(sel, "platform", sel, "")
+		}
+	}
+	return changes
+}
+
+// matchingPlatform returns the index of the first platform with the selector
+// that is not matched yet, or -1.
+func matchingPlatform(platforms []Platform, matched []bool, selector string) int {
+	for i, p := range platforms {
+		if !matched[i] && metav1.FormatLabelSelector(p.Selector) == selector {
+			return i
+		}
+	}
+	return -1
+}
+
+func formatChecksumsFile(c *ChecksumsFile) string {
+	if c == nil {
+		return ""
+	}
+	return fmt.Sprintf("uri=%s filename=%s", c.URI, c.Filename)
+}
+
+func formatSize(size int64) string {
+	if size == 0 {
+		return ""
+	}
+	return fmt.Sprintf("%d", size)
+}
+
+func formatFileOperations(fos []FileOperation) string {
+	s := make([]string, len(fos))
+	for i, fo := range fos {
+		s[i] = fmt.Sprintf("from=%s to=%s", fo.From, fo.To)
+	}
+	return strings.Join(s, ", ")
+}
+
+func formatExtraBins(bins []ExtraBin) string {
+	s := make([]string, len(bins))
+	for i, b := range bins {
+		s[i] = fmt.Sprintf("%s=%s", b.Name, b.Path)
+	}
+	return strings.Join(s, ", ")
+}
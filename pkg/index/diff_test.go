@@ -0,0 +1,111 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package index
+
+import (
+	"reflect"
+	"testing"
+
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDiffPlugins(t *testing.T) {
+	platform := func(os, uri, sha256 string) Platform {
+		return Platform{
+			URI:      uri,
+			Sha256:   sha256,
+			Selector: &metav1.LabelSelector{MatchLabels: map[string]string{"os": os}},
+			Files:    []FileOperation{{From: "kubectl-foo", To: "."}},
+			Bin:      "kubectl-foo",
+		}
+	}
+	plugin := func(version string, platforms ...Platform) Plugin {
+		var p Plugin
+		p.Spec.Version = version
+		p.Spec.Platforms = platforms
+		return p
+	}
+
+	tests := []struct {
+		name     string
+		old, new Plugin
+		want     []Change
+	}{
+		{
+			name: "unchanged",
+			old:  plugin("v1", platform("linux", "https://example.com/v1.tar.gz", "aa")),
+			new:  plugin("v1", platform("linux", "https://example.com/v1.tar.gz", "aa")),
+			want: nil,
+		},
+		{
+			name: "new release",
+			old:  plugin("v1", platform("linux", "https://example.com/v1.tar.gz", "aa")),
+			new:  plugin("v2", platform("linux", "https://example.com/v2.tar.gz", "bb")),
+			want: []Change{
+				{Field: "version", Old: "v1", New: "v2"},
+				{Platform: "os=linux", Field: "uri", Old: "https://example.com/v1.tar.gz", New: "https://example.com/v2.tar.gz"},
+				{Platform: "os=linux", Field: "sha256", Old: "aa", New: "bb"},
+			},
+		},
+		{
+			name: "checksum changed for the same uri",
+			old:  plugin("v1", platform("linux", "https://example.com/v1.tar.gz", "aa")),
+			new:  plugin("v1", platform("linux", "https://example.com/v1.tar.gz", "bb")),
+			want: []Change{
+				{Platform: "os=linux", Field: "sha256", Old: "aa", New: "bb", Suspicious: true},
+			},
+		},
+		{
+			name: "platforms added and removed",
+			old:  plugin("v1", platform("linux", "https://example.com/v1.tar.gz", "aa")),
+			new:  plugin("v1", platform("darwin", "https://example.com/v1.tar.gz", "aa")),
+			want: []Change{
+				{Platform: "os=darwin", Field: "platform", New: "os=darwin"},
+				{Platform: "os=linux", Field: "platform", Old: "os=linux"},
+			},
+		},
+		{
+			name: "file operations changed",
+			old:  plugin("v1", platform("linux", "https://example.com/v1.tar.gz", "aa")),
+			new: func() Plugin {
+				p := plugin("v1", platform("linux", "https://example.com/v1.tar.gz", "aa"))
+				p.Spec.Platforms[0].Files = []FileOperation{{From: "*", To: "."}}
+				return p
+			}(),
+			want: []Change{
+				{Platform: "os=linux", Field: "files", Old: "from=kubectl-foo to=.", New: "from=* to=."},
+			},
+		},
+		{
+			name: "size added",
+			old:  plugin("v1", platform("linux", "https://example.com/v1.tar.gz", "aa")),
+			new: func() Plugin {
+				p := plugin("v1", platform("linux", "https://example.com/v1.tar.gz", "aa"))
+				p.Spec.Platforms[0].Size = 1024
+				return p
+			}(),
+			want: []Change{
+				{Platform: "os=linux", Field: "size", New: "1024"},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := DiffPlugins(tt.old, tt.new); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DiffPlugins() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -34,15 +34,52 @@ type PluginSpec struct {
 	Description      string `json:"description,omitempty"`
 	Caveats          string `json:"caveats,omitempty"`
 
+	// Aliases are additional names the plugin is linked under, e.g. to keep
+	// the old command of a renamed plugin working.
+	Aliases []string `json:"aliases,omitempty"`
+
+	// Requires lists the names of plugins that have to be installed before
+	// the plugin can be installed.
+	Requires []string `json:"requires,omitempty"`
+
+	// MinKrewVersion is the oldest version of krew, e.g. "v0.3.0", that
+	// understands the manifest, for manifests that use newer fields.
+	MinKrewVersion string `json:"minKrewVersion,omitempty"`
+
 	Platforms []Platform `json:"platforms,omitempty"`
 }
 
 // Platform TODO(lbb)
 type Platform struct {
-	Head   string `json:"head,omitempty"`
-	URI    string `json:"uri,omitempty"`
+	// Head and URI point to a .zip or .tar.gz archive. If the download is
+	// not an archive, it is saved as an executable named after the last
+	// element of the URL, which the Files can then move to Bin.
+	Head string `json:"head,omitempty"`
+	URI  string `json:"uri,omitempty"`
+
+	// Sha256 is the checksum of the file at URI. It can be prefixed with the
+	// hash algorithm (e.g. "sha512:<hex>"), otherwise sha256 is assumed.
+	// Base64 digests are accepted in subresource integrity style (e.g.
+	// "sha256-<base64>").
 	Sha256 string `json:"sha256,omitempty"`
 
+	// Integrity can be set instead of Sha256 to verify the file at URI with
+	// a subresource integrity string, e.g. "sha384-<base64>". If it lists
+	// several space-separated digests, any of them has to match.
+	Integrity string `json:"integrity,omitempty"`
+
+	// Size is the size in bytes of the file at URI, if known. Downloads are
+	// aborted as soon as they exceed it.
+	Size int64 `json:"size,omitempty"`
+
+	// Checksums can be set instead of Sha256 to look up the checksum of the
+	// file at URI in a checksums file shared by all assets of a release.
+	Checksums *ChecksumsFile `json:"checksums,omitempty"`
+
+	// Timeout optionally overrides the default download timeout for large
+	// (or small) archives, as a duration such as "5m".
+	Timeout string `json:"timeout,omitempty"`
+
 	Selector *metav1.LabelSelector `json:"selector,omitempty"`
 	Files    []FileOperation       `json:"files"`
 
@@ -50,12 +87,52 @@ type Platform struct {
 	// The path is relative to the root of the installation folder.
 	// The binary will be linked after all FileOperations are executed.
 	Bin string `json:"bin"`
+
+	// Bins optionally specifies more executables of the plugin to link,
+	// e.g. helper commands shipped in the same archive.
+	Bins []ExtraBin `json:"bins,omitempty"`
+
+	// PostInstall optionally specifies an executable in the installation
+	// folder to run after the files are installed, e.g. to generate shell
+	// completions. It only runs if the user enabled post-install scripts, with
+	// the privileges of the user.
+	PostInstall string `json:"postInstall,omitempty"`
+
+	// NestedArchives optionally specifies archives inside the download, as
+	// paths relative to its root, that are extracted in place before the
+	// FileOperations are executed, e.g. a .tar.gz wrapped in a .zip.
+	NestedArchives []string `json:"nestedArchives,omitempty"`
+}
+
+// ExtraBin is an executable of the plugin that is linked under its own
+// command name next to the plugin.
+type ExtraBin struct {
+	// Name is the command name, which is linked like a plugin name.
+	Name string `json:"name"`
+	// Path is the path to the executable relative to the root of the
+	// installation folder, like Bin.
+	Path string `json:"path"`
+}
+
+// ChecksumsFile is a file with "<hex>  <filename>" lines, as written by
+// sha256sum.
+type ChecksumsFile struct {
+	URI string `json:"uri"`
+	// Filename is the name of the asset in the checksums file. It defaults
+	// to the last element of the platform URI.
+	Filename string `json:"filename,omitempty"`
 }
 
-// FileOperation TODO(lbb)
+// FileOperation specifies a file or a glob pattern in the downloaded archive
+// to move into the installation directory.
+//
+// If From is a single file, it is renamed to To (unless To is "."). Otherwise
+// the files matched by the glob pattern are moved into the directory To, or,
+// with Rename, the single file it must match is renamed to To.
 type FileOperation struct {
-	From string `json:"from,omitempty"`
-	To   string `json:"to,omitempty"`
+	From   string `json:"from,omitempty"`
+	To     string `json:"to,omitempty"`
+	Rename bool   `json:"rename,omitempty"`
 }
 
 // PluginList TODO(lbb)
@@ -15,10 +15,16 @@
 package index
 
 import (
+	"path"
 	"regexp"
 	"strings"
+	"time"
 
 	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+	"k8s.io/apimachinery/pkg/labels"
+
+	"github.com/GoogleContainerTools/krew/pkg/version"
 )
 
 const (
@@ -32,6 +38,15 @@ var (
 	windowsForbidden = []string{"CON", "PRN", "AUX", "NUL", "COM1", "COM2",
 		"COM3", "COM4", "COM5", "COM6", "COM7", "COM8", "COM9", "LPT1", "LPT2",
 		"LPT3", "LPT4", "LPT5", "LPT6", "LPT7", "LPT8", "LPT9"}
+
+	// knownOSArches are the os/arch combinations used to detect platforms with
+	// ambiguous selectors.
+	knownOSArches = []struct{ os, arch string }{
+		{"darwin", "386"}, {"darwin", "amd64"}, {"darwin", "arm64"},
+		{"linux", "386"}, {"linux", "amd64"}, {"linux", "arm"}, {"linux", "arm64"},
+		{"linux", "ppc64le"}, {"linux", "s390x"},
+		{"windows", "386"}, {"windows", "amd64"}, {"windows", "arm64"},
+	}
 )
 
 // IsSafePluginName checks if the plugin Name is save to use.
@@ -47,6 +62,27 @@ func IsSafePluginName(name string) bool {
 	return true
 }
 
+// isSafeRelativePath checks that the slash separated path is clean, relative
+// and does not leave its base directory.
+func isSafeRelativePath(p string) bool {
+	return CheckRelativePath(p) == nil
+}
+
+// CheckRelativePath returns an error that says why the slash separated path is
+// not clean, relative or leaves its base directory.
+func CheckRelativePath(p string) error {
+	if path.IsAbs(p) {
+		return errors.New("path must be relative")
+	}
+	if path.Clean(p) != p {
+		return errors.Errorf("path is not clean, should be %q", path.Clean(p))
+	}
+	if p == ".." || strings.HasPrefix(p, "../") {
+		return errors.New("path must not leave the plugin directory")
+	}
+	return nil
+}
+
 func isSupportedAPIVersion(apiVersion string) bool {
 	return apiVersion == currentAPIVersion
 }
@@ -69,17 +105,166 @@ func (p Plugin) Validate(name string) error {
 	if len(p.Spec.Platforms) == 0 {
 		return errors.New("should have a platform specified")
 	}
+	if err := ValidateAliases(name, p.Spec.Aliases); err != nil {
+		return err
+	}
+	if err := ValidateRequires(name, p.Spec.Requires); err != nil {
+		return err
+	}
+	if p.Spec.MinKrewVersion != "" {
+		if _, err := version.ParseRelease(p.Spec.MinKrewVersion); err != nil {
+			return errors.Wrap(err, "invalid minKrewVersion")
+		}
+	}
 	for _, pl := range p.Spec.Platforms {
 		if err := pl.Validate(); err != nil {
 			return errors.Wrapf(err, "platform (%+v) is badly constructed", pl)
 		}
+		if err := validateExtraBinNames(name, p.Spec.Aliases, pl.Bins); err != nil {
+			return errors.Wrapf(err, "platform (%+v) is badly constructed", pl)
+		}
+	}
+	return ValidateUniquePlatforms(p.Spec.Platforms)
+}
+
+// ValidateAliases checks that the aliases of the plugin are safe plugin names
+// that differ from the plugin name and from each other.
+func ValidateAliases(name string, aliases []string) error {
+	seen := map[string]bool{name: true}
+	for _, alias := range aliases {
+		if !IsSafePluginName(alias) {
+			return errors.Errorf("the alias %q is not allowed, must match %q", alias, safePluginRegexp.String())
+		}
+		if seen[alias] {
+			return errors.Errorf("alias %q is declared more than once or equals the plugin name", alias)
+		}
+		seen[alias] = true
+	}
+	return nil
+}
+
+// CheckKrewVersion returns an error if the plugin requires a newer version of
+// krew than the running one, see version.AtLeast. Running versions that are
+// not releases, e.g. of development builds, are not checked.
+func (p Plugin) CheckKrewVersion(running string) error {
+	if p.Spec.MinKrewVersion == "" {
+		return nil
+	}
+	if _, err := version.ParseRelease(p.Spec.MinKrewVersion); err != nil {
+		return errors.Wrap(err, "invalid minKrewVersion")
+	}
+	ok, err := version.AtLeast(running, p.Spec.MinKrewVersion)
+	if err != nil {
+		return nil
+	}
+	if !ok {
+		return errors.Errorf("this plugin requires krew >= %s, but this is krew %s", p.Spec.MinKrewVersion, running)
+	}
+	return nil
+}
+
+// ValidateRequires checks that the required plugins are safe plugin names that
+// differ from the plugin name and from each other.
+func ValidateRequires(name string, requires []string) error {
+	seen := map[string]bool{}
+	for _, req := range requires {
+		if !IsSafePluginName(req) {
+			return errors.Errorf("the required plugin %q is not allowed, must match %q", req, safePluginRegexp.String())
+		}
+		if req == name {
+			return errors.Errorf("plugin %q requires itself", name)
+		}
+		if seen[req] {
+			return errors.Errorf("required plugin %q is declared more than once", req)
+		}
+		seen[req] = true
+	}
+	return nil
+}
+
+// validateExtraBinNames checks that the extra bins are not linked under the
+// plugin name, one of its aliases or the name of another extra bin.
+func validateExtraBinNames(name string, aliases []string, bins []ExtraBin) error {
+	seen := map[string]bool{name: true}
+	for _, alias := range aliases {
+		seen[alias] = true
+	}
+	for _, b := range bins {
+		if seen[b.Name] {
+			return errors.Errorf("bin name %q is already used by the plugin, an alias or another bin", b.Name)
+		}
+		seen[b.Name] = true
+	}
+	return nil
+}
+
+// ValidateUniquePlatforms checks that no os/arch combination is matched by
+// more than one platform. Installation picks the first matching platform, so
+// overlapping selectors are most likely a mistake in the manifest.
+func ValidateUniquePlatforms(platforms []Platform) error {
+	selectors := make([]labels.Selector, len(platforms))
+	for i, pl := range platforms {
+		sel, err := metav1.LabelSelectorAsSelector(pl.Selector)
+		if err != nil {
+			return errors.Wrapf(err, "failed to compile label selector of platform (%d)", i)
+		}
+		selectors[i] = sel
+	}
+	for _, env := range knownOSArches {
+		envLabels := labels.Set{"os": env.os, "arch": env.arch}
+		matched := -1
+		for i, sel := range selectors {
+			if !sel.Matches(envLabels) {
+				continue
+			}
+			if matched >= 0 {
+				return errors.Errorf("platforms (%d) and (%d) both match os=%s arch=%s, selectors must not overlap", matched, i, env.os, env.arch)
+			}
+			matched = i
+		}
+	}
+	return nil
+}
+
+// ValidateSelector checks that the selector compiles and only selects the "os"
+// and "arch" labels of the system. Requirements on other labels never match,
+// or with NotIn and DoesNotExist always match, which is not intended.
+func ValidateSelector(sel *metav1.LabelSelector) error {
+	if _, err := metav1.LabelSelectorAsSelector(sel); err != nil {
+		return err
+	}
+	if sel == nil {
+		return nil
+	}
+	var keys []string
+	for k := range sel.MatchLabels {
+		keys = append(keys, k)
+	}
+	for _, req := range sel.MatchExpressions {
+		keys = append(keys, req.Key)
+	}
+	for _, k := range keys {
+		if k != "os" && k != "arch" {
+			return errors.Errorf("unknown label %q, only os and arch can be selected", k)
+		}
 	}
 	return nil
 }
 
 // Validate TODO(lbb)
 func (p Platform) Validate() error {
-	if (p.Sha256 != "") != (p.URI != "") {
+	if p.Integrity != "" {
+		if p.URI == "" || p.Sha256 != "" || p.Checksums != nil {
+			return errors.New("integrity can only be set with URI and without sha or checksums file")
+		}
+	} else if p.Checksums != nil {
+		if p.URI == "" || p.Sha256 != "" {
+			return errors.New("checksums file can only be set with URI and without sha")
+		}
+		if p.Checksums.URI == "" {
+			return errors.New("checksums file has to have an URI")
+		}
+	} else if (p.Sha256 != "") != (p.URI != "") {
 		return errors.New("can't get version URI and sha have both to be set or unset")
 	}
 	if p.Head == "" && p.URI == "" {
@@ -88,8 +273,43 @@ func (p Platform) Validate() error {
 	if p.Bin == "" {
 		return errors.New("bin has to be set")
 	}
+	for _, b := range p.Bins {
+		if !IsSafePluginName(b.Name) {
+			return errors.Errorf("the bin name %q is not allowed, must match %q", b.Name, safePluginRegexp.String())
+		}
+		if b.Path == "" {
+			return errors.Errorf("bin %q has to have a path", b.Name)
+		}
+		if err := CheckRelativePath(b.Path); err != nil {
+			return errors.Wrapf(err, "bin %q path %q", b.Name, b.Path)
+		}
+	}
+	if p.PostInstall != "" && !isSafeRelativePath(p.PostInstall) {
+		return errors.Errorf("post-install script %q has to be a clean path relative to the installation folder", p.PostInstall)
+	}
+	for _, a := range p.NestedArchives {
+		if !isSafeRelativePath(a) {
+			return errors.Errorf("nested archive %q has to be a clean path relative to the root of the download", a)
+		}
+	}
+	if err := ValidateSelector(p.Selector); err != nil {
+		return errors.Wrap(err, "invalid selector")
+	}
 	if len(p.Files) == 0 {
 		return errors.New("can't have a plugin without specifying file operations")
 	}
+	if p.Timeout != "" {
+		if d, err := time.ParseDuration(p.Timeout); err != nil {
+			return errors.Wrapf(err, "invalid download timeout %q", p.Timeout)
+		} else if d <= 0 {
+			return errors.Errorf("download timeout %q has to be positive", p.Timeout)
+		}
+	}
+	if p.Size < 0 {
+		return errors.Errorf("size %d can't be negative", p.Size)
+	}
+	if p.Size > 0 && p.URI == "" {
+		return errors.New("size can only be set with URI")
+	}
 	return nil
 }
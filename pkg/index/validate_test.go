@@ -117,7 +117,7 @@ func TestPlugin_Validate(t *testing.T) {
 						URI:      "",
 						Sha256:   "",
 						Selector: nil,
-						Files:    []FileOperation{{"", ""}},
+						Files:    []FileOperation{{From: "", To: ""}},
 						Bin:      "foo",
 					}},
 				},
@@ -140,7 +140,7 @@ func TestPlugin_Validate(t *testing.T) {
 						URI:      "",
 						Sha256:   "",
 						Selector: nil,
-						Files:    []FileOperation{{"", ""}},
+						Files:    []FileOperation{{From: "", To: ""}},
 						Bin:      "foo",
 					}},
 				},
@@ -163,7 +163,7 @@ func TestPlugin_Validate(t *testing.T) {
 						URI:      "",
 						Sha256:   "",
 						Selector: nil,
-						Files:    []FileOperation{{"", ""}},
+						Files:    []FileOperation{{From: "", To: ""}},
 						Bin:      "foo",
 					}},
 				},
@@ -209,7 +209,7 @@ func TestPlugin_Validate(t *testing.T) {
 						URI:      "",
 						Sha256:   "",
 						Selector: nil,
-						Files:    []FileOperation{{"", ""}},
+						Files:    []FileOperation{{From: "", To: ""}},
 						Bin:      "foo",
 					}},
 				},
@@ -232,7 +232,7 @@ func TestPlugin_Validate(t *testing.T) {
 						URI:      "",
 						Sha256:   "",
 						Selector: nil,
-						Files:    []FileOperation{{"", ""}},
+						Files:    []FileOperation{{From: "", To: ""}},
 						Bin:      "foo",
 					}},
 				},
@@ -240,6 +240,25 @@ func TestPlugin_Validate(t *testing.T) {
 			pluginName: "../foo",
 			wantErr:    true,
 		},
+		{
+			name: "bin named like an alias",
+			fields: fields{
+				TypeMeta:   metav1.TypeMeta{APIVersion: currentAPIVersion},
+				ObjectMeta: metav1.ObjectMeta{Name: "foo"},
+				Spec: PluginSpec{
+					ShortDescription: "short",
+					Aliases:          []string{"foo-helper"},
+					Platforms: []Platform{{
+						Head:  "http://example.com",
+						Files: []FileOperation{{From: "", To: ""}},
+						Bin:   "foo",
+						Bins:  []ExtraBin{{Name: "foo-helper", Path: "helper"}},
+					}},
+				},
+			},
+			pluginName: "foo",
+			wantErr:    true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
@@ -255,20 +274,284 @@ func TestPlugin_Validate(t *testing.T) {
 	}
 }
 
+func TestValidateAliases(t *testing.T) {
+	tests := []struct {
+		name    string
+		aliases []string
+		wantErr bool
+	}{
+		{"no aliases", nil, false},
+		{"distinct aliases", []string{"old-name", "short"}, false},
+		{"unsafe alias", []string{"../foo"}, true},
+		{"alias equals plugin name", []string{"foo"}, true},
+		{"duplicate alias", []string{"bar", "bar"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateAliases("foo", tt.aliases); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateAliases(%v) error = %v, wantErr %v", tt.aliases, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestPlugin_CheckKrewVersion(t *testing.T) {
+	tests := []struct {
+		name    string
+		min     string
+		running string
+		wantErr bool
+	}{
+		{"no minimum", "", "v0.1.0", false},
+		{"newer krew", "v0.2.0", "v0.10.0", false},
+		{"same krew", "v0.2.0", "v0.2.0", false},
+		{"older krew", "v0.2.0", "v0.1.9-2-gabcdef", true},
+		{"development build", "v0.2.0", "unknown", false},
+		{"invalid minimum", "latest", "v0.1.0", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var p Plugin
+			p.Spec.MinKrewVersion = tt.min
+			err := p.CheckKrewVersion(tt.running)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("CheckKrewVersion(%q) error = %v, wantErr %v", tt.running, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateRequires(t *testing.T) {
+	tests := []struct {
+		name     string
+		requires []string
+		wantErr  bool
+	}{
+		{"no requires", nil, false},
+		{"distinct requires", []string{"bar", "baz"}, false},
+		{"unsafe name", []string{"../bar"}, true},
+		{"requires itself", []string{"foo"}, true},
+		{"duplicate", []string{"bar", "bar"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateRequires("foo", tt.requires); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateRequires(%v) error = %v, wantErr %v", tt.requires, err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestValidateUniquePlatforms(t *testing.T) {
+	platform := func(matchLabels map[string]string) Platform {
+		return Platform{Selector: &metav1.LabelSelector{MatchLabels: matchLabels}}
+	}
+	tests := []struct {
+		name      string
+		platforms []Platform
+		wantErr   bool
+	}{
+		{
+			name: "distinct os",
+			platforms: []Platform{
+				platform(map[string]string{"os": "linux"}),
+				platform(map[string]string{"os": "darwin"}),
+			},
+			wantErr: false,
+		},
+		{
+			name: "distinct arch",
+			platforms: []Platform{
+				platform(map[string]string{"os": "linux", "arch": "amd64"}),
+				platform(map[string]string{"os": "linux", "arch": "arm64"}),
+			},
+			wantErr: false,
+		},
+		{
+			name: "same selector twice",
+			platforms: []Platform{
+				platform(map[string]string{"os": "linux"}),
+				platform(map[string]string{"os": "linux"}),
+			},
+			wantErr: true,
+		},
+		{
+			name: "overlapping selectors",
+			platforms: []Platform{
+				platform(map[string]string{"os": "linux"}),
+				platform(map[string]string{"os": "linux", "arch": "amd64"}),
+			},
+			wantErr: true,
+		},
+		{
+			name: "catch-all selector overlaps",
+			platforms: []Platform{
+				platform(map[string]string{"os": "windows"}),
+				{Selector: &metav1.LabelSelector{}},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := ValidateUniquePlatforms(tt.platforms); (err != nil) != tt.wantErr {
+				t.Errorf("ValidateUniquePlatforms() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
 func TestPlatform_Validate(t *testing.T) {
 	type fields struct {
-		Head     string
-		URI      string
-		Sha256   string
-		Selector *metav1.LabelSelector
-		Files    []FileOperation
-		Bin      string
+		Head           string
+		URI            string
+		Sha256         string
+		Integrity      string
+		Timeout        string
+		Size           int64
+		Checksums      *ChecksumsFile
+		Selector       *metav1.LabelSelector
+		Files          []FileOperation
+		Bin            string
+		Bins           []ExtraBin
+		PostInstall    string
+		NestedArchives []string
 	}
 	tests := []struct {
 		name    string
 		fields  fields
 		wantErr bool
 	}{
+		{
+			name: "match expressions",
+			fields: fields{
+				Head: "http://example.com",
+				Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "os", Operator: metav1.LabelSelectorOpIn, Values: []string{"linux", "darwin"}},
+					{Key: "arch", Operator: metav1.LabelSelectorOpExists},
+				}},
+				Files: []FileOperation{{From: "", To: ""}},
+				Bin:   "foo",
+			},
+			wantErr: false,
+		},
+		{
+			name: "match expression without values",
+			fields: fields{
+				Head: "http://example.com",
+				Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "os", Operator: metav1.LabelSelectorOpIn},
+				}},
+				Files: []FileOperation{{From: "", To: ""}},
+				Bin:   "foo",
+			},
+			wantErr: true,
+		},
+		{
+			name: "unknown selector label",
+			fields: fields{
+				Head: "http://example.com",
+				Selector: &metav1.LabelSelector{MatchExpressions: []metav1.LabelSelectorRequirement{
+					{Key: "distro", Operator: metav1.LabelSelectorOpNotIn, Values: []string{"alpine"}},
+				}},
+				Files: []FileOperation{{From: "", To: ""}},
+				Bin:   "foo",
+			},
+			wantErr: true,
+		},
+		{
+			name: "checksums file",
+			fields: fields{
+				URI:       "http://example.com/foo.tar.gz",
+				Checksums: &ChecksumsFile{URI: "http://example.com/checksums.txt"},
+				Files:     []FileOperation{{From: "", To: ""}},
+				Bin:       "foo",
+			},
+			wantErr: false,
+		},
+		{
+			name: "checksums file and hash",
+			fields: fields{
+				URI:       "http://example.com/foo.tar.gz",
+				Sha256:    "deadbeef",
+				Checksums: &ChecksumsFile{URI: "http://example.com/checksums.txt"},
+				Files:     []FileOperation{{From: "", To: ""}},
+				Bin:       "foo",
+			},
+			wantErr: true,
+		},
+		{
+			name: "checksums file without uri",
+			fields: fields{
+				URI:       "http://example.com/foo.tar.gz",
+				Checksums: &ChecksumsFile{Filename: "foo.tar.gz"},
+				Files:     []FileOperation{{From: "", To: ""}},
+				Bin:       "foo",
+			},
+			wantErr: true,
+		},
+		{
+			name: "download timeout",
+			fields: fields{
+				Head:    "http://example.com",
+				Timeout: "5m",
+				Files:   []FileOperation{{From: "", To: ""}},
+				Bin:     "foo",
+			},
+			wantErr: false,
+		},
+		{
+			name: "invalid download timeout",
+			fields: fields{
+				Head:    "http://example.com",
+				Timeout: "5 minutes",
+				Files:   []FileOperation{{From: "", To: ""}},
+				Bin:     "foo",
+			},
+			wantErr: true,
+		},
+		{
+			name: "negative download timeout",
+			fields: fields{
+				Head:    "http://example.com",
+				Timeout: "-1s",
+				Files:   []FileOperation{{From: "", To: ""}},
+				Bin:     "foo",
+			},
+			wantErr: true,
+		},
+		{
+			name: "download size",
+			fields: fields{
+				URI:    "http://example.com/foo.tar.gz",
+				Sha256: "deadbeef",
+				Size:   1024,
+				Files:  []FileOperation{{From: "", To: ""}},
+				Bin:    "foo",
+			},
+			wantErr: false,
+		},
+		{
+			name: "negative download size",
+			fields: fields{
+				URI:    "http://example.com/foo.tar.gz",
+				Sha256: "deadbeef",
+				Size:   -1,
+				Files:  []FileOperation{{From: "", To: ""}},
+				Bin:    "foo",
+			},
+			wantErr: true,
+		},
+		{
+			name: "download size without URI",
+			fields: fields{
+				Head:  "http://example.com",
+				Size:  1024,
+				Files: []FileOperation{{From: "", To: ""}},
+				Bin:   "foo",
+			},
+			wantErr: true,
+		},
 		{
 			name: "no error validation",
 			fields: fields{
@@ -276,7 +559,7 @@ func TestPlatform_Validate(t *testing.T) {
 				URI:      "",
 				Sha256:   "",
 				Selector: nil,
-				Files:    []FileOperation{{"", ""}},
+				Files:    []FileOperation{{From: "", To: ""}},
 				Bin:      "foo",
 			},
 			wantErr: false,
@@ -288,7 +571,7 @@ func TestPlatform_Validate(t *testing.T) {
 				URI:      "",
 				Sha256:   "",
 				Selector: nil,
-				Files:    []FileOperation{{"", ""}},
+				Files:    []FileOperation{{From: "", To: ""}},
 				Bin:      "foo",
 			},
 			wantErr: true,
@@ -300,7 +583,7 @@ func TestPlatform_Validate(t *testing.T) {
 				URI:      "",
 				Sha256:   "deadbeef",
 				Selector: nil,
-				Files:    []FileOperation{{"", ""}},
+				Files:    []FileOperation{{From: "", To: ""}},
 				Bin:      "foo",
 			},
 			wantErr: true,
@@ -312,7 +595,7 @@ func TestPlatform_Validate(t *testing.T) {
 				URI:      "http://example.com",
 				Sha256:   "",
 				Selector: nil,
-				Files:    []FileOperation{{"", ""}},
+				Files:    []FileOperation{{From: "", To: ""}},
 				Bin:      "foo",
 			},
 			wantErr: true,
@@ -336,21 +619,149 @@ func TestPlatform_Validate(t *testing.T) {
 				URI:      "",
 				Sha256:   "",
 				Selector: nil,
-				Files:    []FileOperation{{"", ""}},
+				Files:    []FileOperation{{From: "", To: ""}},
 				Bin:      "",
 			},
 			wantErr: true,
 		},
+		{
+			name: "extra bins",
+			fields: fields{
+				Head:  "http://example.com",
+				Files: []FileOperation{{From: "", To: ""}},
+				Bin:   "foo",
+				Bins:  []ExtraBin{{Name: "foo-helper", Path: "helper"}},
+			},
+			wantErr: false,
+		},
+		{
+			name: "extra bin with unsafe name",
+			fields: fields{
+				Head:  "http://example.com",
+				Files: []FileOperation{{From: "", To: ""}},
+				Bin:   "foo",
+				Bins:  []ExtraBin{{Name: "../helper", Path: "helper"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "post-install script",
+			fields: fields{
+				Head:        "http://example.com",
+				Files:       []FileOperation{{From: "", To: ""}},
+				Bin:         "foo",
+				PostInstall: "scripts/setup.sh",
+			},
+			wantErr: false,
+		},
+		{
+			name: "post-install script outside of the installation",
+			fields: fields{
+				Head:        "http://example.com",
+				Files:       []FileOperation{{From: "", To: ""}},
+				Bin:         "foo",
+				PostInstall: "../setup.sh",
+			},
+			wantErr: true,
+		},
+		{
+			name: "absolute post-install script",
+			fields: fields{
+				Head:        "http://example.com",
+				Files:       []FileOperation{{From: "", To: ""}},
+				Bin:         "foo",
+				PostInstall: "/bin/sh",
+			},
+			wantErr: true,
+		},
+		{
+			name: "integrity",
+			fields: fields{
+				URI:       "http://example.com",
+				Integrity: "sha384-AAAA",
+				Files:     []FileOperation{{From: "", To: ""}},
+				Bin:       "foo",
+			},
+			wantErr: false,
+		},
+		{
+			name: "integrity and sha",
+			fields: fields{
+				URI:       "http://example.com",
+				Sha256:    "deadbeef",
+				Integrity: "sha384-AAAA",
+				Files:     []FileOperation{{From: "", To: ""}},
+				Bin:       "foo",
+			},
+			wantErr: true,
+		},
+		{
+			name: "nested archive",
+			fields: fields{
+				Head:           "http://example.com",
+				Files:          []FileOperation{{From: "", To: ""}},
+				Bin:            "foo",
+				NestedArchives: []string{"dist/foo.tar.gz"},
+			},
+			wantErr: false,
+		},
+		{
+			name: "nested archive outside of the download",
+			fields: fields{
+				Head:           "http://example.com",
+				Files:          []FileOperation{{From: "", To: ""}},
+				Bin:            "foo",
+				NestedArchives: []string{"../foo.tar.gz"},
+			},
+			wantErr: true,
+		},
+		{
+			name: "extra bin without path",
+			fields: fields{
+				Head:  "http://example.com",
+				Files: []FileOperation{{From: "", To: ""}},
+				Bin:   "foo",
+				Bins:  []ExtraBin{{Name: "foo-helper"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "extra bin path leaves the plugin directory",
+			fields: fields{
+				Head:  "http://example.com",
+				Files: []FileOperation{{From: "", To: ""}},
+				Bin:   "foo",
+				Bins:  []ExtraBin{{Name: "foo-helper", Path: "../helper"}},
+			},
+			wantErr: true,
+		},
+		{
+			name: "absolute extra bin path",
+			fields: fields{
+				Head:  "http://example.com",
+				Files: []FileOperation{{From: "", To: ""}},
+				Bin:   "foo",
+				Bins:  []ExtraBin{{Name: "foo-helper", Path: "/usr/bin/helper"}},
+			},
+			wantErr: true,
+		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
 			p := Platform{
-				Head:     tt.fields.Head,
-				URI:      tt.fields.URI,
-				Sha256:   tt.fields.Sha256,
-				Selector: tt.fields.Selector,
-				Files:    tt.fields.Files,
-				Bin:      tt.fields.Bin,
+				Head:           tt.fields.Head,
+				URI:            tt.fields.URI,
+				Sha256:         tt.fields.Sha256,
+				Integrity:      tt.fields.Integrity,
+				Timeout:        tt.fields.Timeout,
+				Size:           tt.fields.Size,
+				Checksums:      tt.fields.Checksums,
+				Selector:       tt.fields.Selector,
+				Files:          tt.fields.Files,
+				Bin:            tt.fields.Bin,
+				Bins:           tt.fields.Bins,
+				PostInstall:    tt.fields.PostInstall,
+				NestedArchives: tt.fields.NestedArchives,
 			}
 			if err := p.Validate(); (err != nil) != tt.wantErr {
 				t.Errorf("Platform.Validate() error = %v, wantErr %v", err, tt.wantErr)
@@ -0,0 +1,83 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/krew/pkg/environment"
+)
+
+// AuditPermissions walks the install directory of the plugin and reports the
+// files with dangerous modes, i.e. world-writable, setuid or setgid files, as
+// their path relative to the install directory followed by the problems.
+func AuditPermissions(p environment.Paths, name string) ([]string, error) {
+	root := p.PluginInstallPath(name)
+	if _, err := os.Stat(root); os.IsNotExist(err) {
+		return nil, ErrIsNotInstalled
+	}
+	var findings []string
+	err := filepath.Walk(root, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		problems := dangerousModeBits(info.Mode())
+		if len(problems) == 0 {
+			return nil
+		}
+		rel, err := filepath.Rel(root, path)
+		if err != nil {
+			return err
+		}
+		findings = append(findings, fmt.Sprintf("%s: %s", filepath.ToSlash(rel), strings.Join(problems, ", ")))
+		return nil
+	})
+	return findings, errors.Wrapf(err, "failed to audit plugin %q", name)
+}
+
+// dangerousModeBits describes the dangerous bits of the mode. Symlinks are
+// always world-writable and not reported.
+func dangerousModeBits(mode os.FileMode) []string {
+	if mode&os.ModeSymlink != 0 {
+		return nil
+	}
+	var problems []string
+	if mode.Perm()&0002 != 0 {
+		problems = append(problems, "world-writable")
+	}
+	if mode&os.ModeSetuid != 0 {
+		problems = append(problems, "setuid")
+	}
+	if mode&os.ModeSetgid != 0 {
+		problems = append(problems, "setgid")
+	}
+	return problems
+}
+
+// checkNotSetuid refuses to link an executable that runs as its owner or
+// group, since kubectl plugins never need to. A missing executable is reported
+// when it is linked.
+func checkNotSetuid(executable string) error {
+	fi, err := os.Stat(executable)
+	if err == nil && fi.Mode()&(os.ModeSetuid|os.ModeSetgid) != 0 {
+		return errorOfKind(ErrSetuidExecutable, "refusing to link setuid or setgid executable %q", executable)
+	}
+	return nil
+}
@@ -0,0 +1,75 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+)
+
+func TestAuditPermissions(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	if _, err := AuditPermissions(p, "foo"); err != ErrIsNotInstalled {
+		t.Fatalf("AuditPermissions() of a missing plugin error = %v, want %v", err, ErrIsNotInstalled)
+	}
+
+	installFake(t, p, "foo", []byte("foo"))
+	dir := p.PluginVersionInstallPath("foo", "v1")
+	if err := os.Symlink("foo", filepath.Join(dir, "link")); err != nil {
+		t.Fatal(err)
+	}
+	findings, err := AuditPermissions(p, "foo")
+	if err != nil || len(findings) != 0 {
+		t.Fatalf("AuditPermissions() = %v, %v, want no findings", findings, err)
+	}
+
+	// Chmod is not subject to the umask.
+	for path, mode := range map[string]os.FileMode{
+		filepath.Join(dir, "foo"): 0777 | os.ModeSetuid,
+		dir:                       0755 | os.ModeSetgid,
+	} {
+		if err := os.Chmod(path, mode); err != nil {
+			t.Fatal(err)
+		}
+	}
+	findings, err = AuditPermissions(p, "foo")
+	if err != nil {
+		t.Fatalf("AuditPermissions() error = %v", err)
+	}
+	want := []string{"v1: setgid", "v1/foo: world-writable, setuid"}
+	if !reflect.DeepEqual(findings, want) {
+		t.Errorf("AuditPermissions() = %q, want %q", findings, want)
+	}
+}
+
+func TestActivate_refusesSetuid(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	installFake(t, p, "foo", []byte("foo"))
+	dir := p.PluginVersionInstallPath("foo", "v1")
+	if err := os.Chmod(filepath.Join(dir, "foo"), 0755|os.ModeSetuid); err != nil {
+		t.Fatal(err)
+	}
+	err := activate(p, "foo", dir, index.Platform{Bin: "foo"}, nil, Options{})
+	if err == nil || !strings.Contains(err.Error(), "setuid") {
+		t.Fatalf("activate() error = %v, want it to refuse the setuid executable", err)
+	}
+}
@@ -0,0 +1,273 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/GoogleContainerTools/krew/pkg/environment"
+	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
+
+	"github.com/pkg/errors"
+)
+
+// ListIncompatible returns the names of the installed plugins whose executable
+// is built for another os/arch than the current system, e.g. after the krew
+// root was moved to another machine, so they can be reinstalled. Krew doesn't
+// record the platform a plugin was installed for, so it is detected from the
+// ELF, Mach-O or PE header of the executable. Executables in other formats,
+// like scripts, and the parts of the platform that can't be detected are
+// assumed to be compatible.
+func ListIncompatible(p environment.Paths) ([]string, error) {
+	goos, goarch := osArch()
+	var incompatible []string
+	err := WalkInstalled(p, func(name, _ string, _ bool) error {
+		link := filepath.Join(p.BinPath(), pluginNameToBin(p.BinPrefix(), name, isWindows()))
+		executable, err := filepath.EvalSymlinks(link)
+		if err != nil {
+			return errors.Wrapf(err, "failed to resolve the symlink of plugin %q", name)
+		}
+		bp, err := executablePlatform(executable)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the executable of plugin %q", name)
+		}
+		if bp.matches(goos, goarch) {
+			return nil
+		}
+		logging.V(2).Infof("Plugin %s is built for %s, not os=%s arch=%s", name, bp, goos, goarch)
+		incompatible = append(incompatible, name)
+		return nil
+	})
+	return incompatible, err
+}
+
+// binaryPlatform is the platform an executable is built for.
+type binaryPlatform struct {
+	// format is "ELF", "Mach-O" or "PE", or empty for other files, like
+	// scripts.
+	format string
+	// os is empty if it is not known, e.g. for an ELF binary without an OS
+	// ABI, which can run on any Unix but darwin.
+	os string
+	// arches are the architectures of the binary, of which universal Mach-O
+	// binaries have more than one. It is empty if any of them is not known.
+	arches []string
+}
+
+// matches reports whether the executable can run on goos/goarch. The unknown
+// parts of the platform are assumed to match.
+func (b binaryPlatform) matches(goos, goarch string) bool {
+	if b.format == "" {
+		return true
+	}
+	if b.os != "" && b.os != goos {
+		return false
+	}
+	if b.os == "" && b.format == "ELF" && (goos == "darwin" || goos == "windows") {
+		return false
+	}
+	return len(b.arches) == 0 || containsString(b.arches, goarch)
+}
+
+func (b binaryPlatform) String() string {
+	goos, arches := b.os, strings.Join(b.arches, ",")
+	if goos == "" {
+		goos = "unknown"
+	}
+	if arches == "" {
+		arches = "unknown"
+	}
+	return fmt.Sprintf("%s os=%s arch=%s", b.format, goos, arches)
+}
+
+var (
+	elfOSes = map[elf.OSABI]string{
+		elf.ELFOSABI_LINUX:   "linux",
+		elf.ELFOSABI_NETBSD:  "netbsd",
+		elf.ELFOSABI_FREEBSD: "freebsd",
+		elf.ELFOSABI_OPENBSD: "openbsd",
+		elf.ELFOSABI_SOLARIS: "solaris",
+	}
+	machoArches = map[macho.Cpu]string{
+		macho.Cpu386:   "386",
+		macho.CpuAmd64: "amd64",
+		macho.CpuArm:   "arm",
+		macho.CpuArm64: "arm64",
+	}
+	peArches = map[uint16]string{
+		pe.IMAGE_FILE_MACHINE_I386:  "386",
+		pe.IMAGE_FILE_MACHINE_AMD64: "amd64",
+		pe.IMAGE_FILE_MACHINE_ARMNT: "arm",
+		pe.IMAGE_FILE_MACHINE_ARM64: "arm64",
+	}
+)
+
+// maxFatArches is the largest architecture count of a universal Mach-O binary.
+// Java class files share its magic, but have the class file version at the
+// place of the count, which is larger.
+const maxFatArches = 30
+
+// elfArch returns the GOARCH of the ELF binary, or "" if it is not known.
+func elfArch(ef *elf.File) string {
+	little := ef.ByteOrder == binary.LittleEndian
+	is64 := ef.Class == elf.ELFCLASS64
+	switch ef.Machine {
+	case elf.EM_386:
+		return "386"
+	case elf.EM_X86_64:
+		return "amd64"
+	case elf.EM_ARM:
+		if little {
+			return "arm"
+		}
+	case elf.EM_AARCH64:
+		if little {
+			return "arm64"
+		}
+	case elf.EM_PPC64:
+		if little {
+			return "ppc64le"
+		}
+		return "ppc64"
+	case elf.EM_MIPS:
+		switch {
+		case is64 && little:
+			return "mips64le"
+		case is64:
+			return "mips64"
+		case little:
+			return "mipsle"
+		}
+		return "mips"
+	case elf.EM_RISCV:
+		if is64 {
+			return "riscv64"
+		}
+	case elf.EM_S390:
+		if is64 {
+			return "s390x"
+		}
+	}
+	return ""
+}
+
+// arches returns the list of the single arch, or nil if it is not known.
+func arches(arch string) []string {
+	if arch == "" {
+		return nil
+	}
+	return []string{arch}
+}
+
+// executablePlatform returns the platform the executable at path is built for,
+// detected from its ELF, Mach-O or PE header. The format is empty if the file
+// is not such a binary.
+func executablePlatform(path string) (binaryPlatform, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return binaryPlatform{}, err
+	}
+	defer f.Close()
+
+	head := make([]byte, 8)
+	n, err := io.ReadFull(f, head)
+	if err != nil && err != io.EOF && err != io.ErrUnexpectedEOF {
+		return binaryPlatform{}, err
+	}
+	head = head[:n]
+
+	switch {
+	case bytes.HasPrefix(head, []byte(elf.ELFMAG)):
+		ef, err := elf.NewFile(f)
+		if err != nil {
+			return binaryPlatform{}, nil
+		}
+		return binaryPlatform{format: "ELF", os: elfOSes[ef.OSABI], arches: arches(elfArch(ef))}, nil
+	case bytes.HasPrefix(head, []byte("MZ")):
+		pf, err := pe.NewFile(f)
+		if err != nil {
+			return binaryPlatform{}, nil
+		}
+		return binaryPlatform{format: "PE", os: "windows", arches: arches(peArches[pf.Machine])}, nil
+	case len(head) == 8 && binary.BigEndian.Uint32(head) == macho.MagicFat:
+		if count := binary.BigEndian.Uint32(head[4:]); count == 0 || count > maxFatArches {
+			return binaryPlatform{}, nil
+		}
+		ff, err := macho.NewFatFile(f)
+		if err != nil {
+			return binaryPlatform{}, nil
+		}
+		bp := binaryPlatform{format: "Mach-O", os: "darwin"}
+		for _, a := range ff.Arches {
+			arch := machoArches[a.Cpu]
+			if arch == "" {
+				bp.arches = nil
+				break
+			}
+			bp.arches = append(bp.arches, arch)
+		}
+		return bp, nil
+	}
+	if mf, err := macho.NewFile(f); err == nil {
+		return binaryPlatform{format: "Mach-O", os: "darwin", arches: arches(machoArches[mf.Cpu])}, nil
+	}
+	return binaryPlatform{}, nil
+}
+
+// checkExecutablesPlatform returns an error if the bin or an extra bin of the
+// platform, installed to dst, is a binary for another platform than
+// goos/goarch. Missing executables are not checked, linking them fails later.
+func checkExecutablesPlatform(dst string, platform index.Platform, goos, goarch string) error {
+	bins := []string{platform.Bin}
+	for _, b := range platform.Bins {
+		bins = append(bins, b.Path)
+	}
+	for _, bin := range bins {
+		executable, err := pluginExecutable(dst, bin)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(executable); os.IsNotExist(err) {
+			continue
+		}
+		bp, err := executablePlatform(executable)
+		if err != nil {
+			return errors.Wrapf(err, "failed to read the executable %q", bin)
+		}
+		if !bp.matches(goos, goarch) {
+			return errorOfKind(ErrBinaryFormatMismatch, "installed binary %q is built for %s, not os=%s arch=%s", bin, bp, goos, goarch)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
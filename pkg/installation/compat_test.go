@@ -0,0 +1,258 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"bytes"
+	"debug/elf"
+	"debug/macho"
+	"debug/pe"
+	"encoding/binary"
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"reflect"
+	"runtime"
+	"testing"
+
+	"github.com/GoogleContainerTools/krew/pkg/environment"
+	"github.com/GoogleContainerTools/krew/pkg/index"
+
+	"github.com/pkg/errors"
+)
+
+func TestListIncompatible(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	// The test binary is built for the current system.
+	self, err := os.Executable()
+	if err != nil {
+		t.Fatal(err)
+	}
+	binary, err := ioutil.ReadFile(self)
+	if err != nil {
+		t.Fatal(err)
+	}
+	installFake(t, p, "binary", binary)
+	installFake(t, p, "script", []byte("#!/bin/sh\necho hello\n"))
+
+	got, err := ListIncompatible(p)
+	if err != nil {
+		t.Fatalf("ListIncompatible() error = %v", err)
+	}
+	if len(got) != 0 {
+		t.Errorf("ListIncompatible() = %v, want none", got)
+	}
+
+	otherArch := "arm64"
+	if runtime.GOARCH == otherArch {
+		otherArch = "amd64"
+	}
+	os.Setenv("KREW_ARCH", otherArch)
+	defer os.Unsetenv("KREW_ARCH")
+	got, err = ListIncompatible(p)
+	if err != nil {
+		t.Fatalf("ListIncompatible() error = %v", err)
+	}
+	if want := []string{"binary"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("ListIncompatible() on arch %s = %v, want %v", otherArch, got, want)
+	}
+}
+
+// installFake installs a plugin with the given executable content and links it
+// into the bin path.
+func installFake(t *testing.T, p environment.Paths, name string, content []byte) {
+	dir := p.PluginVersionInstallPath(name, "v1")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	executable := filepath.Join(dir, name)
+	if err := ioutil.WriteFile(executable, content, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := createOrUpdateLink(p.BinPath(), p.BinPrefix(), executable, name, false); err != nil {
+		t.Fatal(err)
+	}
+}
+
+func Test_executablePlatform(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+
+	tests := []struct {
+		name    string
+		content []byte
+		want    binaryPlatform
+	}{
+		{"elf linux", elfHeader(elf.ELFCLASS64, binary.LittleEndian, elf.ELFOSABI_LINUX, elf.EM_X86_64), binaryPlatform{"ELF", "linux", []string{"amd64"}}},
+		{"elf without os abi", elfHeader(elf.ELFCLASS64, binary.LittleEndian, elf.ELFOSABI_NONE, elf.EM_AARCH64), binaryPlatform{"ELF", "", []string{"arm64"}}},
+		{"elf freebsd", elfHeader(elf.ELFCLASS64, binary.LittleEndian, elf.ELFOSABI_FREEBSD, elf.EM_X86_64), binaryPlatform{"ELF", "freebsd", []string{"amd64"}}},
+		{"elf ppc64le", elfHeader(elf.ELFCLASS64, binary.LittleEndian, elf.ELFOSABI_NONE, elf.EM_PPC64), binaryPlatform{"ELF", "", []string{"ppc64le"}}},
+		{"elf ppc64", elfHeader(elf.ELFCLASS64, binary.BigEndian, elf.ELFOSABI_NONE, elf.EM_PPC64), binaryPlatform{"ELF", "", []string{"ppc64"}}},
+		{"elf mipsle", elfHeader(elf.ELFCLASS32, binary.LittleEndian, elf.ELFOSABI_NONE, elf.EM_MIPS), binaryPlatform{"ELF", "", []string{"mipsle"}}},
+		{"elf unknown arch", elfHeader(elf.ELFCLASS64, binary.LittleEndian, elf.ELFOSABI_NONE, elf.EM_IA_64), binaryPlatform{"ELF", "", nil}},
+		{"mach-o", machoHeader(macho.CpuArm64), binaryPlatform{"Mach-O", "darwin", []string{"arm64"}}},
+		{"universal mach-o", fatMachoHeader(macho.CpuAmd64, macho.CpuArm64), binaryPlatform{"Mach-O", "darwin", []string{"amd64", "arm64"}}},
+		{"java class", []byte("\xca\xfe\xba\xbe\x00\x00\x00\x34"), binaryPlatform{}},
+		{"pe", peHeader(pe.IMAGE_FILE_MACHINE_ARM64), binaryPlatform{"PE", "windows", []string{"arm64"}}},
+		{"script", []byte("#!/bin/sh\n"), binaryPlatform{}},
+		{"truncated elf", []byte("\x7fELF\x02\x01"), binaryPlatform{}},
+		{"empty", nil, binaryPlatform{}},
+	}
+	for i, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			path := filepath.Join(tmp, fmt.Sprintf("bin-%d", i))
+			if err := ioutil.WriteFile(path, tt.content, 0755); err != nil {
+				t.Fatal(err)
+			}
+			got, err := executablePlatform(path)
+			if err != nil {
+				t.Fatalf("executablePlatform() error = %v", err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("executablePlatform() = %#v, want %#v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_binaryPlatform_matches(t *testing.T) {
+	tests := []struct {
+		name         string
+		bp           binaryPlatform
+		goos, goarch string
+		want         bool
+	}{
+		{"script", binaryPlatform{}, "windows", "amd64", true},
+		{"same platform", binaryPlatform{"ELF", "linux", []string{"amd64"}}, "linux", "amd64", true},
+		{"other arch", binaryPlatform{"ELF", "linux", []string{"amd64"}}, "linux", "arm64", false},
+		{"other os", binaryPlatform{"ELF", "linux", []string{"amd64"}}, "freebsd", "amd64", false},
+		{"elf without os on freebsd", binaryPlatform{"ELF", "", []string{"amd64"}}, "freebsd", "amd64", true},
+		{"elf without os on darwin", binaryPlatform{"ELF", "", []string{"amd64"}}, "darwin", "amd64", false},
+		{"unknown arch", binaryPlatform{"ELF", "linux", nil}, "linux", "riscv64", true},
+		{"universal", binaryPlatform{"Mach-O", "darwin", []string{"amd64", "arm64"}}, "darwin", "arm64", true},
+		{"pe on linux", binaryPlatform{"PE", "windows", []string{"amd64"}}, "linux", "amd64", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := tt.bp.matches(tt.goos, tt.goarch); got != tt.want {
+				t.Errorf("matches(%s, %s) = %v, want %v", tt.goos, tt.goarch, got, tt.want)
+			}
+		})
+	}
+}
+
+// elfHeader returns an ELF header for the platform without any sections.
+func elfHeader(class elf.Class, order binary.ByteOrder, osabi elf.OSABI, machine elf.Machine) []byte {
+	var ident [elf.EI_NIDENT]byte
+	copy(ident[:], elf.ELFMAG)
+	ident[elf.EI_CLASS] = byte(class)
+	ident[elf.EI_DATA] = byte(elf.ELFDATA2LSB)
+	if order == binary.BigEndian {
+		ident[elf.EI_DATA] = byte(elf.ELFDATA2MSB)
+	}
+	ident[elf.EI_VERSION] = byte(elf.EV_CURRENT)
+	ident[elf.EI_OSABI] = byte(osabi)
+
+	var buf bytes.Buffer
+	if class == elf.ELFCLASS64 {
+		binary.Write(&buf, order, elf.Header64{Ident: ident, Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT), Ehsize: 64})
+	} else {
+		binary.Write(&buf, order, elf.Header32{Ident: ident, Type: uint16(elf.ET_EXEC), Machine: uint16(machine), Version: uint32(elf.EV_CURRENT), Ehsize: 52})
+	}
+	return buf.Bytes()
+}
+
+// fatMachoHeader returns a universal Mach-O binary of the headers for the cpus.
+func fatMachoHeader(cpus ...macho.Cpu) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.BigEndian, []uint32{macho.MagicFat, uint32(len(cpus))})
+	offset := uint32(8 + 20*len(cpus))
+	var archs []byte
+	for _, cpu := range cpus {
+		h := machoHeader(cpu)
+		binary.Write(&buf, binary.BigEndian, macho.FatArchHeader{Cpu: cpu, Offset: offset, Size: uint32(len(h))})
+		offset += uint32(len(h))
+		archs = append(archs, h...)
+	}
+	buf.Write(archs)
+	return buf.Bytes()
+}
+
+// peHeader returns a PE header for the machine without any sections.
+func peHeader(machine uint16) []byte {
+	dos := make([]byte, 0x80)
+	copy(dos, "MZ")
+	binary.LittleEndian.PutUint32(dos[0x3c:], uint32(len(dos)))
+	buf := bytes.NewBuffer(dos)
+	buf.WriteString("PE\x00\x00")
+	binary.Write(buf, binary.LittleEndian, pe.FileHeader{Machine: machine})
+	return buf.Bytes()
+}
+
+// machoHeader returns a 64-bit Mach-O header for the cpu without load commands.
+func machoHeader(cpu macho.Cpu) []byte {
+	var buf bytes.Buffer
+	binary.Write(&buf, binary.LittleEndian, macho.FileHeader{Magic: macho.Magic64, Cpu: cpu, Type: macho.TypeExec})
+	binary.Write(&buf, binary.LittleEndian, uint32(0))
+	return buf.Bytes()
+}
+
+func Test_checkExecutablesPlatform(t *testing.T) {
+	dst, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dst)
+	linux := elfHeader(elf.ELFCLASS64, binary.LittleEndian, elf.ELFOSABI_LINUX, elf.EM_X86_64)
+	for name, content := range map[string][]byte{
+		"kubectl-foo":    linux,
+		"kubectl-helper": []byte("#!/bin/sh\n"),
+		"kubectl-darwin": machoHeader(macho.CpuAmd64),
+	} {
+		if err := ioutil.WriteFile(filepath.Join(dst, name), content, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	tests := []struct {
+		name     string
+		platform index.Platform
+		wantErr  bool
+	}{
+		{"matching bins", index.Platform{Bin: "kubectl-foo", Bins: []index.ExtraBin{{Name: "helper", Path: "kubectl-helper"}}}, false},
+		{"extra bin for another os", index.Platform{Bin: "kubectl-foo", Bins: []index.ExtraBin{{Name: "darwin", Path: "kubectl-darwin"}}}, true},
+		{"missing bin", index.Platform{Bin: "kubectl-missing"}, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := checkExecutablesPlatform(dst, tt.platform, "linux", "amd64")
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkExecutablesPlatform() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil && errors.Cause(err) != ErrBinaryFormatMismatch {
+				t.Errorf("checkExecutablesPlatform() error = %v, want kind %v", err, ErrBinaryFormatMismatch)
+			}
+		})
+	}
+	if err := checkExecutablesPlatform(dst, index.Platform{Bin: "kubectl-foo"}, "linux", "arm64"); err == nil {
+		t.Error("checkExecutablesPlatform() for another arch expected error")
+	}
+}
@@ -0,0 +1,95 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"fmt"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
+
+	"github.com/pkg/errors"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// DryRunAllPlatforms downloads, extracts and moves the files of every platform
+// of the plugin into a temporary directory, e.g. to validate a manifest in CI
+// before it is published. Platforms are keyed by their label selector and map
+// to the error an install would have failed with, or nil. Nothing is
+// installed.
+func DryRunAllPlatforms(plugin index.Plugin) map[string]error {
+	return DryRunAllPlatformsWithOptions(plugin, Options{})
+}
+
+// DryRunAllPlatformsWithOptions is like DryRunAllPlatforms, configured by
+// opts. The platform selection of opts is ignored. If the plugin name is not
+// allowed, every platform maps to that error.
+func DryRunAllPlatformsWithOptions(plugin index.Plugin, opts Options) map[string]error {
+	name, nameErr := NormalizePluginName(plugin.Name)
+	results := make(map[string]error, len(plugin.Spec.Platforms))
+	for i, platform := range plugin.Spec.Platforms {
+		key := metav1.FormatLabelSelector(platform.Selector)
+		if _, ok := results[key]; ok {
+			key = fmt.Sprintf("%s (platform %d)", key, i)
+		}
+		if nameErr != nil {
+			results[key] = nameErr
+			continue
+		}
+		logging.V(2).Infof("Dry-running the installation of platform %s", key)
+		results[key] = dryRunPlatform(name, platform, opts)
+	}
+	return results
+}
+
+// dryRunPlatform installs the platform into a temporary directory and checks
+// that its executables exist.
+func dryRunPlatform(plugin string, platform index.Platform, opts Options) error {
+	if err := platform.Validate(); err != nil {
+		return errors.Wrap(err, "invalid platform")
+	}
+	version, uri, checksum, platform, fetcher, err := opts.platformDownloadTarget(platform)
+	if err != nil {
+		return err
+	}
+	tmp, err := ioutil.TempDir("", "krew-dry-run-")
+	if err != nil {
+		return errors.Wrap(err, "failed to create a temporary directory")
+	}
+	defer os.RemoveAll(tmp)
+
+	dst, err := downloadAndMove(version, uri, checksum, platform,
+		filepath.Join(tmp, "download"), filepath.Join(tmp, "staging"), filepath.Join(tmp, plugin), fetcher, opts)
+	if err != nil {
+		return err
+	}
+	bins := []string{platform.Bin}
+	for _, b := range platform.Bins {
+		bins = append(bins, b.Path)
+	}
+	for _, bin := range bins {
+		executable, err := pluginExecutable(dst, bin)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(executable); err != nil {
+			return errors.Wrapf(err, "executable %q can't be found after the file operations", bin)
+		}
+	}
+	return nil
+}
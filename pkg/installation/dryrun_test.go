@@ -0,0 +1,93 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestDryRunAllPlatforms(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+
+	platform := func(os string, bin string, sha256 string) index.Platform {
+		return index.Platform{
+			URI:      server.URL + "/kubectl-foo",
+			Sha256:   sha256,
+			Selector: &v1.LabelSelector{MatchLabels: map[string]string{"os": os}},
+			Files:    []index.FileOperation{{From: "kubectl-foo", To: "."}},
+			Bin:      bin,
+		}
+	}
+	var plugin index.Plugin
+	plugin.Name = "foo"
+	plugin.Spec.Platforms = []index.Platform{
+		platform("linux", "kubectl-foo", checksum),
+		platform("darwin", "kubectl-bar", checksum),
+		platform("windows", "kubectl-foo", "787ec76dcafd20c1908eb0936a12f91edd105ab5cd7ecc2b1ae2032648345dff"),
+		platform("linux", "kubectl-foo", checksum),
+	}
+
+	got := DryRunAllPlatforms(plugin)
+	wantErr := map[string]bool{
+		"os=linux":              false,
+		"os=darwin":             true,
+		"os=windows":            true,
+		"os=linux (platform 3)": false,
+	}
+	if len(got) != len(wantErr) {
+		t.Fatalf("DryRunAllPlatforms() = %v, want results for %v", got, wantErr)
+	}
+	for key, want := range wantErr {
+		err, ok := got[key]
+		if !ok {
+			t.Errorf("DryRunAllPlatforms() has no result for %s", key)
+		} else if (err != nil) != want {
+			t.Errorf("DryRunAllPlatforms()[%s] = %v, wantErr %v", key, err, want)
+		}
+	}
+}
+
+func TestDryRunAllPlatforms_unsafeName(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("DryRunAllPlatforms() downloaded %s for an unsafe plugin name", r.URL)
+	}))
+	defer server.Close()
+
+	for _, name := range []string{"../foo", "foo/bar", ".."} {
+		var plugin index.Plugin
+		plugin.Name = name
+		plugin.Spec.Platforms = []index.Platform{{
+			URI:      server.URL + "/kubectl-foo",
+			Sha256:   "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+			Selector: &v1.LabelSelector{MatchLabels: map[string]string{"os": "linux"}},
+			Files:    []index.FileOperation{{From: "kubectl-foo", To: "."}},
+			Bin:      "kubectl-foo",
+		}}
+		got := DryRunAllPlatforms(plugin)
+		if err := got["os=linux"]; errors.Cause(err) != ErrInvalidPluginName {
+			t.Errorf("DryRunAllPlatforms() of plugin %q = %v, want %v", name, err, ErrInvalidPluginName)
+		}
+	}
+}
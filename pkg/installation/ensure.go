@@ -0,0 +1,78 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"github.com/GoogleContainerTools/krew/pkg/environment"
+	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
+
+	"github.com/pkg/errors"
+)
+
+// Ensure installs the plugin at wantVersion unless it is installed at that
+// version already, and reports whether it changed anything. An installed
+// version other than wantVersion is replaced. Since a manifest provides a
+// single version per platform, wantVersion must be the version of the
+// matching platform, i.e. its checksum digest or "HEAD". An empty wantVersion
+// means the version of the manifest. An installed HEAD version is kept, without
+// fetching HEAD again, if wantVersion is "HEAD" or the manifest only provides
+// HEAD. Otherwise an empty wantVersion replaces it with the version of the
+// manifest.
+func Ensure(p environment.Paths, plugin index.Plugin, wantVersion string) (changed bool, err error) {
+	return EnsureWithOptions(p, plugin, wantVersion, Options{})
+}
+
+// EnsureWithOptions is like Ensure, configured by opts. opts.ForceHEAD is set
+// by wantVersion and opts.Force is ignored.
+func EnsureWithOptions(p environment.Paths, plugin index.Plugin, wantVersion string, opts Options) (changed bool, err error) {
+	if plugin, err = preflight(p, plugin, opts); err != nil {
+		return false, err
+	}
+	installed, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), plugin.Name)
+	if err != nil {
+		return false, errors.Wrap(err, "could not detect the installed version")
+	}
+	if ok && wantVersion != "" && installed == wantVersion {
+		logging.V(2).Infof("Plugin %s is installed at version %s", plugin.Name, installed)
+		return false, nil
+	}
+
+	opts.ForceHEAD = wantVersion == headVersion
+	version, uri, checksum, platform, fetcher, err := opts.getDownloadTarget(plugin)
+	if err != nil {
+		return false, wrapf(err, "failed to get the download target")
+	}
+	if wantVersion != "" && version != wantVersion {
+		return false, errors.Errorf("the manifest of plugin %q provides version %s, not %s", plugin.Name, version, wantVersion)
+	}
+	if ok && installed == version {
+		logging.V(2).Infof("Plugin %s is installed at version %s", plugin.Name, installed)
+		return false, nil
+	}
+
+	logging.V(1).Infof("Installing version %s of plugin %s", version, plugin.Name)
+	if err := install(plugin.Name, version, uri, checksum, platform, plugin.Spec.Aliases, p, fetcher, opts); err != nil {
+		return false, errors.Wrapf(err, "failed to install version %s", version)
+	}
+	if !ok {
+		return true, nil
+	}
+	logging.V(1).Infof("Removing previous version %s of plugin %s", installed, plugin.Name)
+	if err := removePluginVersionFromFS(p, plugin, version, installed, executedKrewVersion(p)); err != nil {
+		return true, errors.Wrapf(err, "failed to remove previous version %s", installed)
+	}
+	return true, nil
+}
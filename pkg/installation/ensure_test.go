@@ -0,0 +1,130 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+)
+
+func TestEnsure(t *testing.T) {
+	const (
+		v1 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+		v2 = "787ec76dcafd20c1908eb0936a12f91edd105ab5cd7ecc2b1ae2032648345dff"
+	)
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/v2/kubectl-foo" {
+			w.Write([]byte("HELLO WORLD"))
+			return
+		}
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	fos := []index.FileOperation{{From: "kubectl-foo", To: "."}}
+
+	pluginV1, err := pluginFromURL("foo", server.URL+"/v1/kubectl-foo", v1, "kubectl-foo", fos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pluginV2, err := pluginFromURL("foo", server.URL+"/v2/kubectl-foo", v2, "kubectl-foo", fos)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	steps := []struct {
+		name        string
+		plugin      index.Plugin
+		wantVersion string
+		wantChanged bool
+		wantErr     bool
+	}{
+		{"installs if absent", pluginV1, v1, true, false},
+		{"no-op at the wanted version", pluginV1, v1, false, false},
+		{"no-op at the manifest version", pluginV1, "", false, false},
+		{"version not in manifest", pluginV1, v2, false, true},
+		{"upgrades to the wanted version", pluginV2, v2, true, false},
+		{"downgrades to the wanted version", pluginV1, v1, true, false},
+	}
+	for _, s := range steps {
+		changed, err := Ensure(p, s.plugin, s.wantVersion)
+		if (err != nil) != s.wantErr {
+			t.Fatalf("%s: Ensure() error = %v, wantErr %v", s.name, err, s.wantErr)
+		}
+		if changed != s.wantChanged {
+			t.Fatalf("%s: Ensure() changed = %v, want %v", s.name, changed, s.wantChanged)
+		}
+	}
+
+	got, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo")
+	if err != nil || !ok || got != v1 {
+		t.Fatalf("installed version = %s (installed=%v, err=%v), want %s", got, ok, err, v1)
+	}
+	if _, err := os.Stat(p.PluginVersionInstallPath("foo", v2)); !os.IsNotExist(err) {
+		t.Errorf("previous version was not removed, err = %v", err)
+	}
+}
+
+func TestEnsure_head(t *testing.T) {
+	const v1 = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	var headDownloads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/head/kubectl-foo" {
+			headDownloads++
+		}
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	plugin, err := pluginFromURL("foo", server.URL+"/v1/kubectl-foo", v1, "kubectl-foo", []index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.Spec.Platforms[0].Head = server.URL + "/head/kubectl-foo"
+
+	steps := []struct {
+		name        string
+		wantVersion string
+		wantChanged bool
+		wantHEADs   int
+		wantActive  string
+	}{
+		{"installs HEAD", headVersion, true, 1, headVersion},
+		{"keeps HEAD without fetching it", headVersion, false, 1, headVersion},
+		{"replaces HEAD with the manifest version", "", true, 1, v1},
+	}
+	for _, s := range steps {
+		changed, err := Ensure(p, plugin, s.wantVersion)
+		if err != nil {
+			t.Fatalf("%s: Ensure() error = %v", s.name, err)
+		}
+		if changed != s.wantChanged {
+			t.Fatalf("%s: Ensure() changed = %v, want %v", s.name, changed, s.wantChanged)
+		}
+		if headDownloads != s.wantHEADs {
+			t.Fatalf("%s: HEAD downloads = %d, want %d", s.name, headDownloads, s.wantHEADs)
+		}
+		got, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo")
+		if err != nil || !ok || got != s.wantActive {
+			t.Fatalf("%s: installed version = %s (installed=%v, err=%v), want %s", s.name, got, ok, err, s.wantActive)
+		}
+	}
+}
@@ -0,0 +1,92 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"fmt"
+
+	"github.com/pkg/errors"
+)
+
+// Plugin Lifecycle Errors
+var (
+	ErrIsAlreadyInstalled = errors.New("can't install, the newest version is already installed")
+	ErrIsNotInstalled     = errors.New("plugin is not installed")
+	ErrIsAlreadyUpgraded  = errors.New("can't upgrade, the newest version is already installed")
+)
+
+// Errors of the failure modes of this package. They are usually returned with
+// a more specific message and wrapped, so callers should compare them with
+// errors.Cause(err) or errors.Is of the standard library. The vendored
+// github.com/pkg/errors predates Unwrap, so errors.Is only sees through errors
+// wrapped with wrapf.
+var (
+	ErrInvalidPluginName    = errors.New("invalid plugin name")
+	ErrReservedName         = errors.New("name is reserved for krew")
+	ErrNoMatchingPlatform   = errors.New("no matching platform found")
+	ErrNoHEAD               = errors.New("no HEAD specified")
+	ErrNotStaged            = errors.New("version is not staged")
+	ErrUnverified           = errors.New("refusing to install unverified plugin version")
+	ErrRequiredNotInstalled = errors.New("required plugin is not installed")
+	ErrDependencyCycle      = errors.New("dependency cycle")
+	ErrStagingDirRemoved    = errors.New("staging directory was removed externally")
+	ErrBinaryFormatMismatch = errors.New("binary format does not match the platform")
+	ErrSetuidExecutable     = errors.New("refusing to link setuid or setgid executable")
+)
+
+// kindError has its own message, and one of the errors of this package as its
+// cause.
+type kindError struct {
+	kind error
+	msg  string
+}
+
+func (e kindError) Error() string { return e.msg }
+
+// Cause returns the kind of the error for errors.Cause.
+func (e kindError) Cause() error { return e.kind }
+
+// Unwrap returns the kind of the error for errors.Is of the standard library.
+func (e kindError) Unwrap() error { return e.kind }
+
+// errorOfKind returns an error with the formatted message, whose cause is kind.
+func errorOfKind(kind error, format string, args ...interface{}) error {
+	return kindError{kind: kind, msg: fmt.Sprintf(format, args...)}
+}
+
+// wrappedError prefixes the message of its cause, like fmt.Errorf with %w,
+// and can also be unwrapped by errors.Cause.
+type wrappedError struct {
+	wrapped error
+	msg     string
+}
+
+func (e wrappedError) Error() string { return e.msg }
+
+// Cause returns the wrapped error for errors.Cause.
+func (e wrappedError) Cause() error { return e.wrapped }
+
+// Unwrap returns the wrapped error for errors.Is and errors.As of the
+// standard library.
+func (e wrappedError) Unwrap() error { return e.wrapped }
+
+// wrapf wraps err with the formatted message, like errors.Wrapf, so that both
+// errors.Cause and errors.Is of the standard library see through it.
+func wrapf(err error, format string, args ...interface{}) error {
+	if err == nil {
+		return nil
+	}
+	return wrappedError{wrapped: err, msg: fmt.Sprintf(format, args...) + ": " + err.Error()}
+}
@@ -0,0 +1,102 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	stderrors "errors"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+)
+
+func Test_errorOfKind(t *testing.T) {
+	err := errorOfKind(ErrNotStaged, "version %s is not staged", "v1")
+	if got, want := err.Error(), "version v1 is not staged"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if errors.Cause(errors.Wrap(err, "failed")) != ErrNotStaged {
+		t.Error("errors.Cause() of a wrapped error is not its kind")
+	}
+	if !stderrors.Is(err, ErrNotStaged) {
+		t.Error("errors.Is() of the error is not its kind")
+	}
+}
+
+func Test_wrapf(t *testing.T) {
+	err := wrapf(errorOfKind(ErrNoHEAD, "no HEAD of %s", "foo"), "failed to get the plugin version")
+	if got, want := err.Error(), "failed to get the plugin version: no HEAD of foo"; got != want {
+		t.Errorf("Error() = %q, want %q", got, want)
+	}
+	if errors.Cause(err) != ErrNoHEAD {
+		t.Error("errors.Cause() of a wrapped error is not its kind")
+	}
+	if !stderrors.Is(err, ErrNoHEAD) {
+		t.Error("errors.Is() of a wrapped error is not its kind")
+	}
+	var kind kindError
+	if !stderrors.As(err, &kind) || kind.kind != ErrNoHEAD {
+		t.Errorf("errors.As() of a wrapped error = %v, want the kindError", kind)
+	}
+	if wrapf(nil, "failed") != nil {
+		t.Error("wrapf(nil) is not nil")
+	}
+}
+
+func TestErrorKinds(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	foo, err := pluginFromURL("foo", "https://example.invalid/kubectl-foo", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	krew := foo
+	krew.Name = "krew"
+	requiring := foo
+	requiring.Spec.Requires = []string{"bar"}
+	noPlatform := foo
+	noPlatform.Spec.Platforms = nil
+	noChecksum := foo
+	noChecksum.Spec.Platforms = []index.Platform{foo.Spec.Platforms[0]}
+	noChecksum.Spec.Platforms[0].Sha256 = ""
+
+	tests := []struct {
+		name string
+		err  error
+		want error
+	}{
+		{"invalid name", Remove(p, "../foo"), ErrInvalidPluginName},
+		{"reserved name", InstallWithOptions(p, krew, Options{}), ErrReservedName},
+		{"removing krew", Remove(p, "krew"), ErrReservedName},
+		{"not installed", Remove(p, "foo"), ErrIsNotInstalled},
+		{"not staged", Activate(p, foo, "v1"), ErrNotStaged},
+		{"no matching platform", InstallWithOptions(p, noPlatform, Options{}), ErrNoMatchingPlatform},
+		{"no HEAD", InstallWithOptions(p, foo, Options{ForceHEAD: true}), ErrNoHEAD},
+		{"no checksum", InstallWithOptions(p, noChecksum, Options{}), ErrUnverified},
+		{"required not installed", InstallWithOptions(p, requiring, Options{}), ErrRequiredNotInstalled},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := errors.Cause(tt.err); got != tt.want {
+				t.Errorf("errors.Cause(%v) = %v, want %v", tt.err, got, tt.want)
+			}
+			if !stderrors.Is(tt.err, tt.want) {
+				t.Errorf("errors.Is(%v, %v) = false", tt.err, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"sort"
+
+	"github.com/GoogleContainerTools/krew/pkg/environment"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
+
+	"github.com/pkg/errors"
+)
+
+// GarbageCollect removes the version directories of plugins that no symlink
+// in the bin path points into, e.g. those left behind by a crashed upgrade,
+// and returns the removed paths. The versions linked from the bin path and
+// the currently executed krew version are never removed. Versions installed
+// with Stage or InstallWithoutLink but not activated yet are removed too, so
+// it must not run concurrently with an installation. For the same reason, the
+// dirs left in the staging path by interrupted installations are removed as
+// well. Only symlinks in p.BinPath() count, so versions linked from other
+// bin paths, e.g. project-local ones used with p.WithBinPath, are removed
+// unless those are passed to GarbageCollectWithBinPaths.
+func GarbageCollect(p environment.Paths) ([]string, error) {
+	return GarbageCollectWithBinPaths(p, nil)
+}
+
+// GarbageCollectWithBinPaths is like GarbageCollect, but the symlinks in
+// binPaths point to versions that are kept as well. Nothing but the staging
+// dirs is removed if one of the bin paths does not exist.
+func GarbageCollectWithBinPaths(p environment.Paths, binPaths []string) ([]string, error) {
+	removed, err := removeStaleStagingDirs(p)
+	if err != nil {
+		return removed, err
+	}
+	binPaths = append([]string{p.BinPath()}, binPaths...)
+	for _, binPath := range binPaths {
+		if _, err := os.Stat(binPath); os.IsNotExist(err) {
+			logging.V(2).Infof("Bin path %q does not exist, not removing anything", binPath)
+			sort.Strings(removed)
+			return removed, nil
+		}
+	}
+	referenced, err := referencedVersions(p, binPaths)
+	if err != nil {
+		return removed, err
+	}
+	if version := executedKrewVersion(p); version != "" {
+		referenced[krewPluginName+"/"+version] = true
+	}
+
+	plugins, err := ioutil.ReadDir(p.InstallPath())
+	if os.IsNotExist(err) {
+		sort.Strings(removed)
+		return removed, nil
+	} else if err != nil {
+		return removed, errors.Wrap(err, "failed to read install dir")
+	}
+	for _, plugin := range plugins {
+		if !plugin.IsDir() {
+			continue
+		}
+		versions, err := ioutil.ReadDir(p.PluginInstallPath(plugin.Name()))
+		if err != nil {
+			return removed, errors.Wrapf(err, "failed to read the install dir of plugin %q", plugin.Name())
+		}
+		for _, version := range versions {
+			if !version.IsDir() || referenced[plugin.Name()+"/"+version.Name()] {
+				continue
+			}
+			dir := p.PluginVersionInstallPath(plugin.Name(), version.Name())
+			logging.V(1).Infof("Removing unreferenced installation %q", dir)
+			if err := os.RemoveAll(dir); err != nil {
+				return removed, errors.Wrapf(err, "failed to remove %q", dir)
+			}
+			removed = append(removed, dir)
+		}
+		if err := pruneEmptyDirs(p.PluginInstallPath(plugin.Name()), p.InstallPath()); err != nil {
+			return removed, err
+		}
+	}
+	sort.Strings(removed)
+	return removed, nil
+}
+
+// executedKrewVersion returns the installed krew version that is currently
+// executed, or "" if the executable is not a krew installation of p.
+func executedKrewVersion(p environment.Paths) string {
+	self, err := os.Executable()
+	if err != nil {
+		return ""
+	}
+	version, ok, err := environment.GetExecutedVersion(p.InstallPath(), self, environment.Realpath)
+	if err != nil || !ok {
+		return ""
+	}
+	return version
+}
+
+// referencedVersions returns the "plugin/version" pairs of the install path
+// that a symlink in one of the bin paths points into.
+func referencedVersions(p environment.Paths, binPaths []string) (map[string]bool, error) {
+	referenced := make(map[string]bool)
+	for _, binPath := range binPaths {
+		links, err := ListManagedSymlinks(p.WithBinPath(binPath))
+		if err != nil {
+			return nil, err
+		}
+		for _, l := range links {
+			referenced[l.Plugin+"/"+l.Version] = true
+		}
+	}
+	return referenced, nil
+}
+
+// removeStaleStagingDirs removes every entry of the staging path and returns
+// the removed paths.
+func removeStaleStagingDirs(p environment.Paths) ([]string, error) {
+	entries, err := ioutil.ReadDir(p.StagingPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrap(err, "failed to read staging dir")
+	}
+	var removed []string
+	for _, e := range entries {
+		dir := filepath.Join(p.StagingPath(), e.Name())
+		logging.V(1).Infof("Removing stale staging dir %q", dir)
+		if err := os.RemoveAll(dir); err != nil {
+			return removed, errors.Wrapf(err, "failed to remove %q", dir)
+		}
+		removed = append(removed, dir)
+	}
+	return removed, nil
+}
@@ -0,0 +1,140 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+)
+
+func TestGarbageCollect(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	installFake(t, p, "foo", []byte("#!/bin/sh\n"))
+	for _, dir := range []string{
+		p.PluginVersionInstallPath("foo", "v0"),
+		p.PluginVersionInstallPath("foo", headOldVersion),
+		p.PluginVersionInstallPath("orphan", "v1"),
+	} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := GarbageCollect(p)
+	if err != nil {
+		t.Fatalf("GarbageCollect() error = %v", err)
+	}
+	want := []string{
+		p.PluginVersionInstallPath("foo", headOldVersion),
+		p.PluginVersionInstallPath("foo", "v0"),
+		p.PluginVersionInstallPath("orphan", "v1"),
+	}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("GarbageCollect() = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(filepath.Join(p.PluginVersionInstallPath("foo", "v1"), "foo")); err != nil {
+		t.Errorf("linked version was removed: %v", err)
+	}
+	if _, err := os.Stat(p.PluginInstallPath("orphan")); !os.IsNotExist(err) {
+		t.Errorf("empty plugin dir of orphan was not removed, err = %v", err)
+	}
+
+	if got, err := GarbageCollect(p); err != nil || len(got) != 0 {
+		t.Errorf("second GarbageCollect() = %v, %v, want nothing removed", got, err)
+	}
+}
+
+func TestGarbageCollect_noBinPath(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	dir := p.PluginVersionInstallPath("foo", "v1")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	p = p.WithBinPath(filepath.Join(p.BasePath(), "not-exists"))
+	if got, err := GarbageCollect(p); err != nil || len(got) != 0 {
+		t.Errorf("GarbageCollect() = %v, %v, want nothing removed", got, err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Errorf("version was removed without a bin path: %v", err)
+	}
+}
+
+func TestGarbageCollect_staleStagingDirs(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	installFake(t, p, "foo", []byte("#!/bin/sh\n"))
+	reinstall := filepath.Join(p.StagingPath(), "krew-reinstall123")
+	move := filepath.Join(p.StagingPath(), "krew-temp-move123")
+	for _, dir := range []string{reinstall, move} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got, err := GarbageCollect(p)
+	if err != nil {
+		t.Fatalf("GarbageCollect() error = %v", err)
+	}
+	if want := []string{reinstall, move}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GarbageCollect() = %v, want %v", got, want)
+	}
+	if _, err := os.Stat(p.StagingPath()); err != nil {
+		t.Errorf("staging path was removed: %v", err)
+	}
+}
+
+func TestGarbageCollectWithBinPaths(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	project := p.WithBinPath(filepath.Join(p.BasePath(), "project-bin"))
+	if err := os.MkdirAll(project.BinPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	plugin, err := pluginFromURL("foo", "https://example.invalid/kubectl-foo", checksum, "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InstallWithOptions(project, plugin, Options{Transport: fakeTransport("hello world")}); err != nil {
+		t.Fatalf("InstallWithOptions() into the project bin path error = %v", err)
+	}
+	dir := p.PluginVersionInstallPath("foo", checksum)
+
+	if got, err := GarbageCollectWithBinPaths(p, []string{project.BinPath()}); err != nil || len(got) != 0 {
+		t.Fatalf("GarbageCollectWithBinPaths() = %v, %v, want nothing removed", got, err)
+	}
+	if _, err := os.Stat(dir); err != nil {
+		t.Fatalf("version linked from the project bin path was removed: %v", err)
+	}
+
+	got, err := GarbageCollect(p)
+	if err != nil {
+		t.Fatalf("GarbageCollect() error = %v", err)
+	}
+	if want := []string{dir}; !reflect.DeepEqual(got, want) {
+		t.Errorf("GarbageCollect() without the project bin path = %v, want %v", got, want)
+	}
+}
@@ -15,26 +15,34 @@
 package installation
 
 import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
 	"os"
 	"path/filepath"
 	"runtime"
+	"sort"
 	"strings"
 
 	"github.com/GoogleContainerTools/krew/pkg/download"
 	"github.com/GoogleContainerTools/krew/pkg/environment"
 	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
 	"github.com/GoogleContainerTools/krew/pkg/pathutil"
 	"github.com/pkg/errors"
-
-	"github.com/golang/glog"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
-// Plugin Lifecycle Errors
-var (
-	ErrIsAlreadyInstalled = errors.New("can't install, the newest version is already installed")
-	ErrIsNotInstalled     = errors.New("plugin is not installed")
-	ErrIsAlreadyUpgraded  = errors.New("can't upgrade, the newest version is already installed")
-)
+// reservedNames are the commands of krew itself, which plugins can't take
+// over.
+var reservedNames = []string{krewPluginName}
+
+// isReservedName reports whether the plugin or command name is reserved for
+// krew.
+func isReservedName(name string) bool {
+	return containsString(reservedNames, name)
+}
 
 const (
 	headVersion    = "HEAD"
@@ -42,116 +50,916 @@ const (
 	krewPluginName = "krew"
 )
 
-func downloadAndMove(version, uri string, fos []index.FileOperation, downloadPath, installPath string) (dst string, err error) {
-	glog.V(3).Infof("Creating download dir %q", downloadPath)
+func downloadAndMove(version, uri, checksum string, platform index.Platform, downloadPath, stagingPath, installPath string, fetcher download.Fetcher, opts Options) (dst string, err error) {
+	fos, nested := platform.Files, platform.NestedArchives
+	logging.V(3).Infof("Creating download dir %q", downloadPath)
+	// A kept download dir of an earlier install would mix with this one.
+	if err = os.RemoveAll(downloadPath); err != nil {
+		return "", errors.Wrapf(err, "could not clean download path %q", downloadPath)
+	}
 	if err = os.MkdirAll(downloadPath, 0755); err != nil {
 		return "", errors.Wrapf(err, "could not create download path %q", downloadPath)
 	}
-	defer os.RemoveAll(downloadPath)
+	defer removeTempDir(downloadPath, opts.KeepTempDirs)
 
+	var filter download.Filter
+	// Entries of nested archives can't be matched before they are extracted,
+	// and a kept download dir should show the whole archive.
+	if opts.SelectiveExtraction && len(nested) == 0 && !opts.KeepTempDirs {
+		filter = fileOperationsFilter(fos)
+	}
+	dlOpts := opts.downloadOptions(filter)
 	if version == headVersion {
-		glog.V(1).Infof("Getting latest version from HEAD")
-		err = download.GetInsecure(uri, downloadPath, download.HTTPFetcher{})
+		logging.V(1).Infof("Getting latest version from HEAD")
+		err = download.GetInsecure(uri, downloadPath, fetcher, dlOpts)
+	} else if opts.LocalArchive != "" && opts.SkipLocalVerification {
+		logging.Warningf("Installing %q as version %s without verifying its checksum", opts.LocalArchive, version)
+		err = download.GetInsecure(uri, downloadPath, fetcher, dlOpts)
 	} else {
-		glog.V(1).Infof("Getting sha256 (%s) signed version", version)
-		err = download.GetWithSha256(uri, downloadPath, version, download.HTTPFetcher{})
+		logging.V(1).Infof("Getting checksum (%s) signed version", checksum)
+		err = opts.downloadWithChecksum(uri, downloadPath, checksum, platform.Size, fetcher, dlOpts)
+	}
+	if err != nil {
+		return "", checkRemovedExternally(downloadPath, "download", err)
 	}
+	for _, archive := range nested {
+		if err := extractNested(downloadPath, archive, opts.downloadOptions(nil)); err != nil {
+			return "", checkRemovedExternally(downloadPath, "download", err)
+		}
+	}
+
+	stats, err := download.StatExtracted(downloadPath)
 	if err != nil {
 		return "", err
 	}
+	logging.V(1).Infof("Extracted %s", stats)
+	return moveToInstallDir(downloadPath, stagingPath, installPath, version, fos, opts.KeepTempDirs)
+}
 
-	return moveToInstallDir(downloadPath, installPath, version, fos)
+// extractNested extracts the archive at the slash-separated path inside the
+// download dir into its directory and removes it.
+func extractNested(dir, archive string, opts download.Options) error {
+	path, err := pluginExecutable(dir, archive)
+	if err != nil {
+		return errors.Wrapf(err, "nested archive %q is outside of the download", archive)
+	}
+	fi, err := os.Lstat(path)
+	if err != nil {
+		return errors.Wrapf(err, "nested archive %q not found in the download", archive)
+	}
+	if !fi.Mode().IsRegular() {
+		return errors.Errorf("nested archive %q is not a regular file", archive)
+	}
+	logging.V(2).Infof("Extracting nested archive %q", archive)
+	if err := download.ExtractFile(path, filepath.Dir(path), opts); err != nil {
+		return errors.Wrapf(err, "failed to extract nested archive %q", archive)
+	}
+	return errors.Wrapf(os.Remove(path), "failed to remove nested archive %q", archive)
+}
+
+// rewriteURL applies the URLRewriter of the options to the download uri, if
+// set.
+func (o Options) rewriteURL(uri string) string {
+	if o.URLRewriter == nil {
+		return uri
+	}
+	rewritten := o.URLRewriter(uri)
+	if rewritten != uri {
+		logging.V(2).Infof("Rewrote download URL %q to %q", uri, rewritten)
+	}
+	return rewritten
 }
 
-// Install will download and install a plugin. The operation tries
-// to not get the plugin dir in a bad state if it fails during the process.
-func Install(p environment.Paths, plugin index.Plugin, forceHEAD bool) error {
-	glog.V(2).Infof("Looking for installed versions")
-	_, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), plugin.Name)
+// downloadWithChecksum downloads and verifies the uri, and its size unless it
+// is zero. The download is retried up to o.ChecksumMismatchRetries times if
+// the checksum does not match.
+func (o Options) downloadWithChecksum(uri, downloadPath, checksum string, size int64, fetcher download.Fetcher, dlOpts download.Options) error {
+	var got []string
+	for attempt := 0; ; attempt++ {
+		err := download.GetWithChecksumAndSize(uri, downloadPath, checksum, size, fetcher, dlOpts)
+		mismatch, ok := errors.Cause(err).(*download.ChecksumMismatchError)
+		if !ok {
+			return err
+		}
+		got = append(got, mismatch.Got)
+		if attempt >= o.ChecksumMismatchRetries {
+			if len(got) == 1 {
+				return err
+			}
+			return errors.Errorf("checksum does not match after %d attempts, want: %s, got: %s", len(got), mismatch.Want, strings.Join(got, ", "))
+		}
+		logging.Warningf("Checksum of %q does not match, downloading again (attempt %d of %d)", uri, attempt+2, o.ChecksumMismatchRetries+1)
+	}
+}
+
+// Install will download and install a plugin, staging and then activating it.
+// The operation tries to not get the plugin dir in a bad state if it fails
+// during the process. The plugin is linked into p.BinPath(), which can be
+// overridden per call with p.WithBinPath. If force is set, the plugin is
+// downloaded and activated again instead of returning ErrIsAlreadyInstalled,
+// and its other versions are removed afterwards.
+func Install(p environment.Paths, plugin index.Plugin, forceHEAD, force bool) error {
+	return InstallWithOptions(p, plugin, Options{ForceHEAD: forceHEAD, Force: force})
+}
+
+// InstallWithOptions is like Install, configured by opts.
+func InstallWithOptions(p environment.Paths, plugin index.Plugin, opts Options) error {
+	plugin, err := preflight(p, plugin, opts)
+	if err != nil {
+		return err
+	}
+	logging.V(2).Infof("Looking for installed versions")
+	installed, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), plugin.Name)
+	if err != nil {
+		return err
+	}
+	if ok && !opts.Force {
+		return ErrIsAlreadyInstalled
+	}
+
+	logging.V(1).Infof("Finding download target for plugin %s", plugin.Name)
+	version, uri, checksum, platform, fetcher, err := opts.getDownloadTarget(plugin)
+	if err != nil {
+		return err
+	}
+	if ok {
+		return reinstall(p, plugin, installed, version, uri, checksum, platform, fetcher, opts)
+	}
+	return install(plugin.Name, version, uri, checksum, platform, plugin.Spec.Aliases, p, fetcher, opts)
+}
+
+// reinstall downloads and activates the version of an installed plugin, and
+// removes the rest of its install dir afterwards. The installed version is
+// only removed after the new one is activated, so that it is kept if the
+// reinstall fails.
+func reinstall(p environment.Paths, plugin index.Plugin, installed, version, uri, checksum string, platform index.Platform, fetcher download.Fetcher, opts Options) error {
+	logging.V(1).Infof("Reinstalling plugin %s over its installed version %s", plugin.Name, installed)
+	// Staging replaces the dir of the same version, and of HEAD, which any
+	// version can fall back to, so the installed one is moved aside first.
+	var backup string
+	if installed == version || installed == headVersion {
+		if err := os.MkdirAll(p.StagingPath(), 0755); err != nil {
+			return errors.Wrapf(err, "error creating staging path %q", p.StagingPath())
+		}
+		dir, err := ioutil.TempDir(p.StagingPath(), "krew-reinstall")
+		if err != nil {
+			return errors.Wrap(err, "failed to create a directory for the installed version")
+		}
+		defer os.RemoveAll(dir)
+		backup = filepath.Join(dir, installed)
+		if err := os.Rename(p.PluginVersionInstallPath(plugin.Name, installed), backup); err != nil {
+			return errors.Wrapf(err, "failed to move the installed version %s aside", installed)
+		}
+	}
+	restore := func() {
+		if backup == "" {
+			return
+		}
+		dst := p.PluginVersionInstallPath(plugin.Name, installed)
+		if err := os.RemoveAll(dst); err != nil {
+			logging.Warningf("Failed to restore the installed version %s of plugin %s: %v", installed, plugin.Name, err)
+			return
+		}
+		if err := os.Rename(backup, dst); err != nil {
+			logging.Warningf("Failed to restore the installed version %s of plugin %s: %v", installed, plugin.Name, err)
+		}
+	}
+
+	dst, err := stage(plugin.Name, version, uri, checksum, platform, p, fetcher, opts)
+	if err != nil {
+		restore()
+		return err
+	}
+	if err := activate(p, plugin.Name, dst, platform, plugin.Spec.Aliases, opts); err != nil {
+		os.RemoveAll(dst)
+		restore()
+		return err
+	}
+	return removeOtherVersions(p, plugin.Name, filepath.Base(dst))
+}
+
+// removeOtherVersions removes everything in the install dir of the plugin but
+// the version keep. The executed version of krew is kept as well.
+func removeOtherVersions(p environment.Paths, plugin, keep string) error {
+	versions, err := ioutil.ReadDir(p.PluginInstallPath(plugin))
+	if err != nil {
+		return errors.Wrapf(err, "failed to read the install dir of plugin %q", plugin)
+	}
+	executed := ""
+	if plugin == krewPluginName {
+		executed = executedKrewVersion(p)
+	}
+	for _, v := range versions {
+		if v.Name() == keep || v.Name() == executed {
+			continue
+		}
+		dir := p.PluginVersionInstallPath(plugin, v.Name())
+		logging.V(1).Infof("Removing old version %s of plugin %s", v.Name(), plugin)
+		if err := os.RemoveAll(dir); err != nil {
+			return errors.Wrapf(err, "failed to remove %q", dir)
+		}
+	}
+	return nil
+}
+
+// preflight returns the plugin with its name normalized, or an error if it
+// must not be installed with opts, before anything is downloaded or changed:
+// if its name is reserved, a platform has no files to install, it requires a
+// newer krew or the plugins it requires are not installed. Missing
+// requirements are installed first if opts.InstallRequired is set. It is
+// shared by every entry point that installs a plugin.
+func preflight(p environment.Paths, plugin index.Plugin, opts Options) (index.Plugin, error) {
+	var err error
+	if plugin.Name, err = NormalizePluginName(plugin.Name); err != nil {
+		return plugin, err
+	}
+	if isReservedName(plugin.Name) && !opts.AllowReservedName {
+		return plugin, errorOfKind(ErrReservedName, "the plugin name %q is reserved for krew", plugin.Name)
+	}
+	for i, platform := range plugin.Spec.Platforms {
+		if len(platform.Files) == 0 {
+			// Nothing would be moved into the install directory, so linking
+			// the bin would fail with a less helpful error.
+			return plugin, errors.Errorf("platform (%d) of plugin %q defines no files to install", i, plugin.Name)
+		}
+	}
+	if err := checkKrewVersion(plugin, opts); err != nil {
+		return plugin, err
+	}
+	return plugin, ensureRequired(p, plugin, opts)
+}
+
+// InstallFromURL will download and install a plugin from the url without
+// looking it up in an index. The download is verified against the sha256
+// checksum and installed like a plugin manifest with a single platform
+// matching the current system.
+func InstallFromURL(p environment.Paths, name, url, sha256, bin string, files []index.FileOperation) error {
+	plugin, err := pluginFromURL(name, url, sha256, bin, files)
+	if err != nil {
+		return err
+	}
+	return Install(p, plugin, false, false)
+}
+
+// InstallFromReader will install a plugin from the archive read from r, e.g.
+// piped to stdin, without looking it up in an index. The filename is used to
+// infer the archive type from its suffix, like the last element of a URL. If
+// a checksum is given, the archive is verified against it, otherwise the
+// plugin is installed as its HEAD version.
+func InstallFromReader(p environment.Paths, name, filename string, r io.Reader, checksum, bin string, files []index.FileOperation) error {
+	return InstallFromReaderWithOptions(p, name, filename, r, checksum, bin, files, Options{})
+}
+
+// InstallFromReaderWithOptions is like InstallFromReader, configured by opts.
+// The download options of opts are not used, since nothing is downloaded.
+func InstallFromReaderWithOptions(p environment.Paths, name, filename string, r io.Reader, checksum, bin string, files []index.FileOperation, opts Options) error {
+	var plugin index.Plugin
+	plugin.Name = name
+	plugin, err := preflight(p, plugin, opts)
+	if err != nil {
+		return err
+	}
+	name = plugin.Name
+	platform := index.Platform{Head: filename, Files: files, Bin: bin}
+	if checksum != "" {
+		platform = index.Platform{URI: filename, Sha256: checksum, Files: files, Bin: bin}
+	}
+	if err := platform.Validate(); err != nil {
+		return errors.Wrap(err, "invalid plugin archive")
+	}
+	version, uri, checksum, err := getPluginVersion(platform, false)
+	if err != nil {
+		return wrapf(err, "failed to get the plugin version")
+	}
+
+	_, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), name)
 	if err != nil {
 		return err
 	}
 	if ok {
 		return ErrIsAlreadyInstalled
 	}
+	return install(name, version, uri, checksum, platform, nil, p, download.NewReaderFetcher(r), opts)
+}
 
-	glog.V(1).Infof("Finding download target for plugin %s", plugin.Name)
-	version, uri, fos, bin, err := getDownloadTarget(plugin, forceHEAD)
+// pluginFromURL synthesizes a plugin manifest with a single platform that
+// matches the current system.
+func pluginFromURL(name, url, sha256, bin string, files []index.FileOperation) (index.Plugin, error) {
+	name, err := NormalizePluginName(name)
+	if err != nil {
+		return index.Plugin{}, err
+	}
+	os, arch := osArch()
+	platform := index.Platform{
+		URI:    url,
+		Sha256: sha256,
+		Selector: &metav1.LabelSelector{
+			MatchLabels: map[string]string{"os": os, "arch": arch},
+		},
+		Files: files,
+		Bin:   bin,
+	}
+	if err := platform.Validate(); err != nil {
+		return index.Plugin{}, errors.Wrap(err, "invalid plugin download")
+	}
+	var plugin index.Plugin
+	plugin.Name = name
+	plugin.Spec.Platforms = []index.Platform{platform}
+	return plugin, nil
+}
+
+// Stage will download a plugin and move it into its versioned install
+// directory without activating it, so the bin symlink is left untouched. It
+// returns the staged version that can be activated with Activate.
+func Stage(p environment.Paths, plugin index.Plugin, forceHEAD bool) (string, error) {
+	return StageWithOptions(p, plugin, Options{ForceHEAD: forceHEAD})
+}
+
+// StageWithOptions is like Stage, configured by opts. opts.Force is ignored.
+func StageWithOptions(p environment.Paths, plugin index.Plugin, opts Options) (string, error) {
+	plugin, err := preflight(p, plugin, opts)
+	if err != nil {
+		return "", err
+	}
+	logging.V(1).Infof("Finding download target for plugin %s", plugin.Name)
+	version, uri, checksum, platform, fetcher, err := opts.getDownloadTarget(plugin)
+	if err != nil {
+		return "", err
+	}
+	dst, err := stage(plugin.Name, version, uri, checksum, platform, p, fetcher, opts)
+	if err != nil {
+		return "", err
+	}
+	// The staged version differs from the target when it fell back to HEAD.
+	return filepath.Base(dst), nil
+}
+
+// InstallWithoutLink will download and install a plugin without creating a
+// symlink in the bin path. It returns the path of the plugin executable, e.g.
+// for tools that invoke plugins through their own wrappers.
+func InstallWithoutLink(p environment.Paths, plugin index.Plugin, forceHEAD bool) (string, error) {
+	return InstallWithoutLinkWithOptions(p, plugin, Options{ForceHEAD: forceHEAD})
+}
+
+// InstallWithoutLinkWithOptions is like InstallWithoutLink, configured by
+// opts. opts.Force is ignored.
+func InstallWithoutLinkWithOptions(p environment.Paths, plugin index.Plugin, opts Options) (string, error) {
+	plugin, err := preflight(p, plugin, opts)
+	if err != nil {
+		return "", err
+	}
+	version, uri, checksum, platform, fetcher, err := opts.getDownloadTarget(plugin)
+	if err != nil {
+		return "", err
+	}
+	dst, err := stage(plugin.Name, version, uri, checksum, platform, p, fetcher, opts)
+	if err != nil {
+		return "", err
+	}
+	executable, err := pluginExecutable(dst, platform.Bin)
+	if err != nil {
+		return "", err
+	}
+	if _, err := os.Stat(executable); err != nil {
+		return "", errors.Wrapf(err, "plugin executable (%q) cannot be found in extracted archive", executable)
+	}
+	return executable, nil
+}
+
+// Activate will point the bin symlink of the plugin to the executable of an
+// already staged version. It can be used to switch between staged versions
+// without downloading them again.
+func Activate(p environment.Paths, plugin index.Plugin, version string) error {
+	return ActivateWithOptions(p, plugin, version, Options{})
+}
+
+// ActivateWithOptions is like Activate, configured by opts. The platform of
+// the plugin is matched against opts.OS and opts.Arch, which fall back to the
+// current system. opts.Force is ignored.
+func ActivateWithOptions(p environment.Paths, plugin index.Plugin, version string, opts Options) error {
+	plugin, err := preflight(p, plugin, opts)
 	if err != nil {
 		return err
 	}
-	return install(plugin.Name, version, uri, bin, p, fos)
+	goos, goarch := opts.targetOSArch()
+	platform, ok, err := matchPlatformToSystemEnvs(plugin, goos, goarch)
+	if err != nil {
+		return wrapf(err, "failed to get matching platforms")
+	}
+	if !ok {
+		return errorOfKind(ErrNoMatchingPlatform, "no matching platform found for os=%s arch=%s", goos, goarch)
+	}
+	dst := p.PluginVersionInstallPath(plugin.Name, version)
+	if ok, _, err := readStagedMarker(dst); err != nil {
+		return err
+	} else if !ok {
+		return errorOfKind(ErrNotStaged, "version %s of plugin %q is not staged", version, plugin.Name)
+	}
+	if err := runSkippedPostInstall(plugin.Name, dst, platform, opts); err != nil {
+		return err
+	}
+	return activate(p, plugin.Name, dst, platform, plugin.Spec.Aliases, opts)
+}
+
+func install(plugin, version, uri, checksum string, platform index.Platform, aliases []string, p environment.Paths, fetcher download.Fetcher, opts Options) error {
+	if dst, ok := stagedVersion(p, plugin, version, platform.Bin); ok {
+		logging.V(1).Infof("Version %s of plugin %s is already present, linking it without downloading", version, plugin)
+		if err := runSkippedPostInstall(plugin, dst, platform, opts); err != nil {
+			return err
+		}
+		return activate(p, plugin, dst, platform, aliases, opts)
+	}
+	dst, err := stage(plugin, version, uri, checksum, platform, p, fetcher, opts)
+	if err != nil {
+		return err
+	}
+	return activate(p, plugin, dst, platform, aliases, opts)
+}
+
+// stagedVersion returns the install directory of the version of the plugin if
+// it was completely staged before and still has its executable, e.g. when only
+// the bin symlink was removed. HEAD versions are never reused since HEAD can
+// change.
+func stagedVersion(p environment.Paths, plugin, version, bin string) (string, bool) {
+	if version == headVersion {
+		return "", false
+	}
+	dst := p.PluginVersionInstallPath(plugin, version)
+	if ok, _, err := readStagedMarker(dst); err != nil || !ok {
+		return "", false
+	}
+	executable, err := pluginExecutable(dst, bin)
+	if err != nil {
+		return "", false
+	}
+	if fi, err := os.Stat(executable); err != nil || fi.IsDir() {
+		return "", false
+	}
+	return dst, true
+}
+
+// stage downloads and moves the plugin into its versioned install directory,
+// which is returned.
+func stage(plugin, version, uri, checksum string, platform index.Platform, p environment.Paths, fetcher download.Fetcher, opts Options) (string, error) {
+	downloadPath := pluginDownloadPath(p, plugin)
+	opts.transaction.recordDir(p.PluginInstallPath(plugin))
+	opts.transaction.recordDir(p.PluginVersionInstallPath(plugin, version))
+	dst, err := downloadAndMove(version, uri, checksum, platform, downloadPath, p.StagingPath(), p.PluginInstallPath(plugin), fetcher, opts)
+	if err != nil && opts.canFallBackToHEAD(version, platform, err) {
+		logging.Warningf("Version %s of plugin %q was not found at %q, installing its HEAD version instead. HEAD is NOT verified against the checksum of the pinned version", version, plugin, uri)
+		version, uri, checksum = headVersion, opts.rewriteURL(platform.Head), ""
+		opts.transaction.recordDir(p.PluginVersionInstallPath(plugin, version))
+		dst, err = downloadAndMove(version, uri, checksum, platform, downloadPath, p.StagingPath(), p.PluginInstallPath(plugin), fetcher, opts)
+	}
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to dowload and move plugin %q (version %s) from %q during installation", plugin, version, uri)
+	}
+	if !opts.SkipBinaryFormatCheck {
+		goos, goarch := opts.targetOSArch()
+		if err := checkExecutablesPlatform(dst, platform, goos, goarch); err != nil {
+			os.RemoveAll(dst)
+			return "", errors.Wrapf(err, "plugin %q does not match the platform", plugin)
+		}
+	}
+	var postInstallSkipped bool
+	if platform.PostInstall != "" && !opts.RunPostInstall {
+		logging.Warningf("Skipping post-install script %q of plugin %s, post-install scripts are not enabled. It runs when the version is installed or activated with post-install scripts enabled", platform.PostInstall, plugin)
+		postInstallSkipped = true
+	} else if platform.PostInstall != "" {
+		if err := runPostInstall(plugin, dst, platform.PostInstall, opts); err != nil {
+			// Don't leave a version behind that would be reused without
+			// running the script again.
+			os.RemoveAll(dst)
+			return "", err
+		}
+	}
+	if err := writeStagedMarker(dst, postInstallSkipped); err != nil {
+		os.RemoveAll(dst)
+		return "", err
+	}
+	return dst, nil
+}
+
+// stagedMarker is the file written into a version directory once it is
+// completely staged. A directory without it may be left by an interrupted
+// move or post-install script and is never reused.
+const stagedMarker = ".krew-staged"
+
+// postInstallSkippedMarker is the content of the staged marker of a version
+// whose post-install script was skipped, so that it can run later.
+const postInstallSkippedMarker = "post-install skipped\n"
+
+// writeStagedMarker marks the version directory dst as completely staged,
+// recording whether its post-install script was skipped.
+func writeStagedMarker(dst string, postInstallSkipped bool) error {
+	var content []byte
+	if postInstallSkipped {
+		content = []byte(postInstallSkippedMarker)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dst, stagedMarker), content, 0644); err != nil {
+		return errors.Wrapf(err, "failed to mark %q as staged", dst)
+	}
+	return nil
+}
+
+// readStagedMarker returns whether the version directory dst is completely
+// staged and whether its post-install script was skipped.
+func readStagedMarker(dst string) (staged, postInstallSkipped bool, err error) {
+	b, err := ioutil.ReadFile(filepath.Join(dst, stagedMarker))
+	if os.IsNotExist(err) {
+		return false, false, nil
+	} else if err != nil {
+		return false, false, errors.Wrapf(err, "failed to read staged version path %q", dst)
+	}
+	return true, string(b) == postInstallSkippedMarker, nil
+}
+
+// pluginDownloadPath returns the dir the plugin is downloaded and extracted
+// to. It is in the DownloadPath, which can be relocated to another disk, and
+// kept apart from the staging path the extracted files are moved to.
+func pluginDownloadPath(p environment.Paths, plugin string) string {
+	return filepath.Join(p.DownloadPath(), plugin)
+}
+
+// canFallBackToHEAD returns whether the failed download of the version of the
+// platform can be replaced by its HEAD with o.FallbackToHEAD, which is only
+// the case if the versioned download was not found.
+func (o Options) canFallBackToHEAD(version string, platform index.Platform, err error) bool {
+	if !o.FallbackToHEAD || o.RequireChecksums || o.LocalArchive != "" || version == headVersion || platform.Head == "" {
+		return false
+	}
+	statusErr, ok := errors.Cause(err).(*download.HTTPStatusError)
+	return ok && statusErr.StatusCode == http.StatusNotFound
+}
+
+// activate links the bin of the plugin installed at dst into the bin path
+// under the plugin name and its aliases, and the extra bins under their own
+// names. Links of aliases or extra bins that are no longer declared are
+// removed.
+func activate(p environment.Paths, plugin, dst string, platform index.Platform, aliases []string, opts Options) error {
+	fullPath, err := pluginExecutable(dst, platform.Bin)
+	if err != nil {
+		return err
+	}
+	// The executables to link by command name, besides the plugin itself.
+	commands := make(map[string]string)
+	names := []string{plugin}
+	for _, alias := range aliases {
+		commands[alias] = fullPath
+	}
+	for _, b := range platform.Bins {
+		if commands[b.Name], err = pluginExecutable(dst, b.Path); err != nil {
+			return err
+		}
+	}
+
+	links, err := pluginLinks(p, plugin)
+	if err != nil {
+		return err
+	}
+	wanted := map[string]bool{pluginNameToBin(p.BinPrefix(), plugin, isWindows()): true}
+	if err := checkNotSetuid(fullPath); err != nil {
+		return err
+	}
+	for name, executable := range commands {
+		if err := checkNotSetuid(executable); err != nil {
+			return err
+		}
+		if isReservedName(name) {
+			return errorOfKind(ErrReservedName, "command %q of plugin %q is reserved for krew", name, plugin)
+		}
+		link := pluginNameToBin(p.BinPrefix(), name, isWindows())
+		if !links[link] {
+			if _, err := os.Lstat(filepath.Join(p.BinPath(), link)); err == nil {
+				return errors.Errorf("command %q of plugin %q conflicts with an existing command in %q", name, plugin, p.BinPath())
+			}
+		}
+		wanted[link] = true
+		names = append(names, name)
+	}
+	sort.Strings(names[1:])
+
+	// Restore the replaced links if one of them fails, so that the previous
+	// version stays activated as a whole.
+	var replaced []linkBackup
+	for _, name := range names {
+		executable := fullPath
+		if name != plugin {
+			executable = commands[name]
+		}
+		backup, err := backupLink(filepath.Join(p.BinPath(), pluginNameToBin(p.BinPrefix(), name, isWindows())))
+		if err == nil {
+			err = createOrUpdateLink(p.BinPath(), p.BinPrefix(), executable, name, opts.RelativeBinLinks)
+		}
+		if err != nil {
+			restoreLinks(replaced)
+			return errors.Wrapf(err, "failed to link command %q of plugin %q", name, plugin)
+		}
+		replaced = append(replaced, backup)
+	}
+	opts.transaction.recordLinks(replaced)
+	for link := range links {
+		if wanted[link] {
+			continue
+		}
+		logging.V(2).Infof("Removing link %q of a command that is no longer declared", link)
+		if err := removeLink(filepath.Join(p.BinPath(), link)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// linkBackup is a symlink in the bin path before activate replaced it.
+type linkBackup struct {
+	path string
+	// target is the target of the replaced symlink, or empty if there was
+	// none.
+	target string
 }
 
-func install(plugin, version, uri, bin string, p environment.Paths, fos []index.FileOperation) error {
-	dst, err := downloadAndMove(version, uri, fos, filepath.Join(p.DownloadPath(), plugin), p.PluginInstallPath(plugin))
+// backupLink returns the backup of the symlink at path, which may not exist.
+func backupLink(path string) (linkBackup, error) {
+	fi, err := os.Lstat(path)
+	if os.IsNotExist(err) || (err == nil && fi.Mode()&os.ModeSymlink == 0) {
+		return linkBackup{path: path}, nil
+	} else if err != nil {
+		return linkBackup{}, errors.Wrapf(err, "failed to read the symlink %q", path)
+	}
+	target, err := os.Readlink(path)
 	if err != nil {
-		return errors.Wrap(err, "failed to dowload and move during installation")
+		return linkBackup{}, errors.Wrapf(err, "failed to read the symlink %q", path)
+	}
+	return linkBackup{path: path, target: target}, nil
+}
+
+// restoreLinks restores the backups of links, in reverse order. Failures are
+// only logged, as they happen while handling another error.
+func restoreLinks(backups []linkBackup) {
+	for i := len(backups) - 1; i >= 0; i-- {
+		b := backups[i]
+		var err error
+		if b.target == "" {
+			err = removeLink(b.path)
+		} else {
+			err = replaceLink(b.target, b.path)
+		}
+		if err != nil {
+			logging.Warningf("Failed to restore the symlink %q: %v", b.path, err)
+		}
 	}
+}
 
+// pluginLinks returns the names of the symlinks in the bin path that point
+// into the install directory of the plugin, i.e. its link and the links of
+// its aliases and extra bins.
+func pluginLinks(p environment.Paths, plugin string) (map[string]bool, error) {
+	managed, err := ListManagedSymlinks(p)
+	if err != nil {
+		return nil, err
+	}
+	installPath, err := filepath.Abs(p.PluginInstallPath(plugin))
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the absolute path of %q", p.PluginInstallPath(plugin))
+	}
+	links := make(map[string]bool)
+	for _, l := range managed {
+		if _, ok := pathutil.IsSubPath(installPath, l.Target); ok {
+			links[l.Name] = true
+		}
+	}
+	return links, nil
+}
+
+// ManagedLink is a symlink in the bin path that points into the install
+// directory of a plugin.
+type ManagedLink struct {
+	// Name is the file name of the link in the bin path.
+	Name string
+	// Target is the absolute path the link points to.
+	Target string
+	// Plugin and Version are the plugin and its installed version that
+	// contain the target.
+	Plugin  string
+	Version string
+}
+
+// ListManagedSymlinks returns the symlinks in p.BinPath() with the bin prefix
+// that point into p.InstallPath(), in the order of their names. Other files
+// in the bin path, e.g. executables a user put there, are not returned.
+func ListManagedSymlinks(p environment.Paths) ([]ManagedLink, error) {
+	entries, err := ioutil.ReadDir(p.BinPath())
+	if os.IsNotExist(err) {
+		return nil, nil
+	} else if err != nil {
+		return nil, errors.Wrapf(err, "failed to read bin directory %q", p.BinPath())
+	}
+	installPath, err := filepath.Abs(p.InstallPath())
+	if err != nil {
+		return nil, errors.Wrapf(err, "failed to get the absolute path of %q", p.InstallPath())
+	}
+	var links []ManagedLink
+	for _, e := range entries {
+		if e.Mode()&os.ModeSymlink == 0 || !strings.HasPrefix(e.Name(), p.BinPrefix()) {
+			continue
+		}
+		target, _, err := linkTarget(p.BinPath(), e.Name())
+		if err != nil {
+			return nil, err
+		}
+		// target: {install_path}/{plugin_name}/{version}/...
+		elems, ok := pathutil.IsSubPath(installPath, target)
+		if !ok || len(elems) < 2 {
+			logging.V(4).Infof("Skip symlink %q to %q outside of the install path", e.Name(), target)
+			continue
+		}
+		links = append(links, ManagedLink{Name: e.Name(), Target: target, Plugin: elems[0], Version: elems[1]})
+	}
+	return links, nil
+}
+
+// pluginExecutable returns the path of the bin of the plugin installed at dst,
+// which must not leave dst.
+func pluginExecutable(dst, bin string) (string, error) {
 	subPathAbs, err := filepath.Abs(dst)
 	if err != nil {
-		return errors.Wrapf(err, "failed to get the absolute fullPath of %q", dst)
+		return "", errors.Wrapf(err, "failed to get the absolute fullPath of %q", dst)
 	}
 	fullPath := filepath.Join(dst, filepath.FromSlash(bin))
 	pathAbs, err := filepath.Abs(fullPath)
 	if err != nil {
-		return errors.Wrapf(err, "failed to get the absolute fullPath of %q", fullPath)
+		return "", errors.Wrapf(err, "failed to get the absolute fullPath of %q", fullPath)
 	}
 	if _, ok := pathutil.IsSubPath(subPathAbs, pathAbs); !ok {
-		return errors.Wrapf(err, "the fullPath %q does not extend the sub-fullPath %q", fullPath, dst)
+		return "", errors.Errorf("the fullPath %q does not extend the sub-fullPath %q", fullPath, dst)
 	}
-	return createOrUpdateLink(p.BinPath(), filepath.Join(dst, filepath.FromSlash(bin)), plugin)
+	return fullPath, nil
 }
 
 // Remove will remove a plugin.
 func Remove(p environment.Paths, name string) error {
-	if name == krewPluginName {
-		return errors.New("removing krew is not allowed through krew, see docs for help")
+	name, err := NormalizePluginName(name)
+	if err != nil {
+		return err
+	}
+	if isReservedName(name) {
+		return errorOfKind(ErrReservedName, "removing krew is not allowed through krew, see docs for help")
 	}
-	glog.V(3).Infof("Finding installed version to delete")
-	version, installed, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), name)
+	logging.V(3).Infof("Finding installed version to delete")
+	version, installed, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), name)
 	if err != nil {
 		return errors.Wrap(err, "can't remove plugin")
 	}
 	if !installed {
 		return ErrIsNotInstalled
 	}
-	glog.V(1).Infof("Deleting plugin version %s", version)
-	glog.V(3).Infof("Deleting path %q", p.PluginInstallPath(name))
+	logging.V(1).Infof("Deleting plugin version %s", version)
+	logging.V(3).Infof("Deleting path %q", p.PluginInstallPath(name))
 
-	symlinkPath := filepath.Join(p.BinPath(), pluginNameToBin(name, isWindows()))
+	symlinkPath := filepath.Join(p.BinPath(), pluginNameToBin(p.BinPrefix(), name, isWindows()))
 	if err := removeLink(symlinkPath); err != nil {
 		return errors.Wrap(err, "could not uninstall symlink of plugin")
 	}
-	return os.RemoveAll(p.PluginInstallPath(name))
+	otherLinks, err := pluginLinks(p, name)
+	if err != nil {
+		return errors.Wrap(err, "could not find the alias and extra bin symlinks of plugin")
+	}
+	for link := range otherLinks {
+		if err := removeLink(filepath.Join(p.BinPath(), link)); err != nil {
+			return errors.Wrap(err, "could not uninstall alias or extra bin symlink of plugin")
+		}
+	}
+	if err := os.RemoveAll(p.PluginInstallPath(name)); err != nil {
+		return errors.Wrapf(err, "could not remove plugin directory %q", p.PluginInstallPath(name))
+	}
+	return pruneEmptyDirs(filepath.Dir(p.PluginInstallPath(name)), p.InstallPath())
 }
 
-func createOrUpdateLink(binDir string, binary string, plugin string) error {
-	dst := filepath.Join(binDir, pluginNameToBin(plugin, isWindows()))
+// pruneEmptyDirs removes dir and its parents while they are empty, up to but
+// not including root. Directories outside of root are left untouched.
+func pruneEmptyDirs(dir, root string) error {
+	for {
+		if elems, ok := pathutil.IsSubPath(root, dir); !ok || len(elems) == 0 {
+			return nil
+		}
+		entries, err := ioutil.ReadDir(dir)
+		if os.IsNotExist(err) {
+			dir = filepath.Dir(dir)
+			continue
+		} else if err != nil {
+			return errors.Wrapf(err, "failed to read directory %q", dir)
+		}
+		if len(entries) > 0 {
+			return nil
+		}
+		logging.V(3).Infof("Removing empty directory %q", dir)
+		if err := os.Remove(dir); err != nil {
+			return errors.Wrapf(err, "failed to remove empty directory %q", dir)
+		}
+		dir = filepath.Dir(dir)
+	}
+}
 
-	if err := removeLink(dst); err != nil {
-		return errors.Wrap(err, "failed to remove old symlink")
+// NormalizePluginName trims and lowercases a user supplied plugin name and
+// checks that it is safe to use in file paths, e.g. that it can't contain path
+// separators or "..".
+func NormalizePluginName(name string) (string, error) {
+	normalized := strings.ToLower(strings.TrimSpace(name))
+	if !index.IsSafePluginName(normalized) {
+		return "", errorOfKind(ErrInvalidPluginName, "the plugin name %q is not allowed", name)
+	}
+	return normalized, nil
+}
+
+// createOrUpdateLink links the binary into binDir as the command of the
+// plugin, relative to binDir if relative is set.
+func createOrUpdateLink(binDir, binPrefix, binary, plugin string, relative bool) error {
+	dst := filepath.Join(binDir, pluginNameToBin(binPrefix, plugin, isWindows()))
+
+	if fi, err := os.Lstat(dst); err == nil && fi.Mode()&os.ModeSymlink == 0 {
+		return errors.Errorf("failed to remove old symlink: file %q is not a symlink (mode=%s)", dst, fi.Mode())
 	}
 	if _, err := os.Stat(binary); os.IsNotExist(err) {
 		return errors.Wrapf(err, "can't create symbolic link, source binary (%q) cannot be found in extracted archive", binary)
 	}
 
+	target := binary
+	if relative {
+		rel, err := relativeLinkTarget(binDir, binary)
+		if err != nil {
+			return err
+		}
+		target = rel
+	}
+
 	// Create new
-	glog.V(2).Infof("Creating symlink from %q to %q", binary, dst)
-	if err := os.Symlink(binary, dst); err != nil {
+	logging.V(2).Infof("Creating symlink from %q to %q", target, dst)
+	if err := replaceLink(target, dst); err != nil {
 		return errors.Wrapf(err, "failed to create a symlink form %q to %q", binDir, dst)
 	}
-	glog.V(2).Infof("Created symlink at %q", dst)
+	logging.V(2).Infof("Created symlink at %q", dst)
 
 	return nil
 }
 
+// replaceLink creates or replaces the symlink dst pointing to target. Where
+// renaming over a file is atomic, the link is created under a temporary name
+// and renamed to dst, so dst never goes missing and a link that another
+// process created meanwhile is replaced. On Windows, the old link is removed
+// and, if another process recreated it before the new one was created, removed
+// once more before retrying.
+func replaceLink(target, dst string) error {
+	if runtime.GOOS != "windows" {
+		tmp := filepath.Join(filepath.Dir(dst), fmt.Sprintf(".krew-link-%d-%s", os.Getpid(), filepath.Base(dst)))
+		if err := removeLink(tmp); err != nil {
+			return err
+		}
+		if err := os.Symlink(target, tmp); err != nil {
+			return err
+		}
+		if err := os.Rename(tmp, dst); err != nil {
+			os.Remove(tmp)
+			return err
+		}
+		return nil
+	}
+
+	if err := removeLink(dst); err != nil {
+		return errors.Wrap(err, "failed to remove old symlink")
+	}
+	err := os.Symlink(target, dst)
+	if os.IsExist(err) {
+		logging.V(2).Infof("Symlink %q was recreated concurrently, replacing it", dst)
+		if err := removeLink(dst); err != nil {
+			return errors.Wrap(err, "failed to remove old symlink")
+		}
+		err = os.Symlink(target, dst)
+	}
+	return err
+}
+
+// relativeLinkTarget returns the path of binary relative to the binDir.
+func relativeLinkTarget(binDir, binary string) (string, error) {
+	binDirAbs, err := filepath.Abs(binDir)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get the absolute path of %q", binDir)
+	}
+	binaryAbs, err := filepath.Abs(binary)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get the absolute path of %q", binary)
+	}
+	rel, err := filepath.Rel(binDirAbs, binaryAbs)
+	if err != nil {
+		return "", errors.Wrapf(err, "failed to get the path of %q relative to %q", binary, binDir)
+	}
+	return rel, nil
+}
+
 // removeLink removes a symlink reference if exists.
 func removeLink(path string) error {
 	fi, err := os.Lstat(path)
 	if os.IsNotExist(err) {
-		glog.V(3).Infof("No file found at %q", path)
+		logging.V(3).Infof("No file found at %q", path)
 		return nil
 	} else if err != nil {
 		return errors.Wrapf(err, "failed to read the symlink in %q", path)
@@ -163,7 +971,7 @@ func removeLink(path string) error {
 	if err := os.Remove(path); err != nil {
 		return errors.Wrapf(err, "failed to remove the symlink in %q", path)
 	}
-	glog.V(3).Infof("Removed symlink from %q", path)
+	logging.V(3).Infof("Removed symlink from %q", path)
 	return nil
 }
 
@@ -175,11 +983,12 @@ func isWindows() bool {
 	return goos == "windows"
 }
 
-// pluginNameToBin creates the name of the symlink file for the plugin name.
-// It converts dashes to underscores.
-func pluginNameToBin(name string, isWindows bool) string {
+// pluginNameToBin creates the name of the symlink file for the plugin name
+// using the prefix of the host command (e.g. "kubectl-"). It converts dashes
+// to underscores.
+func pluginNameToBin(prefix, name string, isWindows bool) string {
 	name = strings.Replace(name, "-", "_", -1)
-	name = "kubectl-" + name
+	name = prefix + name
 	if isWindows {
 		name = name + ".exe"
 	}
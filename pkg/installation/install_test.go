@@ -15,14 +15,28 @@
 package installation
 
 import (
+	"archive/tar"
+	"archive/zip"
+	"bytes"
+	"compress/gzip"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
 	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
+	"strings"
 	"testing"
 
+	"github.com/GoogleContainerTools/krew/pkg/download"
+	"github.com/GoogleContainerTools/krew/pkg/environment"
 	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/pkg/errors"
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
 )
 
 func Test_moveTargets(t *testing.T) {
@@ -59,7 +73,7 @@ func Test_moveTargets(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := findMoveTargets(tt.args.fromDir, tt.args.toDir, tt.args.fo)
+			got, err := findMoveTargets(diskSource{}, tt.args.fromDir, tt.args.toDir, tt.args.fo)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("moveTargets() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -118,28 +132,1251 @@ func Test_createOrUpdateLink(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			if err := createOrUpdateLink(tt.args.binDir, tt.args.binary, tt.pluginName); (err != nil) != tt.wantErr {
+			if err := createOrUpdateLink(tt.args.binDir, "kubectl-", tt.args.binary, tt.pluginName, false); (err != nil) != tt.wantErr {
 				t.Errorf("createOrUpdateLink() error = %v, wantErr %v", err, tt.wantErr)
 			}
 		})
 	}
 }
 
+func Test_replaceLink(t *testing.T) {
+	dir, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	dst := filepath.Join(dir, "kubectl-foo")
+
+	for _, target := range []string{"v1", "v2"} {
+		if err := replaceLink(target, dst); err != nil {
+			t.Fatalf("replaceLink(%s) error = %v", target, err)
+		}
+		if got, err := os.Readlink(dst); err != nil || got != target {
+			t.Fatalf("replaceLink(%s) linked to %q (err=%v)", target, got, err)
+		}
+	}
+	entries, err := ioutil.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("replaceLink() left %d files behind, want only the link", len(entries)-1)
+	}
+}
+
+func Test_createOrUpdateLink_notSymlink(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	dst := filepath.Join(p.BinPath(), "kubectl-foo")
+	if err := ioutil.WriteFile(dst, []byte("not a link"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(testdataPath(t), "plugin-foo", "kubectl-foo")
+	if err := createOrUpdateLink(p.BinPath(), p.BinPrefix(), binary, "foo", false); err == nil {
+		t.Fatal("createOrUpdateLink() over a regular file expected error")
+	}
+	if content, err := ioutil.ReadFile(dst); err != nil || string(content) != "not a link" {
+		t.Errorf("regular file was modified: %q, %v", content, err)
+	}
+}
+
+func Test_rewriteURL(t *testing.T) {
+	const uri = "https://github.com/foo/bar/releases/download/v1/bar.tar.gz"
+
+	if got := (Options{}).rewriteURL(uri); got != uri {
+		t.Errorf("rewriteURL() without rewriter = %q, want %q", got, uri)
+	}
+
+	opts := Options{URLRewriter: func(s string) string {
+		return strings.Replace(s, "https://github.com/", "https://mirror.example.com/github/", 1)
+	}}
+	if got, want := opts.rewriteURL(uri), "https://mirror.example.com/github/foo/bar/releases/download/v1/bar.tar.gz"; got != want {
+		t.Errorf("rewriteURL() = %q, want %q", got, want)
+	}
+}
+
+func Test_createOrUpdateLink_relative(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	dir := p.PluginVersionInstallPath("foo", "v1")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	binary := filepath.Join(dir, "kubectl-foo")
+	if err := ioutil.WriteFile(binary, nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := createOrUpdateLink(p.BinPath(), p.BinPrefix(), binary, "foo", true); err != nil {
+		t.Fatalf("createOrUpdateLink() error = %v", err)
+	}
+	link, err := os.Readlink(filepath.Join(p.BinPath(), "kubectl-foo"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if expected := filepath.Join("..", "store", "foo", "v1", "kubectl-foo"); link != expected {
+		t.Fatalf("createOrUpdateLink() linked to %q, want %q", link, expected)
+	}
+	version, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo")
+	if err != nil || !ok || version != "v1" {
+		t.Fatalf("findInstalledPluginVersion() = %q, %v, %v; want v1", version, ok, err)
+	}
+}
+
+func Test_pluginFromURL(t *testing.T) {
+	files := []index.FileOperation{{From: "*", To: "."}}
+	plugin, err := pluginFromURL("foo", "https://example.com/foo.tar.gz", "deadbeef", "kubectl-foo", files)
+	if err != nil {
+		t.Fatalf("pluginFromURL() error = %v", err)
+	}
+	if plugin.Name != "foo" {
+		t.Errorf("pluginFromURL() name = %q, want %q", plugin.Name, "foo")
+	}
+	platform, ok, err := GetMatchingPlatform(plugin)
+	if err != nil || !ok {
+		t.Fatalf("GetMatchingPlatform() found = %v, err = %v; want a matching platform", ok, err)
+	}
+	if platform.URI != "https://example.com/foo.tar.gz" || platform.Sha256 != "deadbeef" || platform.Bin != "kubectl-foo" {
+		t.Errorf("pluginFromURL() synthesized unexpected platform %+v", platform)
+	}
+
+	if _, err := pluginFromURL("../foo", "https://example.com/foo.tar.gz", "deadbeef", "kubectl-foo", files); err == nil {
+		t.Errorf("pluginFromURL() with unsafe name expected error")
+	}
+	if _, err := pluginFromURL("foo", "https://example.com/foo.tar.gz", "", "kubectl-foo", files); err == nil {
+		t.Errorf("pluginFromURL() without checksum expected error")
+	}
+}
+
+func TestActivate(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	plugin := index.Plugin{Spec: index.PluginSpec{Platforms: []index.Platform{{
+		Selector: &v1.LabelSelector{MatchLabels: map[string]string{"os": runtime.GOOS}},
+		Files:    []index.FileOperation{{From: "kubectl-foo", To: "."}},
+		Bin:      "kubectl-foo",
+	}}}}
+	plugin.Name = "foo"
+	for _, version := range []string{"v1", "v2"} {
+		dir := p.PluginVersionInstallPath("foo", version)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "kubectl-foo"), nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeStagedMarker(dir, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, version := range []string{"v1", "v2", "v1"} {
+		if err := Activate(p, plugin, version); err != nil {
+			t.Fatalf("Activate(%s) error = %v", version, err)
+		}
+		got, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo")
+		if err != nil || !ok {
+			t.Fatalf("findInstalledPluginVersion() installed = %v, err = %v", ok, err)
+		}
+		if got != version {
+			t.Fatalf("Activate(%s) activated version %s", version, got)
+		}
+	}
+
+	if err := Activate(p, plugin, "not-staged"); err == nil {
+		t.Fatalf("Activate() with a version that is not staged expected error")
+	}
+
+	otherOS := "linux"
+	if runtime.GOOS == otherOS {
+		otherOS = "darwin"
+	}
+	plugin.Spec.Platforms[0].Selector = &v1.LabelSelector{MatchLabels: map[string]string{"os": otherOS}}
+	if err := Activate(p, plugin, "v2"); errors.Cause(err) != ErrNoMatchingPlatform {
+		t.Fatalf("Activate() of a plugin for os=%s error = %v, want %v", otherOS, err, ErrNoMatchingPlatform)
+	}
+	if err := ActivateWithOptions(p, plugin, "v2", Options{OS: otherOS}); err != nil {
+		t.Fatalf("ActivateWithOptions() with os=%s error = %v", otherOS, err)
+	}
+}
+
+func TestEntryPoints_reservedName(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	krew, err := pluginFromURL("krew", "https://example.invalid/kubectl-krew", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", "kubectl-krew",
+		[]index.FileOperation{{From: "kubectl-krew", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	entryPoints := map[string]func(Options) error{
+		"InstallWithOptions": func(opts Options) error {
+			return InstallWithOptions(p, krew, opts)
+		},
+		"InstallFromReaderWithOptions": func(opts Options) error {
+			return InstallFromReaderWithOptions(p, "krew", "kubectl-krew", strings.NewReader("hello world"), "", "kubectl-krew",
+				[]index.FileOperation{{From: "kubectl-krew", To: "."}}, opts)
+		},
+		"StageWithOptions": func(opts Options) error {
+			_, err := StageWithOptions(p, krew, opts)
+			return err
+		},
+		"InstallWithoutLinkWithOptions": func(opts Options) error {
+			_, err := InstallWithoutLinkWithOptions(p, krew, opts)
+			return err
+		},
+		"ActivateWithOptions": func(opts Options) error {
+			return ActivateWithOptions(p, krew, "v1", opts)
+		},
+		"EnsureWithOptions": func(opts Options) error {
+			_, err := EnsureWithOptions(p, krew, "", opts)
+			return err
+		},
+		"InstallFromLockWithOptions": func(opts Options) error {
+			platform := krew.Spec.Platforms[0]
+			lock := Lock{Plugins: []LockedPlugin{{
+				Name: "krew", Version: platform.Sha256, URI: platform.URI, Checksum: platform.Sha256, Bin: platform.Bin, Files: platform.Files,
+			}}}
+			return InstallFromLockWithOptions(p, lock, opts)
+		},
+	}
+	for name, install := range entryPoints {
+		t.Run(name, func(t *testing.T) {
+			if err := install(Options{}); errors.Cause(err) != ErrReservedName {
+				t.Errorf("%s() error = %v, want %v", name, err, ErrReservedName)
+			}
+			if err := install(Options{AllowReservedName: true, Transport: fakeTransport("hello world")}); errors.Cause(err) == ErrReservedName {
+				t.Errorf("%s() with AllowReservedName error = %v", name, err)
+			}
+		})
+	}
+}
+
+func TestInstallFromReader(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" // "hello world"
+	files := []index.FileOperation{{From: "kubectl-foo", To: "."}}
+	tests := []struct {
+		name        string
+		content     string
+		checksum    string
+		wantVersion string
+		wantErr     bool
+	}{
+		{"verified", "hello world", checksum, checksum, false},
+		{"checksum mismatch", "HELLO WORLD", checksum, "", true},
+		{"without checksum", "hello world", "", headVersion, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := testPaths(t)
+			defer cleanup()
+
+			err := InstallFromReader(p, "foo", "kubectl-foo", strings.NewReader(tt.content), tt.checksum, "kubectl-foo", files)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InstallFromReader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo")
+			if err != nil || !ok {
+				t.Fatalf("findInstalledPluginVersion() installed = %v, err = %v", ok, err)
+			}
+			if got != tt.wantVersion {
+				t.Fatalf("InstallFromReader() installed version %s, want %s", got, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestInstallWithOptions_localArchive(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	tests := []struct {
+		name    string
+		content string
+		skip    bool
+		wantErr bool
+	}{
+		{"verified", "hello world", false, false},
+		{"checksum mismatch", "HELLO WORLD", false, true},
+		{"verification skipped", "HELLO WORLD", true, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := testPaths(t)
+			defer cleanup()
+			archive := filepath.Join(p.BasePath(), "kubectl-foo")
+			if err := ioutil.WriteFile(archive, []byte(tt.content), 0644); err != nil {
+				t.Fatal(err)
+			}
+			plugin, err := pluginFromURL("foo", "https://example.invalid/kubectl-foo", checksum, "kubectl-foo",
+				[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			err = InstallWithOptions(p, plugin, Options{LocalArchive: archive, SkipLocalVerification: tt.skip})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InstallWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err != nil {
+				return
+			}
+			got, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo")
+			if err != nil || !ok || got != checksum {
+				t.Fatalf("findInstalledPluginVersion() = %s, installed = %v, err = %v", got, ok, err)
+			}
+
+			err = InstallWithOptions(p, plugin, Options{Force: true, LocalArchive: archive, SkipLocalVerification: tt.skip, RequireChecksums: true})
+			if tt.skip && err != ErrUnverified {
+				t.Errorf("InstallWithOptions() with RequireChecksums error = %v, want %v", err, ErrUnverified)
+			} else if !tt.skip && err != nil {
+				t.Errorf("InstallWithOptions() of a verified archive with RequireChecksums error = %v", err)
+			}
+		})
+	}
+}
+
+type fakeTransport string
+
+func (f fakeTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	return &http.Response{StatusCode: http.StatusOK, Body: ioutil.NopCloser(strings.NewReader(string(f))), Request: r}, nil
+}
+
+func TestInstallWithOptions_localArchiveWithChecksumsFile(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	archive := filepath.Join(p.BasePath(), "kubectl-foo")
+	if err := ioutil.WriteFile(archive, []byte("hello world"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	plugin, err := pluginFromURL("foo", "https://example.invalid/kubectl-foo", "deadbeef", "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.Spec.Platforms[0].Sha256 = ""
+	plugin.Spec.Platforms[0].Checksums = &index.ChecksumsFile{URI: "https://example.invalid/checksums.txt"}
+
+	for _, skip := range []bool{false, true} {
+		err := InstallWithOptions(p, plugin, Options{
+			LocalArchive:          archive,
+			SkipLocalVerification: skip,
+			Transport:             failingTransport{t},
+		})
+		if errors.Cause(err) != ErrUnverified {
+			t.Errorf("InstallWithOptions(skip=%v) error = %v, want %v", skip, err, ErrUnverified)
+		}
+	}
+}
+
+// failingTransport fails the test on any request.
+type failingTransport struct{ t *testing.T }
+
+func (f failingTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	f.t.Errorf("unexpected request of %q", r.URL)
+	return nil, errors.New("no requests expected")
+}
+
+func TestInstallWithOptions_transport(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	plugin, err := pluginFromURL("foo", "https://example.invalid/kubectl-foo", checksum, "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InstallWithOptions(p, plugin, Options{Transport: fakeTransport("hello world")}); err != nil {
+		t.Fatalf("InstallWithOptions() error = %v", err)
+	}
+	if _, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo"); err != nil || !ok {
+		t.Fatalf("plugin not installed through the transport, err = %v", err)
+	}
+}
+
+func TestInstallWithOptions_size(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	tests := []struct {
+		name    string
+		content string
+		size    int64
+		wantErr bool
+	}{
+		{"matching size", "hello world", 11, false},
+		{"padded download", "hello world" + strings.Repeat("\x00", 1024), 11, true},
+		{"truncated download", "hello", 11, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := testPaths(t)
+			defer cleanup()
+			plugin, err := pluginFromURL("foo", "https://example.invalid/kubectl-foo", checksum, "kubectl-foo",
+				[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			plugin.Spec.Platforms[0].Size = tt.size
+			if err := InstallWithOptions(p, plugin, Options{Transport: fakeTransport(tt.content)}); (err != nil) != tt.wantErr {
+				t.Fatalf("InstallWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstallWithOptions_fallbackToHEAD(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/head/kubectl-foo":
+			w.Write([]byte("hello world"))
+		case "/broken/kubectl-foo":
+			http.Error(w, "broken", http.StatusInternalServerError)
+		default:
+			http.NotFound(w, r)
+		}
+	}))
+	defer server.Close()
+	tests := []struct {
+		name        string
+		uri         string
+		opts        Options
+		wantVersion string
+		wantErr     bool
+	}{
+		{name: "disabled", uri: "/v1/kubectl-foo", wantErr: true},
+		{name: "not found", uri: "/v1/kubectl-foo", opts: Options{FallbackToHEAD: true}, wantVersion: headVersion},
+		{name: "other error", uri: "/broken/kubectl-foo", opts: Options{FallbackToHEAD: true}, wantErr: true},
+		{name: "checksums required", uri: "/v1/kubectl-foo", opts: Options{FallbackToHEAD: true, RequireChecksums: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := testPaths(t)
+			defer cleanup()
+			plugin, err := pluginFromURL("foo", server.URL+tt.uri, "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", "kubectl-foo",
+				[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			plugin.Spec.Platforms[0].Head = server.URL + "/head/kubectl-foo"
+			if err := InstallWithOptions(p, plugin, tt.opts); (err != nil) != tt.wantErr {
+				t.Fatalf("InstallWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+			if version, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo"); err != nil || !ok || version != tt.wantVersion {
+				t.Errorf("installed version = %q (installed %v, err %v), want %q", version, ok, err, tt.wantVersion)
+			}
+		})
+	}
+}
+
+func TestInstallWithOptions_nestedArchives(t *testing.T) {
+	var inner bytes.Buffer
+	gzw := gzip.NewWriter(&inner)
+	tw := tar.NewWriter(gzw)
+	if err := tw.WriteHeader(&tar.Header{Name: "kubectl-foo", Typeflag: tar.TypeReg, Mode: 0755, Size: 3}); err != nil {
+		t.Fatal(err)
+	}
+	tw.Write([]byte("foo"))
+	tw.Close()
+	gzw.Close()
+	var outer bytes.Buffer
+	zw := zip.NewWriter(&outer)
+	w, err := zw.Create("dist/kubectl-foo.tar.gz")
+	if err != nil {
+		t.Fatal(err)
+	}
+	w.Write(inner.Bytes())
+	zw.Close()
+	sum := sha256.Sum256(outer.Bytes())
+	checksum := hex.EncodeToString(sum[:])
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(outer.Bytes())
+	}))
+	defer server.Close()
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	plugin, err := pluginFromURL("foo", server.URL+"/foo.zip", checksum, "kubectl-foo",
+		[]index.FileOperation{{From: "dist/*", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.Spec.Platforms[0].NestedArchives = []string{"dist/kubectl-foo.tar.gz"}
+	if err := InstallWithOptions(p, plugin, Options{}); err != nil {
+		t.Fatalf("InstallWithOptions() error = %v", err)
+	}
+	dst := p.PluginVersionInstallPath("foo", checksum)
+	if content, err := ioutil.ReadFile(filepath.Join(dst, "kubectl-foo")); err != nil || string(content) != "foo" {
+		t.Fatalf("nested executable = %q, %v, want %q", content, err, "foo")
+	}
+	if _, err := os.Stat(filepath.Join(dst, "kubectl-foo.tar.gz")); !os.IsNotExist(err) {
+		t.Errorf("nested archive was installed, err = %v", err)
+	}
+}
+
+func TestInstallWithOptions_keepTempDirs(t *testing.T) {
+	var archive bytes.Buffer
+	zw := zip.NewWriter(&archive)
+	for _, name := range []string{"kubectl-foo", "README"} {
+		w, err := zw.Create(name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		w.Write([]byte(name))
+	}
+	zw.Close()
+	sum := sha256.Sum256(archive.Bytes())
+	checksum := hex.EncodeToString(sum[:])
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(archive.Bytes())
+	}))
+	defer server.Close()
+
+	downloads, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(downloads)
+	os.Setenv("KREW_DOWNLOAD_DIR", downloads)
+	defer os.Unsetenv("KREW_DOWNLOAD_DIR")
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	plugin, err := pluginFromURL("foo", server.URL+"/foo.zip", checksum, "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}, {From: "missing", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := InstallWithOptions(p, plugin, Options{KeepTempDirs: true}); err == nil {
+		t.Fatal("InstallWithOptions() with a missing file expected error")
+	}
+	if _, err := os.Stat(filepath.Join(downloads, "foo", "README")); err != nil {
+		t.Errorf("unmoved file of the archive was not kept in KREW_DOWNLOAD_DIR: %v", err)
+	}
+	staged, err := filepath.Glob(filepath.Join(p.StagingPath(), "krew-temp-move*"))
+	if err != nil || len(staged) != 1 {
+		t.Fatalf("staging dirs = %v, %v, want the failed one to be kept", staged, err)
+	}
+	if _, err := os.Stat(filepath.Join(staged[0], "kubectl-foo")); err != nil {
+		t.Errorf("moved file was not kept in the staging dir: %v", err)
+	}
+
+	plugin.Spec.Platforms[0].Files = plugin.Spec.Platforms[0].Files[:1]
+	if err := InstallWithOptions(p, plugin, Options{}); err != nil {
+		t.Fatalf("InstallWithOptions() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(downloads, "foo")); !os.IsNotExist(err) {
+		t.Errorf("download dir was kept by default, err = %v", err)
+	}
+}
+
+func TestStageWithOptions_targetPlatform(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	plugin, err := pluginFromURL("foo", server.URL+"/kubectl-foo", checksum, "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.Spec.Platforms[0].Selector = &v1.LabelSelector{MatchLabels: map[string]string{"os": "plan9", "arch": "386"}}
+
+	if _, err := Stage(p, plugin, false); err == nil {
+		t.Fatal("Stage() for the current system expected error")
+	}
+	version, err := StageWithOptions(p, plugin, Options{OS: "plan9", Arch: "386"})
+	if err != nil {
+		t.Fatalf("StageWithOptions() error = %v", err)
+	}
+	if version != checksum {
+		t.Errorf("StageWithOptions() = %s, want %s", version, checksum)
+	}
+	if _, err := os.Stat(filepath.Join(p.PluginVersionInstallPath("foo", checksum), "kubectl-foo")); err != nil {
+		t.Errorf("plugin for the target platform not staged: %v", err)
+	}
+}
+
+func TestInstallWithOptions_reservedNames(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	fos := []index.FileOperation{{From: "kubectl-foo", To: "."}}
+
+	tests := []struct {
+		name    string
+		plugin  string
+		aliases []string
+		allow   bool
+		wantErr bool
+	}{
+		{"reserved plugin name", "krew", nil, false, true},
+		{"reserved plugin name allowed", "krew", nil, true, false},
+		{"reserved alias", "foo", []string{"krew"}, false, true},
+		{"reserved alias with allowed name", "foo", []string{"krew"}, true, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := testPaths(t)
+			defer cleanup()
+			plugin, err := pluginFromURL(tt.plugin, server.URL+"/kubectl-foo", checksum, "kubectl-foo", fos)
+			if err != nil {
+				t.Fatal(err)
+			}
+			plugin.Spec.Aliases = tt.aliases
+			err = InstallWithOptions(p, plugin, Options{AllowReservedName: tt.allow})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InstallWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if _, err := os.Lstat(filepath.Join(p.BinPath(), "kubectl-krew")); !os.IsNotExist(err) {
+					t.Errorf("kubectl-krew was linked, err = %v", err)
+				}
+			}
+		})
+	}
+}
+
+func TestInstallWithOptions_integrity(t *testing.T) {
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	tests := []struct {
+		name      string
+		integrity string
+		wantErr   bool
+	}{
+		{"matching digest", "sha512-AAAA sha384-/b2OdaZ/KfcBpOBAOF4uI5hjA+oQI5IRr5B/y7g1eLPkF8txzmRu/QgZ3YwIjeG9", false},
+		{"no matching digest", "sha384-AAAA sha512-AAAA", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := testPaths(t)
+			defer cleanup()
+			plugin, err := pluginFromURL("foo", server.URL+"/kubectl-foo", "deadbeef", "kubectl-foo",
+				[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			plugin.Spec.Platforms[0].Sha256 = ""
+			plugin.Spec.Platforms[0].Integrity = tt.integrity
+			if err := InstallWithOptions(p, plugin, Options{}); (err != nil) != tt.wantErr {
+				t.Fatalf("InstallWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstall_force(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	plugin, err := pluginFromURL("foo", server.URL+"/kubectl-foo",
+		"b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Install(p, plugin, false, false); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if err := Install(p, plugin, false, false); err != ErrIsAlreadyInstalled {
+		t.Fatalf("Install() of installed plugin error = %v, want %v", err, ErrIsAlreadyInstalled)
+	}
+	// A file left by the previous install is removed by the reinstall.
+	stale := filepath.Join(p.PluginInstallPath("foo"), "stale")
+	if err := ioutil.WriteFile(stale, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := Install(p, plugin, false, true); err != nil {
+		t.Fatalf("Install() with force error = %v", err)
+	}
+	if _, err := os.Stat(stale); !os.IsNotExist(err) {
+		t.Fatalf("Install() with force kept file of previous install, stat err = %v", err)
+	}
+	if _, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo"); err != nil || !ok {
+		t.Fatalf("findInstalledPluginVersion() installed = %v, err = %v", ok, err)
+	}
+}
+
+func TestInstall_forceKeepsInstalledVersionOnFailure(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	tests := []struct {
+		name      string
+		installed string
+	}{
+		{"other version", "v1"},
+		{"same version", checksum},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := testPaths(t)
+			defer cleanup()
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte("HELLO WORLD"))
+			}))
+			defer server.Close()
+			plugin, err := pluginFromURL("foo", server.URL+"/kubectl-foo", checksum, "kubectl-foo",
+				[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			dir := p.PluginVersionInstallPath("foo", tt.installed)
+			if err := os.MkdirAll(dir, 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := ioutil.WriteFile(filepath.Join(dir, "kubectl-foo"), []byte("hello world"), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeStagedMarker(dir, false); err != nil {
+				t.Fatal(err)
+			}
+			if err := Activate(p, plugin, tt.installed); err != nil {
+				t.Fatal(err)
+			}
+
+			if err := Install(p, plugin, false, true); err == nil {
+				t.Fatal("forced Install() of a mismatching download expected error")
+			}
+			version, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo")
+			if err != nil || !ok || version != tt.installed {
+				t.Fatalf("findInstalledPluginVersion() = %q, %v, %v, want %s to be kept", version, ok, err, tt.installed)
+			}
+			if content, err := ioutil.ReadFile(filepath.Join(dir, "kubectl-foo")); err != nil || string(content) != "hello world" {
+				t.Errorf("installed executable = %q, %v, want it to be kept", content, err)
+			}
+		})
+	}
+}
+
+func TestInstallWithOptions_forceKrew(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	krew, err := pluginFromURL("krew", "https://example.invalid/kubectl-krew", checksum, "kubectl-krew",
+		[]index.FileOperation{{From: "kubectl-krew", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	opts := Options{AllowReservedName: true, Transport: fakeTransport("hello world")}
+	if err := InstallWithOptions(p, krew, opts); err != nil {
+		t.Fatalf("InstallWithOptions() error = %v", err)
+	}
+	opts.Force = true
+	if err := InstallWithOptions(p, krew, opts); err != nil {
+		t.Fatalf("forced InstallWithOptions() of krew error = %v", err)
+	}
+	if version, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "krew"); err != nil || !ok || version != checksum {
+		t.Errorf("findInstalledPluginVersion() = %q, %v, %v, want %s", version, ok, err, checksum)
+	}
+}
+
+func TestInstall_noFileOperations(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Install() downloaded %s, want it to fail before downloading", r.URL)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	plugin, err := pluginFromURL("foo", server.URL+"/kubectl-foo",
+		"b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.Spec.Platforms[0].Files = nil
+
+	err = Install(p, plugin, false, false)
+	if err == nil || !strings.Contains(err.Error(), "defines no files to install") {
+		t.Fatalf("Install() error = %v, want platform defines no files to install", err)
+	}
+
+	installFake(t, p, "foo", []byte("hello world"))
+	if err := Install(p, plugin, false, true); err == nil {
+		t.Fatal("forced Install() expected error")
+	}
+	if version, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo"); err != nil || !ok || version != "v1" {
+		t.Errorf("findInstalledPluginVersion() = %q, %v, %v, want the installed v1 to be kept", version, ok, err)
+	}
+}
+
+func Test_pruneEmptyDirs(t *testing.T) {
+	root, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+
+	nonEmpty := filepath.Join(root, "a")
+	empty := filepath.Join(nonEmpty, "b", "c")
+	if err := os.MkdirAll(empty, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(nonEmpty, "file"), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := pruneEmptyDirs(filepath.Join(empty, "removed"), root); err != nil {
+		t.Fatalf("pruneEmptyDirs() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(nonEmpty, "b")); !os.IsNotExist(err) {
+		t.Fatalf("pruneEmptyDirs() kept empty directory, stat err = %v", err)
+	}
+	if _, err := os.Stat(nonEmpty); err != nil {
+		t.Fatalf("pruneEmptyDirs() removed non-empty directory, stat err = %v", err)
+	}
+
+	if err := os.Remove(filepath.Join(nonEmpty, "file")); err != nil {
+		t.Fatal(err)
+	}
+	if err := pruneEmptyDirs(nonEmpty, root); err != nil {
+		t.Fatalf("pruneEmptyDirs() error = %v", err)
+	}
+	if _, err := os.Stat(root); err != nil {
+		t.Fatalf("pruneEmptyDirs() removed the root, stat err = %v", err)
+	}
+}
+
+func TestInstallWithoutLink(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	plugin, err := pluginFromURL("foo", server.URL+"/kubectl-foo",
+		"b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", "bin/foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "bin/foo"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	executable, err := InstallWithoutLink(p, plugin, false)
+	if err != nil {
+		t.Fatalf("InstallWithoutLink() error = %v", err)
+	}
+	want := filepath.Join(p.PluginVersionInstallPath("foo", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"), "bin", "foo")
+	if executable != want {
+		t.Fatalf("InstallWithoutLink() = %q, want %q", executable, want)
+	}
+	if content, err := ioutil.ReadFile(executable); err != nil || string(content) != "hello world" {
+		t.Fatalf("InstallWithoutLink() executable content = %q, err = %v", content, err)
+	}
+	if _, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo"); err != nil || ok {
+		t.Fatalf("InstallWithoutLink() created a bin symlink, installed = %v, err = %v", ok, err)
+	}
+}
+
+func TestInstall_reusesPresentVersion(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Errorf("Install() downloaded %s, want the present version to be reused", r.URL)
+		http.NotFound(w, r)
+	}))
+	defer server.Close()
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	plugin, err := pluginFromURL("foo", server.URL+"/kubectl-foo", checksum, "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	dir := p.PluginVersionInstallPath("foo", checksum)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl-foo"), []byte("hello world"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStagedMarker(dir, false); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Install(p, plugin, false, false); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	got, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo")
+	if err != nil || !ok || got != checksum {
+		t.Fatalf("findInstalledPluginVersion() = %s, installed = %v, err = %v", got, ok, err)
+	}
+}
+
+func TestInstall_restagesUnmarkedVersion(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	var downloads int
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		downloads++
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	plugin, err := pluginFromURL("foo", server.URL+"/kubectl-foo", checksum, "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// An interrupted install leaves the executable without the marker.
+	dir := p.PluginVersionInstallPath("foo", checksum)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl-foo"), []byte("partial"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Install(p, plugin, false, false); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if downloads != 1 {
+		t.Fatalf("Install() downloaded %d times, want the unmarked version to be staged again", downloads)
+	}
+	if ok, _, err := readStagedMarker(dir); err != nil || !ok {
+		t.Fatalf("readStagedMarker() = %v, err = %v, want the staged version to be marked", ok, err)
+	}
+}
+
+func TestInstall_aliases(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	plugin, err := pluginFromURL("foo", "https://example.com/kubectl-foo", checksum, "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.Spec.Aliases = []string{"old-foo", "f"}
+	dir := p.PluginVersionInstallPath("foo", checksum)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl-foo"), []byte("hello world"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStagedMarker(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	linkExists := func(name string) bool {
+		_, err := os.Lstat(filepath.Join(p.BinPath(), pluginNameToBin(p.BinPrefix(), name, isWindows())))
+		return err == nil
+	}
+
+	if err := Install(p, plugin, false, false); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	for _, name := range []string{"foo", "old-foo", "f"} {
+		if !linkExists(name) {
+			t.Errorf("Install() did not link %q", name)
+		}
+	}
+
+	plugin.Spec.Aliases = []string{"f"}
+	if err := Activate(p, plugin, checksum); err != nil {
+		t.Fatalf("Activate() error = %v", err)
+	}
+	if linkExists("old-foo") {
+		t.Errorf("Activate() kept the link of alias %q that is no longer declared", "old-foo")
+	}
+
+	if err := Remove(p, "foo"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	for _, name := range []string{"foo", "f"} {
+		if linkExists(name) {
+			t.Errorf("Remove() did not remove the link %q", name)
+		}
+	}
+}
+
+func TestInstall_extraBins(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	plugin, err := pluginFromURL("foo", "https://example.com/kubectl-foo", checksum, "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.Spec.Platforms[0].Bins = []index.ExtraBin{{Name: "foo-helper", Path: "helper/kubectl-foo-helper"}}
+	dir := p.PluginVersionInstallPath("foo", checksum)
+	if err := os.MkdirAll(filepath.Join(dir, "helper"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for _, file := range []string{"kubectl-foo", filepath.Join("helper", "kubectl-foo-helper")} {
+		if err := ioutil.WriteFile(filepath.Join(dir, file), []byte("hello world"), 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := writeStagedMarker(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	helperLink := filepath.Join(p.BinPath(), pluginNameToBin(p.BinPrefix(), "foo-helper", isWindows()))
+
+	if err := Install(p, plugin, false, false); err != nil {
+		t.Fatalf("Install() error = %v", err)
+	}
+	if target, err := os.Readlink(helperLink); err != nil || target != filepath.Join(dir, "helper", "kubectl-foo-helper") {
+		t.Fatalf("Install() linked the extra bin to %q, err = %v", target, err)
+	}
+	if err := Remove(p, "foo"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if _, err := os.Lstat(helperLink); !os.IsNotExist(err) {
+		t.Fatalf("Remove() kept the link of the extra bin, err = %v", err)
+	}
+}
+
+func TestActivate_extraBinFailureKeepsPreviousLinks(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	plugin := index.Plugin{Spec: index.PluginSpec{Platforms: []index.Platform{{
+		Selector: &v1.LabelSelector{MatchLabels: map[string]string{"os": runtime.GOOS}},
+		Files:    []index.FileOperation{{From: "kubectl-foo", To: "."}},
+		Bin:      "kubectl-foo",
+	}}}}
+	plugin.Name = "foo"
+	for _, version := range []string{"v1", "v2"} {
+		dir := p.PluginVersionInstallPath("foo", version)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(filepath.Join(dir, "kubectl-foo"), nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := writeStagedMarker(dir, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := Activate(p, plugin, "v1"); err != nil {
+		t.Fatalf("Activate(v1) error = %v", err)
+	}
+
+	// The extra bin is missing in v2, so its link can't be created.
+	plugin.Spec.Platforms[0].Bins = []index.ExtraBin{{Name: "foo-helper", Path: "kubectl-foo-helper"}}
+	if err := Activate(p, plugin, "v2"); err == nil {
+		t.Fatal("Activate(v2) with a missing extra bin expected error")
+	}
+	got, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo")
+	if err != nil || !ok || got != "v1" {
+		t.Errorf("findInstalledPluginVersion() = %q, %v, %v, want v1 to stay activated", got, ok, err)
+	}
+	helperLink := filepath.Join(p.BinPath(), pluginNameToBin(p.BinPrefix(), "foo-helper", isWindows()))
+	if _, err := os.Lstat(helperLink); !os.IsNotExist(err) {
+		t.Errorf("failed activation left the link of the extra bin, err = %v", err)
+	}
+}
+
+func TestListManagedSymlinks(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	if links, err := ListManagedSymlinks(p); err != nil || len(links) != 0 {
+		t.Fatalf("ListManagedSymlinks() of an empty bin path = %v, %v", links, err)
+	}
+	installFake(t, p, "foo", []byte("foo"))
+	installFake(t, p, "bar", []byte("bar"))
+	// A regular file, a link outside of the install path and a link without
+	// the bin prefix are not managed by krew.
+	if err := ioutil.WriteFile(filepath.Join(p.BinPath(), "kubectl-mine"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(os.TempDir(), filepath.Join(p.BinPath(), "kubectl-elsewhere")); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(filepath.Join(p.PluginVersionInstallPath("foo", "v1"), "foo"), filepath.Join(p.BinPath(), "foo")); err != nil {
+		t.Fatal(err)
+	}
+
+	links, err := ListManagedSymlinks(p)
+	if err != nil {
+		t.Fatalf("ListManagedSymlinks() error = %v", err)
+	}
+	want := []ManagedLink{
+		{
+			Name:    pluginNameToBin(p.BinPrefix(), "bar", isWindows()),
+			Target:  filepath.Join(p.PluginVersionInstallPath("bar", "v1"), "bar"),
+			Plugin:  "bar",
+			Version: "v1",
+		},
+		{
+			Name:    pluginNameToBin(p.BinPrefix(), "foo", isWindows()),
+			Target:  filepath.Join(p.PluginVersionInstallPath("foo", "v1"), "foo"),
+			Plugin:  "foo",
+			Version: "v1",
+		},
+	}
+	if !reflect.DeepEqual(links, want) {
+		t.Errorf("ListManagedSymlinks() = %+v, want %+v", links, want)
+	}
+}
+
+func TestInstall_aliasConflict(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	plugin, err := pluginFromURL("foo", "https://example.com/kubectl-foo", checksum, "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.Spec.Aliases = []string{"bar"}
+	dir := p.PluginVersionInstallPath("foo", checksum)
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(dir, "kubectl-foo"), []byte("hello world"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := writeStagedMarker(dir, false); err != nil {
+		t.Fatal(err)
+	}
+	other := filepath.Join(p.BinPath(), pluginNameToBin(p.BinPrefix(), "bar", isWindows()))
+	if err := os.Symlink(filepath.Join(p.PluginInstallPath("bar"), "kubectl-bar"), other); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := Install(p, plugin, false, false); err == nil {
+		t.Fatal("Install() with an alias of another plugin succeeded, want error")
+	}
+	if target, err := os.Readlink(other); err != nil || target != filepath.Join(p.PluginInstallPath("bar"), "kubectl-bar") {
+		t.Fatalf("Install() changed the link of the other plugin to %q, err = %v", target, err)
+	}
+}
+
+// sequenceFetcher serves the next content on each call to Get.
+type sequenceFetcher struct {
+	contents []string
+	calls    int
+}
+
+func (f *sequenceFetcher) Get(uri string) (io.ReadCloser, error) {
+	content := f.contents[f.calls%len(f.contents)]
+	f.calls++
+	return ioutil.NopCloser(bytes.NewBufferString(content)), nil
+}
+
+func Test_downloadWithChecksum_retries(t *testing.T) {
+	const (
+		uri      = "https://example.com/kubectl-foo"
+		checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9" // "hello world"
+	)
+	tests := []struct {
+		name      string
+		retries   int
+		contents  []string
+		wantCalls int
+		wantErr   bool
+	}{
+		{"no retries by default", 0, []string{"corrupted", "hello world"}, 1, true},
+		{"retry succeeds", 1, []string{"corrupted", "hello world"}, 2, false},
+		{"retry mismatches again", 1, []string{"corrupted", "still corrupted"}, 2, true},
+		{"no retry on match", 3, []string{"hello world"}, 1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir, err := ioutil.TempDir("", "krew-test")
+			if err != nil {
+				t.Fatal(err)
+			}
+			defer os.RemoveAll(dir)
+
+			fetcher := &sequenceFetcher{contents: tt.contents}
+			err = Options{ChecksumMismatchRetries: tt.retries}.downloadWithChecksum(uri, dir, checksum, 0, fetcher, download.Options{})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("downloadWithChecksum() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if fetcher.calls != tt.wantCalls {
+				t.Fatalf("downloadWithChecksum() fetched %d times, want %d", fetcher.calls, tt.wantCalls)
+			}
+		})
+	}
+}
+
+// testPaths returns krew paths rooted at a new temporary directory, with the
+// bin directory created. The returned func removes the directory.
+func testPaths(t *testing.T) (environment.Paths, func()) {
+	root, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	os.Setenv("KREW_ROOT", root)
+	defer os.Unsetenv("KREW_ROOT")
+	p := environment.MustGetKrewPaths()
+	if err := os.MkdirAll(p.BinPath(), 0755); err != nil {
+		t.Fatal(err)
+	}
+	return p, func() { os.RemoveAll(root) }
+}
+
+func TestNormalizePluginName(t *testing.T) {
+	tests := []struct {
+		name    string
+		want    string
+		wantErr bool
+	}{
+		{"foo", "foo", false},
+		{"  foo-bar\n", "foo-bar", false},
+		{"Foo", "foo", false},
+		{"../foo", "", true},
+		{"foo/bar", "", true},
+		{`foo\bar`, "", true},
+		{"", "", true},
+		{"nul", "", true},
+	}
+	for _, tt := range tests {
+		got, err := NormalizePluginName(tt.name)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("NormalizePluginName(%q) error = %v, wantErr %v", tt.name, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("NormalizePluginName(%q) = %q, want %q", tt.name, got, tt.want)
+		}
+	}
+}
+
 func Test_pluginNameToBin(t *testing.T) {
 	tests := []struct {
+		prefix    string
 		name      string
 		isWindows bool
 		want      string
 	}{
-		{"foo", false, "kubectl-foo"},
-		{"foo-bar", false, "kubectl-foo_bar"},
-		{"foo", true, "kubectl-foo.exe"},
-		{"foo-bar", true, "kubectl-foo_bar.exe"},
+		{"kubectl-", "foo", false, "kubectl-foo"},
+		{"kubectl-", "foo-bar", false, "kubectl-foo_bar"},
+		{"kubectl-", "foo", true, "kubectl-foo.exe"},
+		{"kubectl-", "foo-bar", true, "kubectl-foo_bar.exe"},
+		{"oc-", "foo-bar", false, "oc-foo_bar"},
+		{"oc-", "foo", true, "oc-foo.exe"},
 	}
 	for _, tt := range tests {
-		t.Run(tt.name, func(t *testing.T) {
-			if got := pluginNameToBin(tt.name, tt.isWindows); got != tt.want {
-				t.Errorf("pluginNameToBin(%v, %v) = %v; want %v", tt.name, tt.isWindows, got, tt.want)
+		t.Run(tt.prefix+tt.name, func(t *testing.T) {
+			if got := pluginNameToBin(tt.prefix, tt.name, tt.isWindows); got != tt.want {
+				t.Errorf("pluginNameToBin(%v, %v, %v) = %v; want %v", tt.prefix, tt.name, tt.isWindows, got, tt.want)
 			}
 		})
 	}
@@ -0,0 +1,209 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"fmt"
+	"path"
+	"strings"
+
+	"github.com/GoogleContainerTools/krew/pkg/download"
+	"github.com/GoogleContainerTools/krew/pkg/index"
+	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+// LintIssue is a problem found in a plugin manifest.
+type LintIssue struct {
+	// Platform is the index of the platform with the issue, or -1 if the
+	// issue is not specific to a platform.
+	Platform int
+	Message  string
+}
+
+func (i LintIssue) String() string {
+	if i.Platform < 0 {
+		return i.Message
+	}
+	return fmt.Sprintf("platform (%d): %s", i.Platform, i.Message)
+}
+
+// LintPlugin runs all checks on the plugin manifest and returns every issue
+// found, instead of failing on the first one like index.Plugin.Validate.
+func LintPlugin(plugin index.Plugin) []LintIssue {
+	var issues []LintIssue
+	addIssue := func(platform int, format string, args ...interface{}) {
+		issues = append(issues, LintIssue{Platform: platform, Message: fmt.Sprintf(format, args...)})
+	}
+
+	if !index.IsSafePluginName(plugin.Name) {
+		addIssue(-1, "the plugin name %q is not allowed", plugin.Name)
+	}
+	if plugin.Spec.ShortDescription == "" {
+		addIssue(-1, "should have a short description")
+	}
+	if len(plugin.Spec.Platforms) == 0 {
+		addIssue(-1, "should have a platform specified")
+	}
+
+	selectorsCompile := true
+	for i, p := range plugin.Spec.Platforms {
+		if _, err := metav1.LabelSelectorAsSelector(p.Selector); err != nil {
+			selectorsCompile = false
+			addIssue(i, "label selector does not compile: %v", err)
+		} else if err := index.ValidateSelector(p.Selector); err != nil {
+			addIssue(i, "%v", err)
+		}
+		if p.Head == "" && p.URI == "" {
+			addIssue(i, "head or uri has to be set")
+		}
+		if p.Checksums != nil {
+			if p.Sha256 != "" {
+				addIssue(i, "sha256 and checksums file are both set")
+			}
+			if p.URI == "" {
+				addIssue(i, "checksums file is set without an uri")
+			}
+			if p.Checksums.URI == "" {
+				addIssue(i, "checksums file has no uri")
+			}
+		} else if p.URI != "" && p.Sha256 == "" && p.Integrity == "" {
+			addIssue(i, "uri %q has no sha256 checksum", p.URI)
+		}
+		if p.Integrity != "" {
+			if p.Sha256 != "" || p.Checksums != nil {
+				addIssue(i, "integrity is set together with sha256 or a checksums file")
+			}
+			if p.URI == "" {
+				addIssue(i, "integrity is set without an uri")
+			}
+			if _, err := download.NewIntegrityVerifier(p.Integrity); err != nil {
+				addIssue(i, "%v", err)
+			}
+		}
+		if p.Sha256 != "" {
+			if p.URI == "" {
+				addIssue(i, "sha256 is set without an uri")
+			}
+			if msg := lintChecksum(p.Sha256); msg != "" {
+				addIssue(i, "%s", msg)
+			}
+		}
+		if _, err := (Options{}).downloadTimeout(p); err != nil {
+			addIssue(i, "%v", err)
+		}
+		if len(p.Files) == 0 {
+			addIssue(i, "can't have a plugin without specifying file operations")
+		}
+		for _, fo := range p.Files {
+			for _, file := range []string{fo.From, fo.To} {
+				if msg := lintRelativePath(file); msg != "" {
+					addIssue(i, "file operation (from=%q, to=%q): %s", fo.From, fo.To, msg)
+				}
+			}
+			if fo.Rename && path.Clean(fo.To) == "." {
+				addIssue(i, "file operation (from=%q, to=%q): rename needs a target", fo.From, fo.To)
+			}
+		}
+		if p.Bin == "" {
+			addIssue(i, "bin has to be set")
+		} else if msg := lintRelativePath(p.Bin); msg != "" {
+			addIssue(i, "bin %q: %s", p.Bin, msg)
+		} else if len(p.Files) > 0 && !isBinReachable(p.Files, p.Bin) {
+			addIssue(i, "bin %q is not the target of any file operation", p.Bin)
+		}
+		if msg := lintRelativePath(p.PostInstall); msg != "" {
+			addIssue(i, "post-install script %q: %s", p.PostInstall, msg)
+		}
+		for _, b := range p.Bins {
+			if !index.IsSafePluginName(b.Name) {
+				addIssue(i, "the bin name %q is not allowed", b.Name)
+			}
+			if b.Path == "" {
+				addIssue(i, "bin %q has no path", b.Name)
+			} else if msg := lintRelativePath(b.Path); msg != "" {
+				addIssue(i, "bin %q path %q: %s", b.Name, b.Path, msg)
+			} else if len(p.Files) > 0 && !isBinReachable(p.Files, b.Path) {
+				addIssue(i, "bin %q path %q is not the target of any file operation", b.Name, b.Path)
+			}
+		}
+	}
+
+	if selectorsCompile {
+		if err := index.ValidateUniquePlatforms(plugin.Spec.Platforms); err != nil {
+			addIssue(-1, "%v", err)
+		}
+	}
+	return issues
+}
+
+// lintChecksum returns a message if the checksum can not be used to verify a
+// download.
+func lintChecksum(checksum string) string {
+	digests := download.IntegrityDigests(checksum)
+	if len(digests) != 1 {
+		return fmt.Sprintf("checksum %q must be a single digest", checksum)
+	}
+	if _, _, err := download.ParseChecksum(digests[0]); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// lintRelativePath returns a message if path is not a clean path relative to
+// the plugin directory.
+func lintRelativePath(p string) string {
+	if p == "" {
+		return ""
+	}
+	if err := index.CheckRelativePath(p); err != nil {
+		return err.Error()
+	}
+	return ""
+}
+
+// hasGlobMeta reports whether the path contains a glob pattern.
+func hasGlobMeta(p string) bool {
+	return strings.ContainsAny(p, `*?[\`)
+}
+
+// isBinReachable performs a dry-run of the file operations without the
+// archive contents and reports whether any of them can move a file to bin.
+func isBinReachable(fos []index.FileOperation, bin string) bool {
+	for _, fo := range fos {
+		to := path.Clean(fo.To)
+		from := path.Clean(fo.From)
+		// A single file, or the match of a glob with Rename, is renamed to
+		// the target.
+		if to != "." && to == bin && (fo.Rename || !hasGlobMeta(from)) {
+			return true
+		}
+		rest := bin
+		if to != "." {
+			if !strings.HasPrefix(bin, to+"/") {
+				continue
+			}
+			rest = strings.TrimPrefix(bin, to+"/")
+		}
+		// Moving the whole archive keeps its directory structure.
+		if from == "." {
+			return true
+		}
+		first := strings.SplitN(rest, "/", 2)[0]
+		if ok, err := path.Match(path.Base(from), first); err == nil && ok {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,193 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+
+	"k8s.io/apimachinery/pkg/apis/meta/v1"
+)
+
+func TestLintPlugin(t *testing.T) {
+	validPlatform := func(os string) index.Platform {
+		return index.Platform{
+			URI:      "https://example.com/foo.tar.gz",
+			Sha256:   "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+			Selector: &v1.LabelSelector{MatchLabels: map[string]string{"os": os}},
+			Files:    []index.FileOperation{{From: "bin/*", To: "."}},
+			Bin:      "kubectl-foo",
+		}
+	}
+	plugin := func(name string, platforms ...index.Platform) index.Plugin {
+		var p index.Plugin
+		p.Name = name
+		p.Spec.ShortDescription = "short"
+		p.Spec.Platforms = platforms
+		return p
+	}
+
+	tests := []struct {
+		name   string
+		plugin index.Plugin
+		want   []LintIssue
+	}{
+		{
+			name:   "valid plugin",
+			plugin: plugin("foo", validPlatform("linux"), validPlatform("darwin")),
+			want:   nil,
+		},
+		{
+			name: "all issues are reported",
+			plugin: plugin("../foo", index.Platform{
+				URI:      "https://example.com/foo.tar.gz",
+				Selector: &v1.LabelSelector{MatchLabels: map[string]string{"os": "linux"}},
+				Files:    []index.FileOperation{{From: "/bin/*", To: "./out"}},
+				Bin:      "kubectl-foo",
+			}),
+			want: []LintIssue{
+				{-1, `the plugin name "../foo" is not allowed`},
+				{0, `uri "https://example.com/foo.tar.gz" has no sha256 checksum`},
+				{0, `file operation (from="/bin/*", to="./out"): path must be relative`},
+				{0, `file operation (from="/bin/*", to="./out"): path is not clean, should be "out"`},
+				{0, `bin "kubectl-foo" is not the target of any file operation`},
+			},
+		},
+		{
+			name: "unknown selector label",
+			plugin: plugin("foo", index.Platform{
+				URI:      "https://example.com/foo.tar.gz",
+				Sha256:   "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+				Selector: &v1.LabelSelector{MatchLabels: map[string]string{"distro": "alpine"}},
+				Files:    []index.FileOperation{{From: "bin/*", To: "."}},
+				Bin:      "kubectl-foo",
+			}),
+			want: []LintIssue{
+				{0, `unknown label "distro", only os and arch can be selected`},
+			},
+		},
+		{
+			name: "checksums file",
+			plugin: plugin("foo", index.Platform{
+				URI:       "https://example.com/foo.tar.gz",
+				Sha256:    "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+				Checksums: &index.ChecksumsFile{},
+				Selector:  &v1.LabelSelector{MatchLabels: map[string]string{"os": "linux"}},
+				Files:     []index.FileOperation{{From: "bin/*", To: "."}},
+				Bin:       "kubectl-foo",
+			}),
+			want: []LintIssue{
+				{0, "sha256 and checksums file are both set"},
+				{0, "checksums file has no uri"},
+			},
+		},
+		{
+			name: "extra bins",
+			plugin: plugin("foo", index.Platform{
+				URI:      "https://example.com/foo.tar.gz",
+				Sha256:   "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+				Selector: &v1.LabelSelector{MatchLabels: map[string]string{"os": "linux"}},
+				Files:    []index.FileOperation{{From: "bin/kubectl-foo*", To: "."}},
+				Bin:      "kubectl-foo",
+				Bins: []index.ExtraBin{
+					{Name: "foo-helper", Path: "kubectl-foo-helper"},
+					{Name: "../bar", Path: "/kubectl-bar"},
+					{Name: "baz", Path: "sub/kubectl-baz"},
+				},
+			}),
+			want: []LintIssue{
+				{0, `the bin name "../bar" is not allowed`},
+				{0, `bin "../bar" path "/kubectl-bar": path must be relative`},
+				{0, `bin "baz" path "sub/kubectl-baz" is not the target of any file operation`},
+			},
+		},
+		{
+			name: "glob rename",
+			plugin: plugin("foo", index.Platform{
+				URI:      "https://example.com/foo.tar.gz",
+				Sha256:   "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+				Selector: &v1.LabelSelector{MatchLabels: map[string]string{"os": "linux"}},
+				Files: []index.FileOperation{
+					{From: "bin/kubectl-foo-*", To: "kubectl-foo", Rename: true},
+					{From: "lib/*", To: ".", Rename: true},
+				},
+				Bin: "kubectl-foo",
+			}),
+			want: []LintIssue{
+				{0, `file operation (from="lib/*", to="."): rename needs a target`},
+			},
+		},
+		{
+			name:   "ambiguous selectors",
+			plugin: plugin("foo", validPlatform("linux"), validPlatform("linux")),
+			want: []LintIssue{
+				{-1, "platforms (0) and (1) both match os=linux arch=386, selectors must not overlap"},
+			},
+		},
+		{
+			name: "bad selector and checksum",
+			plugin: plugin("foo", index.Platform{
+				URI:     "https://example.com/foo.tar.gz",
+				Sha256:  "md5:abc",
+				Timeout: "-1m",
+				Selector: &v1.LabelSelector{MatchExpressions: []v1.LabelSelectorRequirement{{
+					Key: "os", Operator: "Bogus",
+				}}},
+				Files: []index.FileOperation{{From: "foo", To: "kubectl-foo"}},
+				Bin:   "kubectl-foo",
+			}),
+			want: []LintIssue{
+				{0, `label selector does not compile: "Bogus" is not a valid pod selector operator`},
+				{0, `unsupported checksum algorithm "md5"`},
+				{0, `download timeout "-1m" has to be positive`},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := LintPlugin(tt.plugin); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("LintPlugin() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_isBinReachable(t *testing.T) {
+	tests := []struct {
+		name string
+		fos  []index.FileOperation
+		bin  string
+		want bool
+	}{
+		{"glob into root", []index.FileOperation{{From: "bin/*", To: "."}}, "kubectl-foo", true},
+		{"glob into dir", []index.FileOperation{{From: "bin/*", To: "bin"}}, "bin/kubectl-foo", true},
+		{"glob into dir named like bin", []index.FileOperation{{From: "bin/*", To: "kubectl-foo"}}, "kubectl-foo", false},
+		{"glob rename", []index.FileOperation{{From: "bin/kubectl-foo-*", To: "kubectl-foo", Rename: true}}, "kubectl-foo", true},
+		{"glob does not match", []index.FileOperation{{From: "bin/*.sh", To: "."}}, "kubectl-foo", false},
+		{"rename", []index.FileOperation{{From: "kubectl-foo-linux", To: "kubectl-foo"}}, "kubectl-foo", true},
+		{"directory", []index.FileOperation{{From: "dist/plugin", To: "."}}, "plugin/kubectl-foo", true},
+		{"whole archive", []index.FileOperation{{From: ".", To: "."}}, "a/b/kubectl-foo", true},
+		{"other target dir", []index.FileOperation{{From: "*", To: "lib"}}, "kubectl-foo", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := isBinReachable(tt.fos, tt.bin); got != tt.want {
+				t.Errorf("isBinReachable(%v, %q) = %v, want %v", tt.fos, tt.bin, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,148 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"encoding/json"
+	"io"
+
+	"github.com/GoogleContainerTools/krew/pkg/environment"
+	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
+
+	"github.com/pkg/errors"
+)
+
+// LockFileName is the conventional name of a file with an encoded Lock.
+const LockFileName = "krew.lock"
+
+// Lock pins the exact downloads of a set of plugins, so that InstallFromLock
+// installs the same bytes on every machine.
+type Lock struct {
+	Plugins []LockedPlugin `json:"plugins"`
+}
+
+// LockedPlugin is a plugin pinned to the download of a single version.
+type LockedPlugin struct {
+	Name     string `json:"name"`
+	Version  string `json:"version"`
+	URI      string `json:"uri"`
+	Checksum string `json:"checksum"`
+
+	Bin   string                `json:"bin"`
+	Files []index.FileOperation `json:"files"`
+
+	// MinKrewVersion is the minimum krew version of the manifest, which is
+	// checked again when the lock is installed.
+	MinKrewVersion string `json:"minKrewVersion,omitempty"`
+}
+
+// NewLock pins the installed version of each installed plugin found in
+// plugins, which are usually read from the index. Plugins installed from
+// HEAD can't be pinned and are returned as unpinnable instead. It fails if an
+// installed version is not the version the manifest provides for the current
+// system, e.g. because the index was updated since.
+func NewLock(p environment.Paths, plugins []index.Plugin) (lock Lock, unpinnable []string, err error) {
+	return NewLockWithOptions(p, plugins, Options{})
+}
+
+// NewLockWithOptions is like NewLock, configured by opts, e.g. to resolve the
+// checksums files of the manifests through a mirror.
+func NewLockWithOptions(p environment.Paths, plugins []index.Plugin, opts Options) (lock Lock, unpinnable []string, err error) {
+	manifests := make(map[string]index.Plugin, len(plugins))
+	for _, plugin := range plugins {
+		manifests[plugin.Name] = plugin
+	}
+	err = WalkInstalled(p, func(name, version string, headInstalled bool) error {
+		plugin, ok := manifests[name]
+		if !ok {
+			logging.V(2).Infof("No manifest for installed plugin %s, not locking it", name)
+			return nil
+		}
+		if headInstalled {
+			unpinnable = append(unpinnable, name)
+			return nil
+		}
+		want, _, checksum, platform, _, err := opts.getDownloadTarget(plugin)
+		if err != nil {
+			return wrapf(err, "failed to get the download of plugin %q", name)
+		}
+		if want != version {
+			return errors.Errorf("installed version %s of plugin %q is not the version %s of its manifest", version, name, want)
+		}
+		lock.Plugins = append(lock.Plugins, LockedPlugin{
+			Name:     name,
+			Version:  version,
+			URI:      platform.URI,
+			Checksum: checksum,
+			Bin:      platform.Bin,
+			Files:    platform.Files,
+
+			MinKrewVersion: plugin.Spec.MinKrewVersion,
+		})
+		return nil
+	})
+	return lock, unpinnable, err
+}
+
+// ReadLock decodes a Lock from r.
+func ReadLock(r io.Reader) (Lock, error) {
+	var lock Lock
+	if err := json.NewDecoder(r).Decode(&lock); err != nil {
+		return lock, errors.Wrap(err, "failed to decode the lock")
+	}
+	return lock, nil
+}
+
+// WriteLock encodes the lock to w.
+func WriteLock(w io.Writer, lock Lock) error {
+	b, err := json.MarshalIndent(lock, "", "  ")
+	if err != nil {
+		return errors.Wrap(err, "failed to encode the lock")
+	}
+	_, err = w.Write(append(b, '\n'))
+	return errors.Wrap(err, "failed to write the lock")
+}
+
+// InstallFromLock installs each plugin of the lock at its pinned version,
+// replacing other installed versions. The downloads are verified against the
+// pinned checksums, and the plugins are checked like by Install, e.g. against
+// reserved names. It stops at the first plugin that fails.
+func InstallFromLock(p environment.Paths, lock Lock) error {
+	return InstallFromLockWithOptions(p, lock, Options{})
+}
+
+// InstallFromLockWithOptions is like InstallFromLock, configured by opts.
+// opts.ForceHEAD is ignored since HEAD can't be locked.
+func InstallFromLockWithOptions(p environment.Paths, lock Lock, opts Options) error {
+	for _, locked := range lock.Plugins {
+		if locked.Version == headVersion || locked.Checksum == "" {
+			return errors.Errorf("plugin %q is locked without a checksum, which can't be pinned", locked.Name)
+		}
+		plugin, err := pluginFromURL(locked.Name, locked.URI, locked.Checksum, locked.Bin, locked.Files)
+		if err != nil {
+			return errors.Wrapf(err, "invalid lock of plugin %q", locked.Name)
+		}
+		plugin.Spec.MinKrewVersion = locked.MinKrewVersion
+		changed, err := EnsureWithOptions(p, plugin, locked.Version, opts)
+		if err != nil {
+			return errors.Wrapf(err, "failed to install the locked version of plugin %q", locked.Name)
+		}
+		if changed {
+			logging.V(1).Infof("Installed locked version %s of plugin %s", locked.Version, locked.Name)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,124 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"bytes"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+)
+
+func TestLock(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	fos := []index.FileOperation{{From: "kubectl-foo", To: "."}}
+	foo, err := pluginFromURL("foo", server.URL+"/kubectl-foo", checksum, "kubectl-foo", fos)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := Ensure(p, foo, checksum); err != nil {
+		t.Fatal(err)
+	}
+	headDir := p.PluginVersionInstallPath("bar", headVersion)
+	if err := os.MkdirAll(headDir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(headDir, "kubectl-bar"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := createOrUpdateLink(p.BinPath(), p.BinPrefix(), filepath.Join(headDir, "kubectl-bar"), "bar", false); err != nil {
+		t.Fatal(err)
+	}
+	bar := foo
+	bar.Name = "bar"
+
+	lock, unpinnable, err := NewLock(p, []index.Plugin{foo, bar})
+	if err != nil {
+		t.Fatalf("NewLock() error = %v", err)
+	}
+	if !reflect.DeepEqual(unpinnable, []string{"bar"}) {
+		t.Errorf("NewLock() unpinnable = %v, want [bar]", unpinnable)
+	}
+	want := Lock{Plugins: []LockedPlugin{{
+		Name: "foo", Version: checksum, URI: server.URL + "/kubectl-foo", Checksum: checksum, Bin: "kubectl-foo", Files: fos,
+	}}}
+	if !reflect.DeepEqual(lock, want) {
+		t.Fatalf("NewLock() = %+v, want %+v", lock, want)
+	}
+
+	var buf bytes.Buffer
+	if err := WriteLock(&buf, lock); err != nil {
+		t.Fatal(err)
+	}
+	decoded, err := ReadLock(&buf)
+	if err != nil || !reflect.DeepEqual(decoded, lock) {
+		t.Fatalf("ReadLock(WriteLock()) = %+v, %v, want %+v", decoded, err, lock)
+	}
+
+	if err := Remove(p, "foo"); err != nil {
+		t.Fatal(err)
+	}
+	if err := InstallFromLock(p, decoded); err != nil {
+		t.Fatalf("InstallFromLock() error = %v", err)
+	}
+	if version, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo"); err != nil || !ok || version != checksum {
+		t.Fatalf("installed version = %s (installed=%v, err=%v), want %s", version, ok, err, checksum)
+	}
+
+	mismatch := Lock{Plugins: []LockedPlugin{want.Plugins[0]}}
+	mismatch.Plugins[0].Name = "baz"
+	mismatch.Plugins[0].Checksum = "787ec76dcafd20c1908eb0936a12f91edd105ab5cd7ecc2b1ae2032648345dff"
+	mismatch.Plugins[0].Version = mismatch.Plugins[0].Checksum
+	if err := InstallFromLock(p, mismatch); err == nil {
+		t.Error("InstallFromLock() with a checksum mismatch expected error")
+	}
+	head := Lock{Plugins: []LockedPlugin{{Name: "bar", Version: headVersion, URI: server.URL, Bin: "kubectl-foo", Files: fos}}}
+	if err := InstallFromLock(p, head); err == nil {
+		t.Error("InstallFromLock() of a HEAD version expected error")
+	}
+}
+
+func TestInstallFromLockWithOptions_minKrewVersion(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	lock := Lock{Plugins: []LockedPlugin{{
+		Name: "foo", Version: checksum, URI: "https://example.invalid/kubectl-foo", Checksum: checksum,
+		Bin: "kubectl-foo", Files: []index.FileOperation{{From: "kubectl-foo", To: "."}},
+		MinKrewVersion: "v9.0.0",
+	}}}
+	opts := Options{KrewVersion: "v0.2.1", Transport: fakeTransport("hello world")}
+
+	if err := InstallFromLockWithOptions(p, lock, opts); err == nil || !strings.Contains(err.Error(), "requires krew") {
+		t.Fatalf("InstallFromLockWithOptions() of a plugin for a newer krew error = %v", err)
+	}
+	if _, err := ioutil.ReadDir(p.PluginInstallPath("foo")); !os.IsNotExist(err) {
+		t.Errorf("InstallFromLockWithOptions() staged a version despite the failed check, err = %v", err)
+	}
+}
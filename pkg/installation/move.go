@@ -18,13 +18,17 @@ import (
 	"io"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
+	"sort"
+	"strings"
 	"syscall"
 
+	"github.com/GoogleContainerTools/krew/pkg/download"
 	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
 	"github.com/GoogleContainerTools/krew/pkg/pathutil"
 
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
@@ -32,7 +36,77 @@ type move struct {
 	from, to string
 }
 
-func findMoveTargets(fromDir, toDir string, fo index.FileOperation) ([]move, error) {
+// moveSource is the tree of files the file operations move files out of.
+type moveSource interface {
+	// stat returns whether the path is a directory, or an error if it does
+	// not exist.
+	stat(path string) (isDir bool, err error)
+	// glob returns the sorted paths matching the pattern, like filepath.Glob.
+	glob(pattern string) ([]string, error)
+}
+
+// diskSource is the moveSource of the files on disk.
+type diskSource struct{}
+
+func (diskSource) stat(path string) (bool, error) {
+	fi, err := os.Stat(path)
+	if err != nil {
+		return false, err
+	}
+	return fi.IsDir(), nil
+}
+
+func (diskSource) glob(pattern string) ([]string, error) { return filepath.Glob(pattern) }
+
+// memSource is an in-memory moveSource of the paths under a directory, which
+// maps the absolute paths to whether they are directories. A dry run removes
+// the moved paths from it, like a move removes them from the disk.
+type memSource map[string]bool
+
+func newMemSource(dir string) (memSource, error) {
+	s := memSource{}
+	err := filepath.Walk(dir, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		s[path] = info.IsDir()
+		return nil
+	})
+	return s, errors.Wrapf(err, "failed to list the files of %q", dir)
+}
+
+func (s memSource) stat(path string) (bool, error) {
+	isDir, ok := s[filepath.Clean(path)]
+	if !ok {
+		return false, os.ErrNotExist
+	}
+	return isDir, nil
+}
+
+func (s memSource) glob(pattern string) ([]string, error) {
+	if _, err := filepath.Match(pattern, ""); err != nil {
+		return nil, err
+	}
+	var matches []string
+	for p := range s {
+		if ok, _ := filepath.Match(pattern, p); ok {
+			matches = append(matches, p)
+		}
+	}
+	sort.Strings(matches)
+	return matches, nil
+}
+
+// remove removes the path and everything under it.
+func (s memSource) remove(path string) {
+	for p := range s {
+		if p == path || strings.HasPrefix(p, path+string(filepath.Separator)) {
+			delete(s, p)
+		}
+	}
+}
+
+func findMoveTargets(src moveSource, fromDir, toDir string, fo index.FileOperation) ([]move, error) {
 	if fo.To != filepath.Clean(fo.To) {
 		return nil, errors.Errorf("the provided path is not clean, %q should be %q", fo.To, filepath.Clean(fo.To))
 	}
@@ -41,21 +115,21 @@ func findMoveTargets(fromDir, toDir string, fo index.FileOperation) ([]move, err
 		return nil, errors.Wrap(err, "could not get the relative path for the move src")
 	}
 
-	glog.V(4).Infof("Trying to move single file directly from=%q to=%q with file operation=%#v", fromDir, toDir, fo)
-	if m, ok, err := getDirectMove(fromDir, toDir, fo); err != nil {
+	logging.V(4).Infof("Trying to move single file directly from=%q to=%q with file operation=%#v", fromDir, toDir, fo)
+	if m, ok, err := getDirectMove(src, fromDir, toDir, fo); err != nil {
 		return nil, errors.Wrap(err, "failed to detect single move operation")
 	} else if ok {
-		glog.V(3).Infof("Detected single move from file operation=%#v", fo)
+		logging.V(3).Infof("Detected single move from file operation=%#v", fo)
 		return []move{m}, nil
 	}
 
-	glog.V(4).Infoln("Wasn't a single file, proceeding with Glob move")
+	logging.V(4).Infoln("Wasn't a single file, proceeding with Glob move")
 	newDir, err := filepath.Abs(filepath.Join(filepath.FromSlash(toDir), filepath.FromSlash(fo.To)))
 	if err != nil {
 		return nil, errors.Wrap(err, "could not get the relative path for the move dst")
 	}
 
-	gl, err := filepath.Glob(filepath.Join(filepath.FromSlash(fromDir), filepath.FromSlash(fo.From)))
+	gl, err := src.glob(filepath.Join(filepath.FromSlash(fromDir), filepath.FromSlash(fo.From)))
 	if err != nil {
 		return nil, errors.Wrap(err, "could not get files using a glob string")
 	}
@@ -63,6 +137,21 @@ func findMoveTargets(fromDir, toDir string, fo index.FileOperation) ([]move, err
 		return nil, errors.Errorf("no files in the plugin archive matched the glob pattern=%s", fo.From)
 	}
 
+	if fo.Rename {
+		if filepath.Clean(fo.To) == "." {
+			return nil, errors.Errorf("can't rename the match of glob pattern=%s without a target", fo.From)
+		}
+		if len(gl) != 1 {
+			return nil, errors.Errorf("glob pattern=%s matched %d files, but a rename needs exactly one", fo.From, len(gl))
+		}
+		m := move{from: gl[0], to: newDir}
+		if !isMoveAllowed(fromDir, toDir, m) {
+			return nil, errors.Errorf("can't move, move target %v is not a subpath from=%q, to=%q", m, fromDir, toDir)
+		}
+		logging.V(3).Infof("Renaming the match of glob pattern=%s to %q", fo.From, newDir)
+		return []move{m}, nil
+	}
+
 	var moves []move
 	for _, v := range gl {
 		newPath := filepath.Join(newDir, filepath.Base(filepath.FromSlash(v)))
@@ -76,7 +165,7 @@ func findMoveTargets(fromDir, toDir string, fo index.FileOperation) ([]move, err
 	return moves, nil
 }
 
-func getDirectMove(fromDir, toDir string, fo index.FileOperation) (move, bool, error) {
+func getDirectMove(src moveSource, fromDir, toDir string, fo index.FileOperation) (move, bool, error) {
 	var m move
 	fromDir, err := filepath.Abs(fromDir)
 	if err != nil {
@@ -90,8 +179,7 @@ func getDirectMove(fromDir, toDir string, fo index.FileOperation) (move, bool, e
 
 	// Check is direct file (not a Glob)
 	fromFilePath := filepath.Clean(filepath.Join(fromDir, fo.From))
-	_, err = os.Stat(fromFilePath)
-	if err != nil {
+	if _, err = src.stat(fromFilePath); err != nil {
 		return m, false, nil
 	}
 
@@ -121,27 +209,150 @@ func isMoveAllowed(fromBase, toBase string, m move) bool {
 	return okFrom && okTo
 }
 
+// isResolvedMoveAllowed is like isMoveAllowed, but resolves the symlinks in the
+// parent directories of the move first, so that a symlink in the extracted
+// archive or the target directory can't redirect the move out of bounds.
+func isResolvedMoveAllowed(fromBase, toBase string, m move) (bool, error) {
+	var err error
+	var resolved [4]string
+	for i, p := range []string{fromBase, toBase, filepath.Dir(m.from), filepath.Dir(m.to)} {
+		if resolved[i], err = resolveExistingPath(p); err != nil {
+			return false, err
+		}
+	}
+	return isMoveAllowed(resolved[0], resolved[1], move{from: resolved[2], to: resolved[3]}), nil
+}
+
+// resolveExistingPath resolves the symlinks in the longest existing prefix of
+// the path and appends the rest of it, which can't contain symlinks yet.
+func resolveExistingPath(p string) (string, error) {
+	p, err := filepath.Abs(p)
+	if err != nil {
+		return "", errors.Wrapf(err, "could not get the absolute path of %q", p)
+	}
+	var rest []string
+	for {
+		resolved, err := filepath.EvalSymlinks(p)
+		if err == nil {
+			return filepath.Join(append([]string{resolved}, rest...)...), nil
+		}
+		if !os.IsNotExist(err) {
+			return "", errors.Wrapf(err, "failed to resolve symlinks of %q", p)
+		}
+		parent := filepath.Dir(p)
+		if parent == p {
+			return "", errors.Wrapf(err, "failed to resolve symlinks of %q", p)
+		}
+		rest = append([]string{filepath.Base(p)}, rest...)
+		p = parent
+	}
+}
+
 func moveFiles(fromDir, toDir string, fo index.FileOperation) error {
-	glog.V(4).Infof("Finding move targets from %q to %q with file operation=%#v", fromDir, toDir, fo)
-	moves, err := findMoveTargets(fromDir, toDir, fo)
+	logging.V(4).Infof("Finding move targets from %q to %q with file operation=%#v", fromDir, toDir, fo)
+	moves, err := findMoveTargets(diskSource{}, fromDir, toDir, fo)
 	if err != nil {
 		return errors.Wrap(err, "could not find move targets")
 	}
 
 	for _, m := range moves {
-		glog.V(2).Infof("Move file from %q to %q", m.from, m.to)
+		if ok, err := isResolvedMoveAllowed(fromDir, toDir, m); err != nil {
+			return errors.Wrap(err, "could not check move target")
+		} else if !ok {
+			return errors.Errorf("can't move, move target %v leaves from=%q, to=%q through a symlink", m, fromDir, toDir)
+		}
+		logging.V(2).Infof("Move file from %q to %q", m.from, m.to)
 		if err := os.MkdirAll(filepath.Dir(m.to), 0755); err != nil {
 			return errors.Wrapf(err, "failed to create move path %q", filepath.Dir(m.to))
 		}
 
-		if err = os.Rename(m.from, m.to); err != nil {
+		if err = renameOrCopy(m.from, m.to); err != nil {
 			return errors.Wrapf(err, "could not rename file from %q to %q", m.from, m.to)
 		}
 	}
-	glog.V(4).Infoln("Move operations are complete")
+	logging.V(4).Infoln("Move operations are complete")
 	return nil
 }
 
+// fileOperationsFilter returns a filter that only includes the archive entries
+// the file operations can move: entries matched by a "from" pattern and all
+// entries under a matched directory.
+func fileOperationsFilter(fos []index.FileOperation) download.Filter {
+	var patterns []string
+	for _, fo := range fos {
+		from := path.Clean(filepath.ToSlash(fo.From))
+		if from == "." || from == "/" || strings.HasPrefix(from, "../") || from == ".." {
+			logging.V(4).Infof("File operation from=%q can match any file, extracting all entries", fo.From)
+			return nil
+		}
+		patterns = append(patterns, strings.TrimPrefix(from, "/"))
+	}
+	return func(name string) bool {
+		for _, pattern := range patterns {
+			for prefix := name; prefix != "." && prefix != "/"; prefix = path.Dir(prefix) {
+				if ok, err := path.Match(pattern, prefix); err == nil && ok {
+					return true
+				}
+			}
+		}
+		return false
+	}
+}
+
+// ResolvedMove is a move of a file operation. From is relative to the
+// extracted archive and To is relative to the plugin installation directory.
+type ResolvedMove struct {
+	From, To string
+}
+
+// ResolveFileOperations returns the moves the file operations would perform on
+// the archive already extracted to extractDir, without moving any files. It
+// fails like an install would, e.g. if a pattern matches no files or a target
+// is out of bounds, but reports the failures of all file operations at once.
+// Like an install, files moved by an operation are no longer matched by the
+// later ones.
+func ResolveFileOperations(extractDir string, fos []index.FileOperation) ([]ResolvedMove, error) {
+	fromDir, err := filepath.Abs(extractDir)
+	if err != nil {
+		return nil, errors.Wrapf(err, "could not get the absolute path of %q", extractDir)
+	}
+	// The moves are not performed, the target dir only needs to be absolute.
+	toDir, err := filepath.Abs(filepath.FromSlash("/krew-install"))
+	if err != nil {
+		return nil, errors.Wrap(err, "could not get the absolute path of the install dir")
+	}
+	src, err := newMemSource(fromDir)
+	if err != nil {
+		return nil, err
+	}
+
+	var resolved []ResolvedMove
+	var failures []string
+	for _, fo := range fos {
+		moves, err := findMoveTargets(src, fromDir, toDir, fo)
+		if err != nil {
+			failures = append(failures, errors.Wrapf(err, "file operation (from=%q, to=%q)", fo.From, fo.To).Error())
+			continue
+		}
+		for _, m := range moves {
+			src.remove(m.from)
+			from, err := filepath.Rel(fromDir, m.from)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get the path of %q relative to %q", m.from, fromDir)
+			}
+			to, err := filepath.Rel(toDir, m.to)
+			if err != nil {
+				return nil, errors.Wrapf(err, "failed to get the path of %q relative to %q", m.to, toDir)
+			}
+			resolved = append(resolved, ResolvedMove{From: filepath.ToSlash(from), To: filepath.ToSlash(to)})
+		}
+	}
+	if len(failures) > 0 {
+		return nil, errors.Errorf("could not resolve %d of %d file operations:\n%s", len(failures), len(fos), strings.Join(failures, "\n"))
+	}
+	return resolved, nil
+}
+
 func moveAllFiles(fromDir, toDir string, fos []index.FileOperation) error {
 	for _, fo := range fos {
 		if err := moveFiles(fromDir, toDir, fo); err != nil {
@@ -151,28 +362,31 @@ func moveAllFiles(fromDir, toDir string, fos []index.FileOperation) error {
 	return nil
 }
 
-func moveToInstallDir(download, pluginDir, version string, fos []index.FileOperation) (string, error) {
-	glog.V(4).Infof("Creating plugin dir %q", pluginDir)
+func moveToInstallDir(download, stagingDir, pluginDir, version string, fos []index.FileOperation, keepTemp bool) (string, error) {
+	logging.V(4).Infof("Creating plugin dir %q", pluginDir)
 	if err := os.MkdirAll(pluginDir, 0755); err != nil {
 		return "", errors.Wrapf(err, "error creating path to %q", pluginDir)
 	}
+	if err := os.MkdirAll(stagingDir, 0755); err != nil {
+		return "", errors.Wrapf(err, "error creating staging path %q", stagingDir)
+	}
 
-	tempdir, err := ioutil.TempDir("", "krew-temp-move")
-	glog.V(4).Infof("Creating temp plugin move operations dir %q", tempdir)
+	tempdir, err := ioutil.TempDir(stagingDir, "krew-temp-move")
+	logging.V(4).Infof("Creating temp plugin move operations dir %q", tempdir)
 	if err != nil {
 		return "", errors.Wrap(err, "failed to find a temporary director")
 	}
-	defer os.RemoveAll(tempdir)
+	defer removeTempDir(tempdir, keepTemp)
 
 	if err = moveAllFiles(download, tempdir, fos); err != nil {
-		return "", errors.Wrap(err, "failed to move files")
+		return "", checkRemovedExternally(download, "download", checkRemovedExternally(tempdir, "staging", errors.Wrap(err, "failed to move files")))
 	}
 
 	installPath := filepath.Join(pluginDir, version)
-	glog.V(2).Infof("Move directory %q to %q", tempdir, installPath)
+	logging.V(2).Infof("Move directory %q to %q", tempdir, installPath)
 	if err = moveOrCopyDir(tempdir, installPath); err != nil {
 		defer os.Remove(installPath)
-		return "", errors.Wrapf(err, "could not rename file from %q to %q", tempdir, installPath)
+		return "", checkRemovedExternally(tempdir, "staging", errors.Wrapf(err, "could not rename file from %q to %q", tempdir, installPath))
 	}
 
 	return installPath, nil
@@ -187,24 +401,88 @@ func moveOrCopyDir(from, to string) error {
 		return errors.Wrapf(err, "error checking move target dir %q", to)
 	}
 	if fi != nil && fi.IsDir() {
-		glog.V(4).Infof("There's already a directory at move target %q. deleting.", to)
+		logging.V(4).Infof("There's already a directory at move target %q. deleting.", to)
 		if err := os.RemoveAll(to); err != nil {
 			return errors.Wrapf(err, "error cleaning up dir %q", to)
 		}
-		glog.V(4).Infof("Move target directory %q cleaned up", to)
+		logging.V(4).Infof("Move target directory %q cleaned up", to)
 	}
 
 	err = os.Rename(from, to)
 	// Fallback for invalid cross-device link (errno:18).
 	if le, ok := err.(*os.LinkError); err != nil && ok {
 		if errno, ok := le.Err.(syscall.Errno); ok && errno == 18 {
-			glog.V(4).Infof("Cross-device link error (ERRNO=18), fallback to manual copy")
+			logging.V(4).Infof("Cross-device link error (ERRNO=18), fallback to manual copy")
 			return copyDir(from, to)
 		}
 	}
 	return err
 }
 
+// removeTempDir removes the dir, or logs its location for inspection if keep is
+// set. Dirs that were moved into place are not logged.
+func removeTempDir(dir string, keep bool) {
+	if !keep {
+		os.RemoveAll(dir)
+		return
+	}
+	if _, err := os.Stat(dir); err == nil {
+		logging.Warningf("Keeping temporary directory %q for inspection", dir)
+	}
+}
+
+// checkRemovedExternally returns an error that says the download or staging
+// dir, as named by what, was removed externally, e.g. by a cleaner of
+// temporary files, if it no longer exists, or else err. The raw error of a
+// vanished dir is confusing.
+func checkRemovedExternally(dir, what string, err error) error {
+	if _, statErr := os.Stat(dir); os.IsNotExist(statErr) {
+		return errorOfKind(ErrStagingDirRemoved, "%s directory %q was removed externally", what, dir)
+	}
+	return err
+}
+
+// renameOrCopy renames from to to. If renaming is not possible, e.g. across
+// devices or out of a directory the process can't modify, it copies from
+// instead and removes it if possible.
+func renameOrCopy(from, to string) error {
+	err := os.Rename(from, to)
+	if err == nil || !isRenameUnsupported(err) {
+		return err
+	}
+	logging.V(4).Infof("Renaming failed (%v), fallback to copy", err)
+	fi, err := os.Stat(from)
+	if err != nil {
+		return err
+	}
+	if fi.IsDir() {
+		err = copyDir(from, to)
+	} else {
+		err = copyFile(from, to, fi.Mode())
+	}
+	if err != nil {
+		return errors.Wrap(err, "failed to copy after renaming failed")
+	}
+	if err := os.RemoveAll(from); err != nil {
+		logging.V(4).Infof("Could not remove %q after copying it: %v", from, err)
+	}
+	return nil
+}
+
+// isRenameUnsupported reports whether the rename error is due to the file
+// system rather than the paths, so that copying the file may still work.
+func isRenameUnsupported(err error) bool {
+	le, ok := err.(*os.LinkError)
+	if !ok {
+		return false
+	}
+	switch le.Err {
+	case syscall.EXDEV, syscall.EPERM, syscall.EACCES, syscall.EROFS:
+		return true
+	}
+	return false
+}
+
 func copyDir(from string, to string) (err error) {
 	return filepath.Walk(from, func(path string, info os.FileInfo, err error) error {
 		if err != nil {
@@ -212,10 +490,10 @@ func copyDir(from string, to string) (err error) {
 		}
 		newPath, _ := pathutil.ReplaceBase(path, from, to)
 		if info.IsDir() {
-			glog.V(4).Infof("Creating new dir %q", newPath)
+			logging.V(4).Infof("Creating new dir %q", newPath)
 			err = os.MkdirAll(newPath, info.Mode())
 		} else {
-			glog.V(4).Infof("Copying file %q", newPath)
+			logging.V(4).Infof("Copying file %q", newPath)
 			err = copyFile(path, newPath, info.Mode())
 		}
 		return err
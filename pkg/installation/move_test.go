@@ -15,11 +15,14 @@
 package installation
 
 import (
+	"errors"
 	"fmt"
 	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
+	"strings"
+	"syscall"
 	"testing"
 
 	"github.com/GoogleContainerTools/krew/pkg/index"
@@ -71,6 +74,71 @@ func Test_findMoveTargets(t *testing.T) {
 			}},
 			wantErr: false,
 		},
+		{
+			name: "glob with rename renames single match",
+			args: args{
+				fromDir: filepath.Join(testdataPath(t), "testdir_A"),
+				toDir:   filepath.Join(testdataPath(t), "testdir_B"),
+				fo: index.FileOperation{
+					From:   "not*",
+					To:     "foo",
+					Rename: true,
+				},
+			},
+			want: []move{{
+				from: filepath.Join(testdataPath(t), "testdir_A", "notsecret"),
+				to:   filepath.Join(testdataPath(t), "testdir_B", "foo"),
+			}},
+			wantErr: false,
+		},
+		{
+			name: "glob matching single file moves into dir",
+			args: args{
+				fromDir: filepath.Join(testdataPath(t), "testdir_A"),
+				toDir:   filepath.Join(testdataPath(t), "testdir_B"),
+				fo: index.FileOperation{
+					From: "not*",
+					To:   "foo",
+				},
+			},
+			want: []move{{
+				from: filepath.Join(testdataPath(t), "testdir_A", "notsecret"),
+				to:   filepath.Join(testdataPath(t), "testdir_B", "foo", "notsecret"),
+			}},
+			wantErr: false,
+		},
+		{
+			name: "glob with rename matching multiple files",
+			args: args{
+				fromDir: filepath.Join(testdataPath(t), "testdir_A"),
+				toDir:   filepath.Join(testdataPath(t), "testdir_B"),
+				fo: index.FileOperation{
+					From:   "*",
+					To:     "foo",
+					Rename: true,
+				},
+			},
+			wantErr: true,
+		},
+		{
+			name: "glob matching multiple files moves into dir",
+			args: args{
+				fromDir: filepath.Join(testdataPath(t), "testdir_A"),
+				toDir:   filepath.Join(testdataPath(t), "testdir_B"),
+				fo: index.FileOperation{
+					From: "*",
+					To:   "foo",
+				},
+			},
+			want: []move{{
+				from: filepath.Join(testdataPath(t), "testdir_A", ".secret"),
+				to:   filepath.Join(testdataPath(t), "testdir_B", "foo", ".secret"),
+			}, {
+				from: filepath.Join(testdataPath(t), "testdir_A", "notsecret"),
+				to:   filepath.Join(testdataPath(t), "testdir_B", "foo", "notsecret"),
+			}},
+			wantErr: false,
+		},
 		{
 			name: "glob not matching any files",
 			args: args{
@@ -86,7 +154,7 @@ func Test_findMoveTargets(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, err := findMoveTargets(tt.args.fromDir, tt.args.toDir, tt.args.fo)
+			got, err := findMoveTargets(diskSource{}, tt.args.fromDir, tt.args.toDir, tt.args.fo)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("moveTargets() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -98,6 +166,120 @@ func Test_findMoveTargets(t *testing.T) {
 	}
 }
 
+func TestResolveFileOperations(t *testing.T) {
+	extractDir := filepath.Join(testdataPath(t), "testdir_A")
+	tests := []struct {
+		name    string
+		fos     []index.FileOperation
+		want    []ResolvedMove
+		wantErr bool
+	}{
+		{
+			name: "rename and glob",
+			fos:  []index.FileOperation{{From: ".secret", To: "foo"}, {From: "*", To: "bar"}},
+			want: []ResolvedMove{
+				{From: ".secret", To: "foo"},
+				{From: "notsecret", To: "bar/notsecret"},
+			},
+		},
+		{
+			name:    "file moved by an earlier operation",
+			fos:     []index.FileOperation{{From: "*", To: "."}, {From: "notsecret", To: "foo"}},
+			wantErr: true,
+		},
+		{
+			name:    "glob not matching any files",
+			fos:     []index.FileOperation{{From: "nonexisting-*", To: "."}},
+			wantErr: true,
+		},
+		{
+			name:    "out of bounds",
+			fos:     []index.FileOperation{{From: "notsecret", To: "../foo"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ResolveFileOperations(extractDir, tt.fos)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveFileOperations() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ResolveFileOperations() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestResolveFileOperations_reportsAllFailures(t *testing.T) {
+	fos := []index.FileOperation{
+		{From: "nonexisting-*", To: "."},
+		{From: "notsecret", To: "foo"},
+		{From: "notsecret", To: "../foo"},
+	}
+	_, err := ResolveFileOperations(filepath.Join(testdataPath(t), "testdir_A"), fos)
+	if err == nil {
+		t.Fatal("ResolveFileOperations() expected error")
+	}
+	for _, want := range []string{"could not resolve 2 of 3 file operations", `from="nonexisting-*"`, `to="../foo"`} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("ResolveFileOperations() error = %v, want it to contain %q", err, want)
+		}
+	}
+}
+
+func Test_fileOperationsFilter(t *testing.T) {
+	tests := []struct {
+		name    string
+		fos     []index.FileOperation
+		entries map[string]bool
+		all     bool
+	}{
+		{
+			name: "glob and direct files",
+			fos:  []index.FileOperation{{From: "bin/*"}, {From: "./LICENSE"}},
+			entries: map[string]bool{
+				"bin":         false,
+				"bin/foo":     true,
+				"bin/sub/bar": true,
+				"LICENSE":     true,
+				"README":      false,
+				"doc/LICENSE": false,
+			},
+		},
+		{
+			name: "directory",
+			fos:  []index.FileOperation{{From: "plugin"}},
+			entries: map[string]bool{
+				"plugin":            true,
+				"plugin/kubectl-me": true,
+				"plugins/foo":       false,
+			},
+		},
+		{
+			name: "whole archive",
+			fos:  []index.FileOperation{{From: "bin/*"}, {From: "."}},
+			all:  true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			filter := fileOperationsFilter(tt.fos)
+			if tt.all {
+				if filter != nil {
+					t.Fatalf("fileOperationsFilter() expected to include all entries")
+				}
+				return
+			}
+			for entry, want := range tt.entries {
+				if got := filter(entry); got != want {
+					t.Errorf("fileOperationsFilter()(%q) = %v, want %v", entry, got, want)
+				}
+			}
+		})
+	}
+}
+
 func Test_getDirectMove(t *testing.T) {
 	type args struct {
 		fromDir string
@@ -170,7 +352,7 @@ func Test_getDirectMove(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			got, got1, err := getDirectMove(tt.args.fromDir, tt.args.toDir, tt.args.fo)
+			got, got1, err := getDirectMove(diskSource{}, tt.args.fromDir, tt.args.toDir, tt.args.fo)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("getDirectMove() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -185,6 +367,110 @@ func Test_getDirectMove(t *testing.T) {
 	}
 }
 
+func Test_moveFiles_symlinkedTarget(t *testing.T) {
+	root, err := ioutil.TempDir("", "krew-move-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(root)
+	src, dst, outside := filepath.Join(root, "src"), filepath.Join(root, "dst"), filepath.Join(root, "outside")
+	for _, dir := range []string{src, dst, outside} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := ioutil.WriteFile(filepath.Join(src, "kubectl-foo"), nil, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Symlink(outside, filepath.Join(dst, "escape")); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, to := range []string{"escape", filepath.Join("escape", "sub")} {
+		fo := index.FileOperation{From: "kubectl-foo", To: filepath.Join(to, "kubectl-foo")}
+		if err := moveFiles(src, dst, fo); err == nil {
+			t.Errorf("moveFiles() to %q through a symlink succeeded, want error", fo.To)
+		}
+	}
+	if items, err := ioutil.ReadDir(outside); err != nil || len(items) != 0 {
+		t.Fatalf("moveFiles() wrote %d items outside of the target dir, err = %v", len(items), err)
+	}
+	if err := moveFiles(src, dst, index.FileOperation{From: "kubectl-foo", To: "bin"}); err != nil {
+		t.Fatalf("moveFiles() into the target dir error = %v", err)
+	}
+}
+
+func Test_isRenameUnsupported(t *testing.T) {
+	tests := []struct {
+		err  error
+		want bool
+	}{
+		{&os.LinkError{Op: "rename", Err: syscall.EXDEV}, true},
+		{&os.LinkError{Op: "rename", Err: syscall.EACCES}, true},
+		{&os.LinkError{Op: "rename", Err: syscall.EPERM}, true},
+		{&os.LinkError{Op: "rename", Err: syscall.EROFS}, true},
+		{&os.LinkError{Op: "rename", Err: syscall.ENOENT}, false},
+		{&os.LinkError{Op: "rename", Err: syscall.ENOTEMPTY}, false},
+		{errors.New("other"), false},
+	}
+	for _, tt := range tests {
+		if got := isRenameUnsupported(tt.err); got != tt.want {
+			t.Errorf("isRenameUnsupported(%v) = %v, want %v", tt.err, got, tt.want)
+		}
+	}
+}
+
+func Test_renameOrCopy(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	from, to := filepath.Join(tmp, "from"), filepath.Join(tmp, "to")
+	if err := ioutil.WriteFile(from, []byte("foo"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := renameOrCopy(from, to); err != nil {
+		t.Fatalf("renameOrCopy() error = %v", err)
+	}
+	if content, err := ioutil.ReadFile(to); err != nil || string(content) != "foo" {
+		t.Errorf("renameOrCopy() target = %q, %v", content, err)
+	}
+	if err := renameOrCopy(from, to); err == nil {
+		t.Error("renameOrCopy() of a missing file expected error")
+	}
+}
+
+func Test_moveToInstallDir_downloadRemovedExternally(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	download := filepath.Join(tmp, "download")
+	fos := []index.FileOperation{{From: "*", To: "."}}
+	_, err = moveToInstallDir(download, filepath.Join(tmp, "staging"), filepath.Join(tmp, "store", "foo"), "v1", fos, false)
+	if err == nil || !strings.Contains(err.Error(), "was removed externally") {
+		t.Fatalf("moveToInstallDir() error = %v, want it to say the dir was removed externally", err)
+	}
+}
+
+func Test_checkRemovedExternally(t *testing.T) {
+	tmp, err := ioutil.TempDir("", "krew-test")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(tmp)
+	orig := errors.New("orig")
+	if got := checkRemovedExternally(tmp, "download", orig); got != orig {
+		t.Errorf("checkRemovedExternally() of an existing dir = %v, want %v", got, orig)
+	}
+	missing := filepath.Join(tmp, "missing")
+	if got := checkRemovedExternally(missing, "download", orig); got == nil || !strings.Contains(got.Error(), "download directory") || !strings.Contains(got.Error(), "was removed externally") {
+		t.Errorf("checkRemovedExternally() of a missing dir = %v, want it to say the dir was removed externally", got)
+	}
+}
+
 func Test_moveOrCopyDir_canMoveToNonExistingDir(t *testing.T) {
 	src, err := ioutil.TempDir(os.TempDir(), "krew-move-test-src")
 	if err != nil {
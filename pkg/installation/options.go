@@ -0,0 +1,161 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"net/http"
+	"time"
+
+	"github.com/GoogleContainerTools/krew/pkg/download"
+	"github.com/GoogleContainerTools/krew/pkg/index"
+)
+
+// Options configures the installation of a plugin. The zero value installs
+// the versioned download of the platform matching the current system.
+type Options struct {
+	// ForceHEAD installs the HEAD version of the plugin.
+	ForceHEAD bool
+	// OS and Arch select the platform of the plugin to install instead of the
+	// current system, e.g. to stage plugins for another machine. Unset fields
+	// fall back to the current system, see KREW_OS and KREW_ARCH.
+	OS, Arch string
+	// Force reinstalls an installed plugin instead of returning
+	// ErrIsAlreadyInstalled. Its installed version is only removed once the
+	// new one is activated.
+	Force bool
+	// AllowReservedName installs a plugin named like a command of krew
+	// itself, i.e. krew. It must only be set for trusted manifests, such as
+	// the krew manifest of the index, as the plugin replaces krew.
+	AllowReservedName bool
+	// SkipBinaryFormatCheck installs bins that look like executables for
+	// another OS or arch, e.g. a script that starts like a binary. Scripts are
+	// not checked anyway.
+	SkipBinaryFormatCheck bool
+	// InstallRequired installs the missing plugins required by the plugin,
+	// and their requirements, with the manifests returned by Resolver instead
+	// of failing.
+	InstallRequired bool
+	// Resolver returns the manifest of a required plugin by name, e.g. from
+	// the index. It is only used with InstallRequired.
+	Resolver func(name string) (index.Plugin, error)
+	// requiredBy are the plugins being installed that require the plugin, to
+	// detect dependency cycles.
+	requiredBy []string
+	// transaction records what is created during InstallTransaction, and is
+	// nil otherwise.
+	transaction *transactionLog
+
+	// ChecksumMismatchRetries is the number of times a download is fetched
+	// again when its checksum does not match, e.g. because a corrupted
+	// response was served. Zero means no retries.
+	ChecksumMismatchRetries int
+	// DownloadTimeout is the timeout of plugin downloads, unless their
+	// platform specifies one. Zero means no timeout.
+	DownloadTimeout time.Duration
+	// URLRewriter rewrites the download URLs of plugins before they are
+	// fetched, e.g. to download release assets from an internal mirror.
+	// Downloads are still verified against the checksums in the manifest.
+	URLRewriter func(uri string) string
+	// DownloadRateLimit limits plugin downloads to the number of bytes per
+	// second, e.g. to not saturate the network of shared CI runners. Zero
+	// means no limit.
+	DownloadRateLimit int64
+	// UserAgent is the User-Agent header of download requests instead of
+	// download.DefaultUserAgent().
+	UserAgent string
+	// Transport makes the download requests instead of the default
+	// transport, e.g. for mTLS to an internal mirror.
+	Transport http.RoundTripper
+	// CABundle is the path of a PEM file with CA certificates that downloads
+	// trust besides the system roots, e.g. of an internal mirror. It is not
+	// used with a Transport.
+	CABundle string
+	// RunPostInstall runs the post-install scripts of plugins, which are
+	// skipped with a warning otherwise. A skipped script runs when its staged
+	// version is installed or activated again with RunPostInstall. Scripts are
+	// not sandboxed and run with the privileges of the user.
+	RunPostInstall bool
+	// PostInstallTimeout limits the time a post-install script can run. Zero
+	// means defaultPostInstallTimeout.
+	PostInstallTimeout time.Duration
+	// KeepTempDirs keeps the download and staging dirs of installations
+	// instead of removing them, and logs their locations, e.g. to debug the
+	// file operations of a manifest.
+	KeepTempDirs bool
+	// SelectiveExtraction only extracts the archive entries that the file
+	// operations of the platform can move, e.g. to save disk space for a
+	// large archive of many tools. It has no effect with nested archives or
+	// KeepTempDirs.
+	SelectiveExtraction bool
+	// StrictArchiveEntries, StrictCaseCollisions, StreamArchives and
+	// PreserveModTimes configure the extraction of downloads, see
+	// download.Options.
+	StrictArchiveEntries bool
+	StrictCaseCollisions bool
+	StreamArchives       bool
+	PreserveModTimes     bool
+	// RelativeBinLinks makes the plugin symlinks in the bin path point to the
+	// installation relative to the bin path, so they survive relocating the
+	// krew root (e.g. a bind mount at a different path).
+	RelativeBinLinks bool
+
+	// LocalArchive installs the plugin from the archive at this path instead
+	// of downloading it from its platform, e.g. in air-gapped environments.
+	// The archive is verified like a download unless SkipLocalVerification
+	// is set. Nothing is fetched, so the checksum must be in the manifest
+	// rather than in a checksums file.
+	LocalArchive string
+	// SkipLocalVerification installs a trusted LocalArchive without
+	// verifying it against the checksum of the platform.
+	SkipLocalVerification bool
+	// RequireChecksums fails with ErrUnverified instead of installing a
+	// version without verifying its checksum, i.e. a LocalArchive with
+	// SkipLocalVerification, and disables FallbackToHEAD. A platform without
+	// a checksum is refused either way. HEAD installs, which have no
+	// checksum, are still allowed when HEAD is requested.
+	RequireChecksums bool
+	// FallbackToHEAD installs the HEAD version of the plugin if the download
+	// of its versioned URI is not found, e.g. because the release asset was
+	// deleted upstream. HEAD is not verified, so it is never used together
+	// with RequireChecksums or a LocalArchive.
+	FallbackToHEAD bool
+	// KrewVersion is the version of the running krew that the minKrewVersion
+	// of plugins is checked against. If empty, it is not checked.
+	KrewVersion string
+}
+
+// defaultPostInstallTimeout limits the time a post-install script can run if
+// Options.PostInstallTimeout is not set.
+const defaultPostInstallTimeout = time.Minute
+
+// postInstallTimeout returns o.PostInstallTimeout, or its default if unset.
+func (o Options) postInstallTimeout() time.Duration {
+	if o.PostInstallTimeout == 0 {
+		return defaultPostInstallTimeout
+	}
+	return o.PostInstallTimeout
+}
+
+// downloadOptions returns the options of the download package to extract a
+// download with the filter.
+func (o Options) downloadOptions(filter download.Filter) download.Options {
+	return download.Options{
+		Filter:               filter,
+		StrictArchiveEntries: o.StrictArchiveEntries,
+		StrictCaseCollisions: o.StrictCaseCollisions,
+		StreamArchives:       o.StreamArchives,
+		PreserveModTimes:     o.PreserveModTimes,
+	}
+}
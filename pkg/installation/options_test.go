@@ -0,0 +1,40 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"testing"
+	"time"
+)
+
+func TestOptions_postInstallTimeout(t *testing.T) {
+	if got := (Options{}).postInstallTimeout(); got != defaultPostInstallTimeout {
+		t.Errorf("Options{}.postInstallTimeout() = %s, want %s", got, defaultPostInstallTimeout)
+	}
+	if got := (Options{PostInstallTimeout: time.Second}).postInstallTimeout(); got != time.Second {
+		t.Errorf("postInstallTimeout() = %s, want %s", got, time.Second)
+	}
+}
+
+func TestOptions_downloadOptions(t *testing.T) {
+	opts := Options{StrictArchiveEntries: true, StrictCaseCollisions: true, StreamArchives: true, PreserveModTimes: true}
+	got := opts.downloadOptions(func(string) bool { return false })
+	if !got.StrictArchiveEntries || !got.StrictCaseCollisions || !got.StreamArchives || !got.PreserveModTimes {
+		t.Errorf("downloadOptions() = %+v, want the extraction options of %+v", got, opts)
+	}
+	if got.Filter == nil || got.Filter("foo") {
+		t.Error("downloadOptions() did not keep the filter")
+	}
+}
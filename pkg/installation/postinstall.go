@@ -0,0 +1,111 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"context"
+	"io/ioutil"
+	"os"
+	"os/exec"
+	"path/filepath"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
+	"github.com/GoogleContainerTools/krew/pkg/pathutil"
+
+	"github.com/pkg/errors"
+)
+
+// runPostInstall runs the post-install script of the plugin installed at dst.
+// The script is not sandboxed and runs with the privileges of the user; only
+// its working directory is set to dst, its environment is reduced and it is
+// killed after opts.postInstallTimeout().
+func runPostInstall(plugin, dst, script string, opts Options) error {
+	executable, err := pluginExecutable(dst, script)
+	if err != nil {
+		return errors.Wrapf(err, "invalid post-install script %q", script)
+	}
+	resolvedDst, err := filepath.EvalSymlinks(dst)
+	if err != nil {
+		return errors.Wrapf(err, "failed to resolve symlinks of %q", dst)
+	}
+	resolved, err := filepath.EvalSymlinks(executable)
+	if err != nil {
+		return errors.Wrapf(err, "post-install script %q cannot be found in the installation directory", script)
+	}
+	if _, ok := pathutil.IsSubPath(resolvedDst, resolved); !ok {
+		return errors.Errorf("post-install script %q leaves the installation directory through a symlink", script)
+	}
+
+	// The output is captured in a file rather than a pipe, so that waiting for
+	// a killed script does not wait for children that inherited the pipe.
+	outFile, err := ioutil.TempFile("", "krew-post-install")
+	if err != nil {
+		return errors.Wrap(err, "failed to create file for the post-install script output")
+	}
+	defer os.Remove(outFile.Name())
+	defer outFile.Close()
+
+	ctx, cancel := context.WithTimeout(context.Background(), opts.postInstallTimeout())
+	defer cancel()
+	cmd := exec.CommandContext(ctx, executable)
+	cmd.Dir = dst
+	cmd.Env = postInstallEnv(dst)
+	cmd.Stdout, cmd.Stderr = outFile, outFile
+	logging.V(1).Infof("Running post-install script %q of plugin %s", script, plugin)
+	err = cmd.Run()
+	out, readErr := ioutil.ReadFile(outFile.Name())
+	if readErr != nil {
+		return errors.Wrap(readErr, "failed to read the post-install script output")
+	}
+	logging.V(2).Infof("Output of post-install script %q:\n%s", script, out)
+	if ctx.Err() == context.DeadlineExceeded {
+		return errors.Errorf("post-install script %q of plugin %q did not finish within %s", script, plugin, opts.postInstallTimeout())
+	}
+	if err != nil {
+		return errors.Wrapf(err, "post-install script %q of plugin %q failed, output:\n%s", script, plugin, out)
+	}
+	return nil
+}
+
+// runSkippedPostInstall runs the post-install script of the staged version at
+// dst if it was skipped when the version was staged and post-install scripts
+// are now enabled by the options.
+func runSkippedPostInstall(plugin, dst string, platform index.Platform, opts Options) error {
+	if platform.PostInstall == "" || !opts.RunPostInstall {
+		return nil
+	}
+	_, skipped, err := readStagedMarker(dst)
+	if err != nil || !skipped {
+		return err
+	}
+	logging.V(1).Infof("Running post-install script %q of plugin %s that was skipped when it was staged", platform.PostInstall, plugin)
+	if err := runPostInstall(plugin, dst, platform.PostInstall, opts); err != nil {
+		return err
+	}
+	return writeStagedMarker(dst, false)
+}
+
+// postInstallEnv returns the environment of post-install scripts, which only
+// keeps the variables needed to run programs.
+func postInstallEnv(dst string) []string {
+	env := []string{"KREW_PLUGIN_DIR=" + dst}
+	for _, key := range []string{"PATH", "HOME", "TMPDIR", "SystemRoot", "TEMP"} {
+		if v, ok := os.LookupEnv(key); ok {
+			env = append(env, key+"="+v)
+		}
+	}
+	return env
+}
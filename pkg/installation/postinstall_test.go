@@ -0,0 +1,138 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"runtime"
+	"testing"
+	"time"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+)
+
+func TestInstallWithOptions_postInstall(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("post-install test script is a shell script")
+	}
+	tests := []struct {
+		name       string
+		script     string
+		opts       Options
+		wantMarker bool
+		wantErr    bool
+	}{
+		{
+			name:   "skipped unless enabled",
+			script: "#!/bin/sh\ntouch marker\n",
+		},
+		{
+			name:       "runs in the install dir",
+			script:     "#!/bin/sh\n[ -n \"$KREW_PLUGIN_DIR\" ] && touch marker\n",
+			opts:       Options{RunPostInstall: true},
+			wantMarker: true,
+		},
+		{
+			name:    "fails",
+			script:  "#!/bin/sh\nexit 1\n",
+			opts:    Options{RunPostInstall: true},
+			wantErr: true,
+		},
+		{
+			name:    "times out",
+			script:  "#!/bin/sh\nsleep 5\n",
+			opts:    Options{RunPostInstall: true, PostInstallTimeout: 100 * time.Millisecond},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := testPaths(t)
+			defer cleanup()
+
+			server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Write([]byte(tt.script))
+			}))
+			defer server.Close()
+			sum := sha256.Sum256([]byte(tt.script))
+			plugin, err := pluginFromURL("foo", server.URL+"/kubectl-foo", hex.EncodeToString(sum[:]), "kubectl-foo",
+				[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			plugin.Spec.Platforms[0].PostInstall = "kubectl-foo"
+
+			err = InstallWithOptions(p, plugin, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InstallWithOptions() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			dst := p.PluginVersionInstallPath("foo", hex.EncodeToString(sum[:]))
+			if err != nil {
+				if _, err := os.Stat(dst); !os.IsNotExist(err) {
+					t.Errorf("InstallWithOptions() kept the version of a failed post-install script, stat err = %v", err)
+				}
+				return
+			}
+			_, err = os.Stat(filepath.Join(dst, "marker"))
+			if gotMarker := err == nil; gotMarker != tt.wantMarker {
+				t.Errorf("post-install script ran = %v, want %v", gotMarker, tt.wantMarker)
+			}
+		})
+	}
+}
+
+func TestActivateWithOptions_runsSkippedPostInstall(t *testing.T) {
+	if runtime.GOOS == "windows" {
+		t.Skip("post-install test script is a shell script")
+	}
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	const script = "#!/bin/sh\ntouch marker\n"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(script))
+	}))
+	defer server.Close()
+	sum := sha256.Sum256([]byte(script))
+	version := hex.EncodeToString(sum[:])
+	plugin, err := pluginFromURL("foo", server.URL+"/kubectl-foo", version, "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.Spec.Platforms[0].PostInstall = "kubectl-foo"
+
+	if _, err := StageWithOptions(p, plugin, Options{}); err != nil {
+		t.Fatalf("StageWithOptions() error = %v", err)
+	}
+	dst := p.PluginVersionInstallPath("foo", version)
+	if _, skipped, err := readStagedMarker(dst); err != nil || !skipped {
+		t.Fatalf("readStagedMarker() skipped = %v, err = %v, want the skipped script to be recorded", skipped, err)
+	}
+	if err := ActivateWithOptions(p, plugin, version, Options{RunPostInstall: true}); err != nil {
+		t.Fatalf("ActivateWithOptions() error = %v", err)
+	}
+	if _, err := os.Stat(filepath.Join(dst, "marker")); err != nil {
+		t.Fatalf("ActivateWithOptions() did not run the skipped post-install script, err = %v", err)
+	}
+	if _, skipped, err := readStagedMarker(dst); err != nil || skipped {
+		t.Fatalf("readStagedMarker() skipped = %v, err = %v, want the script to be recorded as run", skipped, err)
+	}
+}
@@ -0,0 +1,80 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"strings"
+
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/krew/pkg/environment"
+	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
+)
+
+// checkKrewVersion returns an error if the plugin requires a newer version of
+// krew than opts.KrewVersion.
+func checkKrewVersion(plugin index.Plugin, opts Options) error {
+	if opts.KrewVersion == "" {
+		return nil
+	}
+	return plugin.CheckKrewVersion(opts.KrewVersion)
+}
+
+// ensureRequired checks that the plugins required by the plugin are installed.
+// If opts.InstallRequired is set, missing plugins are installed first with the
+// manifests returned by opts.Resolver.
+func ensureRequired(p environment.Paths, plugin index.Plugin, opts Options) error {
+	chain := append(append([]string{}, opts.requiredBy...), plugin.Name)
+	for _, name := range plugin.Spec.Requires {
+		for _, c := range chain {
+			if c == name {
+				return errorOfKind(ErrDependencyCycle, "dependency cycle: %s -> %s", strings.Join(chain, " -> "), name)
+			}
+		}
+		_, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), name)
+		if err != nil {
+			return err
+		}
+		if ok {
+			continue
+		}
+		if !opts.InstallRequired || opts.Resolver == nil {
+			return errorOfKind(ErrRequiredNotInstalled, "plugin %s requires %s, which is not installed", plugin.Name, name)
+		}
+		required, err := opts.Resolver(name)
+		if err != nil {
+			return errors.Wrapf(err, "failed to find plugin %s required by %s", name, plugin.Name)
+		}
+		logging.V(1).Infof("Installing plugin %s required by %s", name, plugin.Name)
+		if err := InstallWithOptions(p, required, opts.forRequired(chain)); err != nil {
+			return errors.Wrapf(err, "failed to install plugin %s required by %s", name, plugin.Name)
+		}
+	}
+	return nil
+}
+
+// forRequired returns the options to install a plugin required by the chain of
+// plugins being installed. Options that only apply to the requested plugin are
+// reset.
+func (o Options) forRequired(chain []string) Options {
+	o.ForceHEAD = false
+	o.Force = false
+	o.AllowReservedName = false
+	o.LocalArchive = ""
+	o.SkipLocalVerification = false
+	o.requiredBy = chain
+	return o
+}
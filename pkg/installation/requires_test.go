@@ -0,0 +1,230 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+)
+
+func TestInstallWithOptions_requires(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	newPlugin := func(name string, requires ...string) index.Plugin {
+		bin := "kubectl-" + name
+		plugin, err := pluginFromURL(name, server.URL+"/"+bin, checksum, bin, []index.FileOperation{{From: bin, To: "."}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plugin.Spec.Requires = requires
+		return plugin
+	}
+	manifests := map[string]index.Plugin{
+		"bar":    newPlugin("bar", "baz"),
+		"baz":    newPlugin("baz"),
+		"cyclic": newPlugin("cyclic", "foo"),
+	}
+	resolver := func(name string) (index.Plugin, error) {
+		plugin, ok := manifests[name]
+		if !ok {
+			return index.Plugin{}, errors.Errorf("plugin %s not found", name)
+		}
+		return plugin, nil
+	}
+
+	tests := []struct {
+		name          string
+		plugin        index.Plugin
+		opts          Options
+		preinstalled  []string
+		wantErr       string
+		wantInstalled []string
+	}{
+		{
+			name:          "requirement installed",
+			plugin:        newPlugin("foo", "bar"),
+			preinstalled:  []string{"bar"},
+			wantInstalled: []string{"foo"},
+		},
+		{
+			name:    "requirement missing",
+			plugin:  newPlugin("foo", "bar"),
+			wantErr: "plugin foo requires bar, which is not installed",
+		},
+		{
+			name:    "requirement missing without resolver",
+			plugin:  newPlugin("foo", "bar"),
+			opts:    Options{InstallRequired: true},
+			wantErr: "plugin foo requires bar, which is not installed",
+		},
+		{
+			name:          "installs requirements transitively",
+			plugin:        newPlugin("foo", "bar"),
+			opts:          Options{InstallRequired: true, Resolver: resolver},
+			wantInstalled: []string{"foo", "bar", "baz"},
+		},
+		{
+			name:    "unknown requirement",
+			plugin:  newPlugin("foo", "unknown"),
+			opts:    Options{InstallRequired: true, Resolver: resolver},
+			wantErr: "failed to find plugin unknown required by foo",
+		},
+		{
+			name:    "cycle",
+			plugin:  newPlugin("foo", "cyclic"),
+			opts:    Options{InstallRequired: true, Resolver: resolver},
+			wantErr: "dependency cycle: foo -> cyclic -> foo",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := testPaths(t)
+			defer cleanup()
+			for _, name := range tt.preinstalled {
+				installFake(t, p, name, []byte("hello world"))
+			}
+			err := InstallWithOptions(p, tt.plugin, tt.opts)
+			if tt.wantErr != "" {
+				if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+					t.Fatalf("InstallWithOptions() error = %v, want %q", err, tt.wantErr)
+				}
+				if _, ok, _ := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), tt.plugin.Name); ok {
+					t.Errorf("plugin %s installed despite the error", tt.plugin.Name)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("InstallWithOptions() error = %v", err)
+			}
+			for _, name := range tt.wantInstalled {
+				if _, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), name); err != nil || !ok {
+					t.Errorf("plugin %s not installed, err = %v", name, err)
+				}
+			}
+		})
+	}
+}
+
+func Test_checkKrewVersion(t *testing.T) {
+	var plugin index.Plugin
+	plugin.Spec.MinKrewVersion = "v0.2.0"
+	tests := []struct {
+		name    string
+		opts    Options
+		wantErr bool
+	}{
+		{"not checked", Options{}, false},
+		{"new enough", Options{KrewVersion: "v0.2.0"}, false},
+		{"too old", Options{KrewVersion: "v0.1.9"}, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := checkKrewVersion(plugin, tt.opts); (err != nil) != tt.wantErr {
+				t.Errorf("checkKrewVersion() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestInstallWithOptions_forceKeepsInstalledVersionOnFailedChecks(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	tests := []struct {
+		name   string
+		modify func(*index.Plugin)
+	}{
+		{"requirement missing", func(p *index.Plugin) { p.Spec.Requires = []string{"bar"} }},
+		{"newer krew required", func(p *index.Plugin) { p.Spec.MinKrewVersion = "v9.0.0" }},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := testPaths(t)
+			defer cleanup()
+			installFake(t, p, "foo", []byte("hello world"))
+			plugin, err := pluginFromURL("foo", "https://example.invalid/kubectl-foo", checksum, "kubectl-foo",
+				[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+			if err != nil {
+				t.Fatal(err)
+			}
+			tt.modify(&plugin)
+
+			if err := InstallWithOptions(p, plugin, Options{Force: true, KrewVersion: "v0.2.1"}); err == nil {
+				t.Fatal("InstallWithOptions() expected error")
+			}
+			if version, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo"); err != nil || !ok || version != "v1" {
+				t.Errorf("findInstalledPluginVersion() = %q, %v, %v, want the installed v1 to be kept", version, ok, err)
+			}
+		})
+	}
+}
+
+func TestEntryPoints_requirementChecks(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	plugin, err := pluginFromURL("foo", "https://example.invalid/kubectl-foo", "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9", "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	requiring := plugin
+	requiring.Spec.Requires = []string{"bar"}
+	newer := plugin
+	newer.Spec.MinKrewVersion = "v9.0.0"
+	opts := Options{KrewVersion: "v0.2.1", Transport: fakeTransport("hello world")}
+
+	entryPoints := map[string]func(index.Plugin) error{
+		"InstallWithOptions": func(plugin index.Plugin) error {
+			return InstallWithOptions(p, plugin, opts)
+		},
+		"StageWithOptions": func(plugin index.Plugin) error {
+			_, err := StageWithOptions(p, plugin, opts)
+			return err
+		},
+		"InstallWithoutLinkWithOptions": func(plugin index.Plugin) error {
+			_, err := InstallWithoutLinkWithOptions(p, plugin, opts)
+			return err
+		},
+		"EnsureWithOptions": func(plugin index.Plugin) error {
+			_, err := EnsureWithOptions(p, plugin, "", opts)
+			return err
+		},
+		"UpgradeWithOptions": func(plugin index.Plugin) error {
+			return UpgradeWithOptions(p, plugin, "", opts)
+		},
+	}
+	for name, install := range entryPoints {
+		t.Run(name, func(t *testing.T) {
+			if err := install(requiring); errors.Cause(err) != ErrRequiredNotInstalled {
+				t.Errorf("%s() of a plugin with missing requirements error = %v, want %v", name, err, ErrRequiredNotInstalled)
+			}
+			if err := install(newer); err == nil || !strings.Contains(err.Error(), "requires krew") {
+				t.Errorf("%s() of a plugin for a newer krew error = %v", name, err)
+			}
+		})
+	}
+	if _, err := ioutil.ReadDir(p.PluginInstallPath("foo")); !os.IsNotExist(err) {
+		t.Errorf("a version was staged despite the failed checks, err = %v", err)
+	}
+}
@@ -0,0 +1,101 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"os"
+	"path/filepath"
+
+	"github.com/pkg/errors"
+
+	"github.com/GoogleContainerTools/krew/pkg/environment"
+	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
+)
+
+// InstallTransaction installs the plugins with all-or-nothing semantics. If
+// one of them fails to install, the version dirs and links created during the
+// transaction, including those of required plugins, are removed again.
+// Everything that existed before, e.g. installed plugins and staged versions,
+// is left as it is. opts.Force is not supported, since removed versions could
+// not be restored.
+func InstallTransaction(p environment.Paths, plugins []index.Plugin, opts Options) error {
+	if opts.Force {
+		return errors.New("can't force reinstalls in a transaction")
+	}
+	if err := os.MkdirAll(p.InstallPath(), 0755); err != nil {
+		return errors.Wrapf(err, "failed to create install path %q", p.InstallPath())
+	}
+	log := &transactionLog{}
+	opts.transaction = log
+
+	for _, plugin := range plugins {
+		err := InstallWithOptions(p, plugin, opts)
+		if errors.Cause(err) == ErrIsAlreadyInstalled {
+			logging.V(1).Infof("Plugin %s is already installed", plugin.Name)
+			continue
+		}
+		if err != nil {
+			if rollbackErr := log.rollback(p); rollbackErr != nil {
+				return errors.Wrapf(err, "failed to install plugin %q, and to roll back the transaction: %v", plugin.Name, rollbackErr)
+			}
+			return errors.Wrapf(err, "failed to install plugin %q, rolled back the transaction", plugin.Name)
+		}
+	}
+	return nil
+}
+
+// transactionLog records the dirs and links created by the installations of
+// a transaction, so that a rollback only undoes those. Its methods do nothing
+// on a nil log, i.e. outside of transactions.
+type transactionLog struct {
+	dirs  []string
+	links []linkBackup
+}
+
+// recordDir records dir if it does not exist yet, before it is created.
+func (l *transactionLog) recordDir(dir string) {
+	if l == nil {
+		return
+	}
+	if _, err := os.Lstat(dir); os.IsNotExist(err) {
+		l.dirs = append(l.dirs, dir)
+	}
+}
+
+// recordLinks records the backups of links created or replaced by activate.
+func (l *transactionLog) recordLinks(backups []linkBackup) {
+	if l == nil {
+		return
+	}
+	l.links = append(l.links, backups...)
+}
+
+// rollback restores the recorded links and removes the recorded dirs, in
+// reverse order.
+func (l *transactionLog) rollback(p environment.Paths) error {
+	logging.V(1).Infof("Rolling back %d links and %d dirs created by the transaction", len(l.links), len(l.dirs))
+	restoreLinks(l.links)
+	for i := len(l.dirs) - 1; i >= 0; i-- {
+		dir := l.dirs[i]
+		if err := os.RemoveAll(dir); err != nil {
+			return errors.Wrapf(err, "failed to remove %q", dir)
+		}
+		if err := pruneEmptyDirs(filepath.Dir(dir), p.InstallPath()); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,146 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+)
+
+func TestInstallTransaction(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/kubectl-bad" {
+			w.Write([]byte("HELLO WORLD"))
+			return
+		}
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	newPlugin := func(name string, requires ...string) index.Plugin {
+		bin := "kubectl-" + name
+		plugin, err := pluginFromURL(name, server.URL+"/"+bin, checksum, bin, []index.FileOperation{{From: bin, To: "."}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plugin.Spec.Requires = requires
+		return plugin
+	}
+	resolver := func(name string) (index.Plugin, error) { return newPlugin(name), nil }
+
+	tests := []struct {
+		name          string
+		plugins       []index.Plugin
+		opts          Options
+		wantErr       bool
+		wantInstalled []string
+	}{
+		{
+			name:          "all installed",
+			plugins:       []index.Plugin{newPlugin("foo"), newPlugin("bar"), newPlugin("existing")},
+			wantInstalled: []string{"bar", "existing", "foo"},
+		},
+		{
+			name:          "rolled back",
+			plugins:       []index.Plugin{newPlugin("foo"), newPlugin("bar", "baz"), newPlugin("bad")},
+			opts:          Options{InstallRequired: true, Resolver: resolver},
+			wantErr:       true,
+			wantInstalled: []string{"existing"},
+		},
+		{
+			name:          "force",
+			plugins:       []index.Plugin{newPlugin("foo")},
+			opts:          Options{Force: true},
+			wantErr:       true,
+			wantInstalled: []string{"existing"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p, cleanup := testPaths(t)
+			defer cleanup()
+			installFake(t, p, "existing", []byte("hello world"))
+
+			err := InstallTransaction(p, tt.plugins, tt.opts)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("InstallTransaction() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			installed, err := ListInstalledPlugins(p.InstallPath(), p.BinPath(), p.BinPrefix())
+			if err != nil {
+				t.Fatal(err)
+			}
+			var got []string
+			for name := range installed {
+				got = append(got, name)
+			}
+			sort.Strings(got)
+			if !reflect.DeepEqual(got, tt.wantInstalled) {
+				t.Errorf("installed plugins = %v, want %v", got, tt.wantInstalled)
+			}
+			dirs, err := ioutil.ReadDir(p.InstallPath())
+			if err != nil {
+				t.Fatal(err)
+			}
+			if len(dirs) != len(tt.wantInstalled) {
+				t.Errorf("install dirs = %d, want %d", len(dirs), len(tt.wantInstalled))
+			}
+		})
+	}
+}
+
+func TestInstallTransaction_rollbackKeepsStagedVersion(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/kubectl-bad" {
+			w.Write([]byte("HELLO WORLD"))
+			return
+		}
+		w.Write([]byte("hello world"))
+	}))
+	defer server.Close()
+	var plugins []index.Plugin
+	for _, name := range []string{"foo", "bad"} {
+		bin := "kubectl-" + name
+		plugin, err := pluginFromURL(name, server.URL+"/"+bin, checksum, bin, []index.FileOperation{{From: bin, To: "."}})
+		if err != nil {
+			t.Fatal(err)
+		}
+		plugins = append(plugins, plugin)
+	}
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	if _, err := StageWithOptions(p, plugins[0], Options{}); err != nil {
+		t.Fatalf("StageWithOptions() error = %v", err)
+	}
+
+	if err := InstallTransaction(p, plugins, Options{}); err == nil {
+		t.Fatal("InstallTransaction() with a bad plugin expected error")
+	}
+	if _, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo"); err != nil || ok {
+		t.Fatalf("InstallTransaction() kept the link of rolled back plugin, installed = %v, err = %v", ok, err)
+	}
+	if ok, _, err := readStagedMarker(p.PluginVersionInstallPath("foo", checksum)); err != nil || !ok {
+		t.Fatalf("InstallTransaction() removed the version staged before, staged = %v, err = %v", ok, err)
+	}
+	if _, err := ioutil.ReadDir(p.PluginInstallPath("bad")); err == nil {
+		t.Errorf("InstallTransaction() kept the dir of the plugin that failed to install")
+	}
+}
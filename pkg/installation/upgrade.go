@@ -20,24 +20,36 @@ import (
 
 	"github.com/GoogleContainerTools/krew/pkg/environment"
 	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
 
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 )
 
 // Upgrade will reinstall and delete the old plugin. The operation tries
 // to not get the plugin dir in a bad state if it fails during the process.
 func Upgrade(p environment.Paths, plugin index.Plugin, currentKrewVersion string) error {
-	oldVersion, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), plugin.Name)
+	return UpgradeWithOptions(p, plugin, currentKrewVersion, Options{})
+}
+
+// UpgradeWithOptions is like Upgrade, configured by opts. The new manifest is
+// checked like by InstallWithOptions. HEAD installations are always upgraded
+// to HEAD, so opts.ForceHEAD and opts.Force are ignored.
+func UpgradeWithOptions(p environment.Paths, plugin index.Plugin, currentKrewVersion string, opts Options) error {
+	plugin, err := preflight(p, plugin, opts)
+	if err != nil {
+		return err
+	}
+	oldVersion, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), plugin.Name)
 	if err != nil {
 		return errors.Wrap(err, "could not detect installed plugin oldVersion")
 	}
 	if !ok {
-		return errors.Errorf("can't upgrade plugin %q, it is not installed", plugin.Name)
+		return errorOfKind(ErrIsNotInstalled, "can't upgrade plugin %q, it is not installed", plugin.Name)
 	}
 
 	// Check allowed installation
-	newVersion, uri, fos, binName, err := getDownloadTarget(plugin, oldVersion == headVersion)
+	opts.ForceHEAD = oldVersion == headVersion
+	newVersion, uri, checksum, platform, fetcher, err := opts.getDownloadTarget(plugin)
 	if oldVersion == newVersion && oldVersion != headVersion {
 		return ErrIsAlreadyUpgraded
 	}
@@ -48,7 +60,7 @@ func Upgrade(p environment.Paths, plugin index.Plugin, currentKrewVersion string
 	// Move head to save location
 	if oldVersion == headVersion {
 		oldHEADPath, newHEADPath := p.PluginVersionInstallPath(plugin.Name, headVersion), p.PluginVersionInstallPath(plugin.Name, headOldVersion)
-		glog.V(2).Infof("Move old HEAD from: %q to %q", oldHEADPath, newHEADPath)
+		logging.V(2).Infof("Move old HEAD from: %q to %q", oldHEADPath, newHEADPath)
 		if err = os.Rename(oldHEADPath, newHEADPath); err != nil {
 			return errors.Wrapf(err, "failed to rename HEAD to HEAD-OLD, from %q to %q", oldHEADPath, newHEADPath)
 		}
@@ -56,16 +68,45 @@ func Upgrade(p environment.Paths, plugin index.Plugin, currentKrewVersion string
 	}
 
 	// Re-Install
-	glog.V(1).Infof("Installing new version %s", newVersion)
-	if err := install(plugin.Name, newVersion, uri, binName, p, fos); err != nil {
+	logging.V(1).Infof("Installing new version %s", newVersion)
+	if err := install(plugin.Name, newVersion, uri, checksum, platform, plugin.Spec.Aliases, p, fetcher, opts); err != nil {
 		return errors.Wrap(err, "failed to install new version")
 	}
 
 	// Clean old installations
-	glog.V(4).Infof("Starting old version cleanup")
+	logging.V(4).Infof("Starting old version cleanup")
 	return removePluginVersionFromFS(p, plugin, newVersion, oldVersion, currentKrewVersion)
 }
 
+// UpgradeStatus returns the installed version of the plugin, the version its
+// manifest provides for the current platform and whether upgrading would
+// install the available version, e.g. to report upgrades before running
+// them. HEAD installations are available as HEAD, but are never reported as
+// upgradable since HEAD has no checksum to compare. It returns
+// ErrIsNotInstalled if the plugin is not installed.
+func UpgradeStatus(p environment.Paths, plugin index.Plugin) (installed, available string, upgradable bool, err error) {
+	return UpgradeStatusWithOptions(p, plugin, Options{})
+}
+
+// UpgradeStatusWithOptions is like UpgradeStatus, configured by opts.
+func UpgradeStatusWithOptions(p environment.Paths, plugin index.Plugin, opts Options) (installed, available string, upgradable bool, err error) {
+	installed, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), plugin.Name)
+	if err != nil {
+		return "", "", false, errors.Wrap(err, "could not detect installed plugin version")
+	}
+	if !ok {
+		return "", "", false, ErrIsNotInstalled
+	}
+	if installed == headVersion {
+		return installed, headVersion, false, nil
+	}
+	available, _, _, _, _, err = opts.getDownloadTarget(plugin)
+	if err != nil {
+		return installed, "", false, wrapf(err, "failed to get the available version")
+	}
+	return installed, available, installed != available, nil
+}
+
 // removePluginVersionFromFS will remove a plugin directly if it not krew. Krew on Windows needs special care
 // because active directories can't be deleted. This method will unlink old krew versions and during next run clean
 // the directory.
@@ -74,7 +115,7 @@ func removePluginVersionFromFS(p environment.Paths, plugin index.Plugin, newVers
 	if plugin.Name == krewPluginName {
 		return handleKrewRemove(p, plugin, newVersion, oldVersion, currentKrewVersion)
 	}
-	glog.V(1).Infof("Remove old plugin installation under %q", p.PluginVersionInstallPath(plugin.Name, oldVersion))
+	logging.V(1).Infof("Remove old plugin installation under %q", p.PluginVersionInstallPath(plugin.Name, oldVersion))
 	return os.RemoveAll(p.PluginVersionInstallPath(plugin.Name, oldVersion))
 }
 
@@ -91,12 +132,12 @@ func handleKrewRemove(p environment.Paths, plugin index.Plugin, newVersion, oldV
 		}
 		// Delete old dir
 		if f.Name() != newVersion && f.Name() != currentKrewVersion {
-			glog.V(1).Infof("Remove old krew installation under %q", pluginVersionPath)
+			logging.V(1).Infof("Remove old krew installation under %q", pluginVersionPath)
 			if err = os.RemoveAll(pluginVersionPath); err != nil {
 				return errors.Wrapf(err, "can't remove plugin oldVersion=%q, path=%q", f.Name(), pluginVersionPath)
 			}
 		} else if f.Name() != newVersion {
-			glog.V(1).Infof("Unlink krew installation under %q", pluginVersionPath)
+			logging.V(1).Infof("Unlink krew installation under %q", pluginVersionPath)
 			// TODO(ahmetb,lbb) is this part implemented???
 		}
 	}
@@ -0,0 +1,91 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package installation
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/GoogleContainerTools/krew/pkg/index"
+)
+
+func TestUpgradeStatus(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	plugin, err := pluginFromURL("foo", "https://example.invalid/kubectl-foo", checksum, "foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, _, _, err := UpgradeStatus(p, plugin); err != ErrIsNotInstalled {
+		t.Fatalf("UpgradeStatus() of a missing plugin error = %v, want %v", err, ErrIsNotInstalled)
+	}
+
+	// installFake installs version v1.
+	installFake(t, p, "foo", []byte("foo"))
+	installed, available, upgradable, err := UpgradeStatus(p, plugin)
+	if err != nil || installed != "v1" || available != checksum || !upgradable {
+		t.Fatalf("UpgradeStatus() = %q, %q, %v, %v, want %q, %q, true", installed, available, upgradable, err, "v1", checksum)
+	}
+
+	// Move the installation to the available version.
+	if err := os.Rename(p.PluginVersionInstallPath("foo", "v1"), p.PluginVersionInstallPath("foo", checksum)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createOrUpdateLink(p.BinPath(), p.BinPrefix(), filepath.Join(p.PluginVersionInstallPath("foo", checksum), "foo"), "foo", false); err != nil {
+		t.Fatal(err)
+	}
+	if _, _, upgradable, err := UpgradeStatus(p, plugin); err != nil || upgradable {
+		t.Fatalf("UpgradeStatus() of the available version upgradable = %v, %v, want false", upgradable, err)
+	}
+
+	if err := os.Rename(p.PluginVersionInstallPath("foo", checksum), p.PluginVersionInstallPath("foo", headVersion)); err != nil {
+		t.Fatal(err)
+	}
+	if err := createOrUpdateLink(p.BinPath(), p.BinPrefix(), filepath.Join(p.PluginVersionInstallPath("foo", headVersion), "foo"), "foo", false); err != nil {
+		t.Fatal(err)
+	}
+	installed, available, upgradable, err = UpgradeStatus(p, plugin)
+	if err != nil || installed != headVersion || available != headVersion || upgradable {
+		t.Fatalf("UpgradeStatus() of HEAD = %q, %q, %v, %v, want HEAD, HEAD, false", installed, available, upgradable, err)
+	}
+}
+
+func TestUpgradeWithOptions_newerKrewRequired(t *testing.T) {
+	const checksum = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9"
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	installFake(t, p, "foo", []byte("hello world"))
+	plugin, err := pluginFromURL("foo", "https://example.invalid/kubectl-foo", checksum, "kubectl-foo",
+		[]index.FileOperation{{From: "kubectl-foo", To: "."}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	plugin.Spec.MinKrewVersion = "v9.0.0"
+	opts := Options{KrewVersion: "v0.2.1", Transport: fakeTransport("hello world")}
+
+	installErr := InstallWithOptions(p, plugin, Options{Force: true, KrewVersion: opts.KrewVersion, Transport: opts.Transport})
+	if installErr == nil {
+		t.Fatal("InstallWithOptions() of a plugin for a newer krew expected error")
+	}
+	if err := UpgradeWithOptions(p, plugin, "", opts); err == nil || err.Error() != installErr.Error() {
+		t.Fatalf("UpgradeWithOptions() error = %v, want the install error %v", err, installErr)
+	}
+	if version, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), "foo"); err != nil || !ok || version != "v1" {
+		t.Errorf("findInstalledPluginVersion() = %q, %v, %v, want the installed v1 to be kept", version, ok, err)
+	}
+}
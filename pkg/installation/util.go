@@ -15,28 +15,39 @@
 package installation
 
 import (
+	"encoding/hex"
 	"io/ioutil"
 	"os"
+	"path"
 	"path/filepath"
 	"runtime"
-	"strings"
+	"time"
 
-	"github.com/golang/glog"
 	"github.com/pkg/errors"
 	metav1 "k8s.io/apimachinery/pkg/apis/meta/v1"
 	"k8s.io/apimachinery/pkg/labels"
 
+	"github.com/GoogleContainerTools/krew/pkg/download"
+	"github.com/GoogleContainerTools/krew/pkg/environment"
 	"github.com/GoogleContainerTools/krew/pkg/index"
+	"github.com/GoogleContainerTools/krew/pkg/logging"
 	"github.com/GoogleContainerTools/krew/pkg/pathutil"
 )
 
 // GetMatchingPlatform TODO(lbb)
 func GetMatchingPlatform(i index.Plugin) (index.Platform, bool, error) {
 	os, arch := osArch()
-	glog.V(4).Infof("Using os=%s arch=%s", os, arch)
+	logging.V(4).Infof("Using os=%s arch=%s", os, arch)
 	return matchPlatformToSystemEnvs(i, os, arch)
 }
 
+// GetMatchingPlatformIndex returns the index of the platform of the plugin
+// that matches the current system, e.g. to show which platform is installed.
+func GetMatchingPlatformIndex(i index.Plugin) (int, bool, error) {
+	os, arch := osArch()
+	return matchPlatformIndex(i, os, arch)
+}
+
 // osArch returns the OS/arch combination to be used on the current system. It
 // can be overridden by setting KREW_OS and/or KREW_ARCH environment variables.
 func osArch() (string, string) {
@@ -51,48 +62,113 @@ func osArch() (string, string) {
 	return goos, goarch
 }
 
+// targetOSArch returns the OS/arch of the options, falling back to the ones
+// of the current system.
+func (o Options) targetOSArch() (string, string) {
+	goos, goarch := osArch()
+	if o.OS != "" {
+		goos = o.OS
+	}
+	if o.Arch != "" {
+		goarch = o.Arch
+	}
+	return goos, goarch
+}
+
 func matchPlatformToSystemEnvs(i index.Plugin, os, arch string) (index.Platform, bool, error) {
+	idx, ok, err := matchPlatformIndex(i, os, arch)
+	if err != nil || !ok {
+		return index.Platform{}, false, err
+	}
+	return i.Spec.Platforms[idx], true, nil
+}
+
+func matchPlatformIndex(i index.Plugin, os, arch string) (int, bool, error) {
 	envLabels := labels.Set{
 		"os":   os,
 		"arch": arch,
 	}
-	glog.V(2).Infof("Matching platform for labels(%v)", envLabels)
+	logging.V(2).Infof("Matching platform for labels(%v)", envLabels)
 	for i, platform := range i.Spec.Platforms {
 		sel, err := metav1.LabelSelectorAsSelector(platform.Selector)
 		if err != nil {
-			return index.Platform{}, false, errors.Wrap(err, "failed to compile label selector")
+			return -1, false, errors.Wrap(err, "failed to compile label selector")
 		}
 		if sel.Matches(envLabels) {
-			glog.V(2).Infof("Found matching platform with index (%d)", i)
-			return platform, true, nil
+			logging.V(2).Infof("Found matching platform with index (%d) and selector (%s)", i, metav1.FormatLabelSelector(platform.Selector))
+			return i, true, nil
 		}
 	}
-	return index.Platform{}, false, nil
+	return -1, false, nil
 }
 
-func findInstalledPluginVersion(installPath, binDir, pluginName string) (name string, installed bool, err error) {
+func findInstalledPluginVersion(installPath, binDir, binPrefix, pluginName string) (name string, installed bool, err error) {
 	if !index.IsSafePluginName(pluginName) {
-		return "", false, errors.Errorf("the plugin name %q is not allowed", pluginName)
+		return "", false, errorOfKind(ErrInvalidPluginName, "the plugin name %q is not allowed", pluginName)
 	}
-	glog.V(3).Infof("Searching for installed versions of %s in %q", pluginName, binDir)
-	link, err := os.Readlink(filepath.Join(binDir, pluginNameToBin(pluginName, isWindows())))
+	logging.V(3).Infof("Searching for installed versions of %s in %q", pluginName, binDir)
+	link, ok, err := pluginLinkTarget(binDir, binPrefix, pluginName)
+	if err != nil || !ok {
+		return "", ok, err
+	}
+
+	installPathAbs, err := filepath.Abs(installPath)
+	if err != nil {
+		return "", true, errors.Wrapf(err, "failed to get the absolute path of %q", installPath)
+	}
+	if _, ok := pathutil.IsSubPath(installPathAbs, link); !ok {
+		return "", true, errors.Errorf("plugin bin symlink for %q points outside krew install dir %q (target=%q), possibly modified externally", pluginName, installPath, link)
+	}
+
+	name, err = pluginVersionFromPath(installPathAbs, link)
+	if err != nil {
+		return "", true, errors.Wrap(err, "cloud not parse plugin version")
+	}
+	return name, true, nil
+}
+
+// pluginLinkTarget returns the absolute target of the bin symlink of the
+// plugin, and whether the symlink exists.
+func pluginLinkTarget(binDir, binPrefix, pluginName string) (string, bool, error) {
+	return linkTarget(binDir, pluginNameToBin(binPrefix, pluginName, isWindows()))
+}
+
+// linkTarget returns the absolute target of the symlink name in binDir, and
+// whether the symlink exists.
+func linkTarget(binDir, name string) (string, bool, error) {
+	link, err := os.Readlink(filepath.Join(binDir, name))
 	if os.IsNotExist(err) {
 		return "", false, nil
 	} else if err != nil {
-		return "", false, errors.Wrap(err, "could not read plugin link")
+		return "", false, errors.Wrapf(err, "failed to read the symlink %q", name)
 	}
-
 	if !filepath.IsAbs(link) {
-		if link, err = filepath.Abs(filepath.Join(binDir, link)); err != nil {
-			return "", true, errors.Wrapf(err, "failed to get the absolute path for the link of %q", link)
-		}
+		link = filepath.Join(binDir, link)
 	}
+	abs, err := filepath.Abs(link)
+	if err != nil {
+		return "", true, errors.Wrapf(err, "failed to get the absolute path of %q", link)
+	}
+	return abs, true, nil
+}
 
-	name, err = pluginVersionFromPath(installPath, link)
+// ExecutablePath returns the absolute path of the executable the bin symlink
+// of the installed plugin points to, e.g. to invoke the plugin directly. It
+// returns ErrIsNotInstalled if the plugin is not installed.
+func ExecutablePath(p environment.Paths, name string) (string, error) {
+	if _, ok, err := findInstalledPluginVersion(p.InstallPath(), p.BinPath(), p.BinPrefix(), name); err != nil {
+		return "", err
+	} else if !ok {
+		return "", ErrIsNotInstalled
+	}
+	executable, _, err := pluginLinkTarget(p.BinPath(), p.BinPrefix(), name)
 	if err != nil {
-		return "", true, errors.Wrap(err, "cloud not parse plugin version")
+		return "", err
 	}
-	return name, true, nil
+	if _, err := os.Stat(executable); err != nil {
+		return "", errors.Wrapf(err, "executable of plugin %q not found", name)
+	}
+	return executable, nil
 }
 
 func pluginVersionFromPath(installPath, pluginPath string) (string, error) {
@@ -104,54 +180,218 @@ func pluginVersionFromPath(installPath, pluginPath string) (string, error) {
 	return elems[1], nil
 }
 
-func getPluginVersion(p index.Platform, forceHEAD bool) (version, uri string, err error) {
+// getPluginVersion returns the version to install from the platform with the
+// download URI and the checksum to verify it. The version of a checksummed
+// download is its hex digest, without the hash algorithm.
+func getPluginVersion(p index.Platform, forceHEAD bool) (version, uri, checksum string, err error) {
 	if (forceHEAD && p.Head != "") || (p.Head != "" && p.Sha256 == "" && p.URI == "") {
-		return headVersion, p.Head, nil
+		return headVersion, p.Head, "", nil
 	}
 	if forceHEAD && p.Head == "" {
-		return "", "", errors.New("can't force HEAD, with no HEAD specified")
+		return "", "", "", errorOfKind(ErrNoHEAD, "can't force HEAD, with no HEAD specified")
+	}
+	checksum = p.Sha256
+	if checksum == "" {
+		checksum = p.Integrity
+	}
+	digests := download.IntegrityDigests(checksum)
+	if len(digests) == 0 {
+		return "", "", "", ErrUnverified
+	}
+	// The version of an integrity string is its first digest.
+	_, digest, err := download.ParseChecksum(digests[0])
+	if err != nil {
+		return "", "", "", errors.Wrap(err, "invalid checksum")
+	}
+	return hex.EncodeToString(digest), p.URI, checksum, nil
+}
+
+// resolveChecksum sets the checksum of the platform from its checksums file,
+// if it has one and the download is not HEAD.
+func (o Options) resolveChecksum(p index.Platform, fetcher download.Fetcher) (index.Platform, error) {
+	if p.Checksums == nil || (o.ForceHEAD && p.Head != "") {
+		return p, nil
+	}
+	filename := p.Checksums.Filename
+	if filename == "" {
+		filename = path.Base(p.URI)
+	}
+	checksum, err := download.GetChecksumFromFile(o.rewriteURL(p.Checksums.URI), filename, fetcher)
+	if err != nil {
+		return p, errors.Wrap(err, "failed to get the checksum from the checksums file")
+	}
+	logging.V(3).Infof("Found checksum %s of %q in checksums file", checksum, filename)
+	p.Sha256 = checksum
+	return p, nil
+}
+
+// ResolveDownload returns the version, download URL and checksum that would be
+// installed for the plugin on the given os/arch, without downloading anything
+// but the checksums file of the platform, if it has one.
+func ResolveDownload(plugin index.Plugin, os, arch string, forceHEAD bool) (version, url, checksum string, err error) {
+	return ResolveDownloadWithOptions(plugin, Options{OS: os, Arch: arch, ForceHEAD: forceHEAD})
+}
+
+// ResolveDownloadWithOptions is like ResolveDownload, configured by opts. The
+// URL is rewritten by opts.URLRewriter, if set. Unset opts.OS and opts.Arch
+// fall back to the current system.
+func ResolveDownloadWithOptions(plugin index.Plugin, opts Options) (version, url, checksum string, err error) {
+	goos, goarch := opts.targetOSArch()
+	p, ok, err := matchPlatformToSystemEnvs(plugin, goos, goarch)
+	if err != nil {
+		return "", "", "", wrapf(err, "failed to get matching platforms")
+	}
+	if !ok {
+		return "", "", "", errorOfKind(ErrNoMatchingPlatform, "no matching platform found for os=%s arch=%s", goos, goarch)
+	}
+	fetcher, err := opts.fetcher(p)
+	if err != nil {
+		return "", "", "", err
 	}
-	return strings.ToLower(p.Sha256), p.URI, nil
+	if p, err = opts.resolveChecksum(p, fetcher); err != nil {
+		return "", "", "", err
+	}
+	version, url, checksum, err = getPluginVersion(p, opts.ForceHEAD)
+	if err != nil {
+		return "", "", "", wrapf(err, "failed to get the plugin version")
+	}
+	return version, opts.rewriteURL(url), checksum, nil
 }
 
-func getDownloadTarget(index index.Plugin, forceHEAD bool) (version, uri string, fos []index.FileOperation, bin string, err error) {
-	p, ok, err := GetMatchingPlatform(index)
+// getDownloadTarget returns what to download and install for the platform of
+// the plugin that matches the current system, with the fetcher to download it.
+func (o Options) getDownloadTarget(index index.Plugin) (version, uri, checksum string, platform index.Platform, fetcher download.Fetcher, err error) {
+	goos, goarch := o.targetOSArch()
+	logging.V(4).Infof("Using os=%s arch=%s", goos, goarch)
+	p, ok, err := matchPlatformToSystemEnvs(index, goos, goarch)
 	if err != nil {
-		return "", "", nil, p.Bin, errors.Wrap(err, "failed to get matching platforms")
+		return "", "", "", p, nil, wrapf(err, "failed to get matching platforms")
 	}
 	if !ok {
-		return "", "", nil, p.Bin, errors.New("no matching platform found")
+		return "", "", "", p, nil, errorOfKind(ErrNoMatchingPlatform, "no matching platform found for os=%s arch=%s", goos, goarch)
 	}
-	version, uri, err = getPluginVersion(p, forceHEAD)
+	return o.platformDownloadTarget(p)
+}
+
+// platformDownloadTarget returns what to download and install for the
+// platform, with the fetcher to download it.
+func (o Options) platformDownloadTarget(p index.Platform) (version, uri, checksum string, platform index.Platform, fetcher download.Fetcher, err error) {
+	if o.LocalArchive != "" {
+		if o.SkipLocalVerification && o.RequireChecksums {
+			return "", "", "", p, nil, ErrUnverified
+		}
+		// A local archive is installed e.g. without network access, so the
+		// checksums file of the platform is not fetched.
+		if p.Sha256 == "" && p.Integrity == "" && !(o.ForceHEAD && p.Head != "") {
+			return "", "", "", p, nil, errorOfKind(ErrUnverified, "the platform has no checksum in the manifest to install the local archive %q with", o.LocalArchive)
+		}
+		fetcher = download.NewFileFetcher(o.LocalArchive)
+	} else {
+		if fetcher, err = o.fetcher(p); err != nil {
+			return "", "", "", p, nil, err
+		}
+		if p, err = o.resolveChecksum(p, fetcher); err != nil {
+			return "", "", "", p, nil, err
+		}
+	}
+	version, uri, checksum, err = getPluginVersion(p, o.ForceHEAD)
 	if err != nil {
-		return "", "", nil, p.Bin, errors.Wrap(err, "failed to get the plugin version")
+		return "", "", "", p, nil, wrapf(err, "failed to get the plugin version")
 	}
-	glog.V(4).Infof("Matching plugin version is %s", version)
+	logging.V(4).Infof("Matching plugin version is %s", version)
 
-	return version, uri, p.Files, p.Bin, nil
+	return version, o.rewriteURL(uri), checksum, p, fetcher, nil
 }
 
-// ListInstalledPlugins returns a list of all name:version for all plugins.
-func ListInstalledPlugins(installDir, binDir string) (map[string]string, error) {
-	installed := make(map[string]string)
+// fetcher returns the fetcher to download the platform with.
+func (o Options) fetcher(p index.Platform) (download.Fetcher, error) {
+	timeout, err := o.downloadTimeout(p)
+	if err != nil {
+		return nil, err
+	}
+	transport := o.Transport
+	if transport == nil && o.CABundle != "" {
+		if transport, err = download.NewTransportWithCABundle(o.CABundle); err != nil {
+			return nil, err
+		}
+	}
+	var fetcher download.Fetcher = download.HTTPFetcher{Timeout: timeout, UserAgent: o.UserAgent, Transport: transport}
+	if o.DownloadRateLimit > 0 {
+		fetcher = download.NewRateLimitedFetcher(fetcher, o.DownloadRateLimit)
+	}
+	return fetcher, nil
+}
+
+// downloadTimeout returns the download timeout of the platform, falling back
+// to o.DownloadTimeout if it doesn't specify one.
+func (o Options) downloadTimeout(p index.Platform) (time.Duration, error) {
+	if p.Timeout == "" {
+		return o.DownloadTimeout, nil
+	}
+	timeout, err := time.ParseDuration(p.Timeout)
+	if err != nil {
+		return 0, errors.Wrapf(err, "invalid download timeout %q", p.Timeout)
+	}
+	if timeout <= 0 {
+		return 0, errors.Errorf("download timeout %q has to be positive", p.Timeout)
+	}
+	logging.V(4).Infof("Using download timeout %s of the platform", timeout)
+	return timeout, nil
+}
+
+// ErrStopWalk can be returned by the callback of WalkInstalled to stop walking
+// the installed plugins without failing.
+var ErrStopWalk = errors.New("stop walking installed plugins")
+
+// InstalledPlugin describes the installed version of a plugin.
+type InstalledPlugin struct {
+	Version string
+	IsHEAD  bool
+}
+
+// ListInstalledPlugins returns the installed version of all plugins by name.
+// The binPrefix is the prefix of the plugin executables found in binDir.
+func ListInstalledPlugins(installDir, binDir, binPrefix string) (map[string]InstalledPlugin, error) {
+	installed := make(map[string]InstalledPlugin)
+	err := walkInstalled(installDir, binDir, binPrefix, func(name, version string, headInstalled bool) error {
+		installed[name] = InstalledPlugin{Version: version, IsHEAD: headInstalled}
+		return nil
+	})
+	return installed, err
+}
+
+// WalkInstalled calls fn for each installed plugin in the order of the plugin
+// names. headInstalled is true if the plugin is installed from HEAD. Walking
+// stops at the first error returned by fn, which is returned unless it is
+// ErrStopWalk.
+func WalkInstalled(p environment.Paths, fn func(name, version string, headInstalled bool) error) error {
+	return walkInstalled(p.InstallPath(), p.BinPath(), p.BinPrefix(), fn)
+}
+
+func walkInstalled(installDir, binDir, binPrefix string, fn func(name, version string, headInstalled bool) error) error {
 	plugins, err := ioutil.ReadDir(installDir)
 	if err != nil {
-		return installed, errors.Wrap(err, "failed to read install dir")
+		return errors.Wrap(err, "failed to read install dir")
 	}
-	glog.V(4).Infof("Read installation directory: %s (%d items)", installDir, len(plugins))
+	logging.V(4).Infof("Read installation directory: %s (%d items)", installDir, len(plugins))
 	for _, plugin := range plugins {
 		if !plugin.IsDir() {
-			glog.V(4).Infof("Skip non-directory item: %s", plugin.Name())
+			logging.V(4).Infof("Skip non-directory item: %s", plugin.Name())
 			continue
 		}
-		version, ok, err := findInstalledPluginVersion(installDir, binDir, plugin.Name())
+		version, ok, err := findInstalledPluginVersion(installDir, binDir, binPrefix, plugin.Name())
 		if err != nil {
-			return installed, errors.Wrap(err, "failed to get plugin version")
+			return errors.Wrap(err, "failed to get plugin version")
+		}
+		if !ok {
+			continue
 		}
-		if ok {
-			installed[plugin.Name()] = version
-			glog.V(4).Infof("Found %q, with version %s", plugin.Name(), version)
+		logging.V(4).Infof("Found %q, with version %s", plugin.Name(), version)
+		if err := fn(plugin.Name(), version, version == headVersion); errors.Cause(err) == ErrStopWalk {
+			return nil
+		} else if err != nil {
+			return err
 		}
 	}
-	return installed, nil
+	return nil
 }
@@ -15,11 +15,14 @@
 package installation
 
 import (
+	"fmt"
+	"io/ioutil"
 	"os"
 	"path/filepath"
 	"reflect"
 	"runtime"
 	"testing"
+	"time"
 
 	"github.com/GoogleContainerTools/krew/pkg/index"
 
@@ -134,17 +137,84 @@ func Test_matchPlatformToSystemEnvs(t *testing.T) {
 	}
 }
 
+func Test_matchPlatformToSystemEnvs_matchExpressions(t *testing.T) {
+	platform := func(reqs ...v1.LabelSelectorRequirement) index.Plugin {
+		var p index.Plugin
+		p.Spec.Platforms = []index.Platform{{Selector: &v1.LabelSelector{MatchExpressions: reqs}}}
+		return p
+	}
+	tests := []struct {
+		name      string
+		plugin    index.Plugin
+		os, arch  string
+		wantFound bool
+	}{
+		{"in matches", platform(v1.LabelSelectorRequirement{Key: "os", Operator: v1.LabelSelectorOpIn, Values: []string{"linux", "darwin"}}), "darwin", "amd64", true},
+		{"in does not match", platform(v1.LabelSelectorRequirement{Key: "os", Operator: v1.LabelSelectorOpIn, Values: []string{"linux", "darwin"}}), "windows", "amd64", false},
+		{"not in matches", platform(v1.LabelSelectorRequirement{Key: "arch", Operator: v1.LabelSelectorOpNotIn, Values: []string{"386"}}), "linux", "amd64", true},
+		{"not in does not match", platform(v1.LabelSelectorRequirement{Key: "arch", Operator: v1.LabelSelectorOpNotIn, Values: []string{"386"}}), "linux", "386", false},
+		{"exists", platform(v1.LabelSelectorRequirement{Key: "os", Operator: v1.LabelSelectorOpExists}), "linux", "amd64", true},
+		{"combined with labels", index.Plugin{Spec: index.PluginSpec{Platforms: []index.Platform{{Selector: &v1.LabelSelector{
+			MatchLabels:      map[string]string{"arch": "amd64"},
+			MatchExpressions: []v1.LabelSelectorRequirement{{Key: "os", Operator: v1.LabelSelectorOpIn, Values: []string{"linux", "darwin"}}},
+		}}}}}, "linux", "arm", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, found, err := matchPlatformToSystemEnvs(tt.plugin, tt.os, tt.arch)
+			if err != nil {
+				t.Fatalf("matchPlatformToSystemEnvs() error = %v", err)
+			}
+			if found != tt.wantFound {
+				t.Errorf("matchPlatformToSystemEnvs(os=%s, arch=%s) found = %v, want %v", tt.os, tt.arch, found, tt.wantFound)
+			}
+		})
+	}
+}
+
+func TestGetMatchingPlatformIndex(t *testing.T) {
+	os.Setenv("KREW_OS", "darwin")
+	defer os.Unsetenv("KREW_OS")
+	platform := func(os string) index.Platform {
+		return index.Platform{Selector: &v1.LabelSelector{MatchLabels: map[string]string{"os": os}}}
+	}
+
+	tests := []struct {
+		name      string
+		platforms []index.Platform
+		want      int
+		wantFound bool
+	}{
+		{"second platform", []index.Platform{platform("linux"), platform("darwin")}, 1, true},
+		{"no match", []index.Platform{platform("linux"), platform("windows")}, -1, false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var plugin index.Plugin
+			plugin.Spec.Platforms = tt.platforms
+			got, found, err := GetMatchingPlatformIndex(plugin)
+			if err != nil {
+				t.Fatalf("GetMatchingPlatformIndex() error = %v", err)
+			}
+			if got != tt.want || found != tt.wantFound {
+				t.Errorf("GetMatchingPlatformIndex() = %d, %v; want %d, %v", got, found, tt.want, tt.wantFound)
+			}
+		})
+	}
+}
+
 func Test_getPluginVersion(t *testing.T) {
 	type args struct {
 		p         index.Platform
 		forceHEAD bool
 	}
 	tests := []struct {
-		name        string
-		args        args
-		wantVersion string
-		wantURI     string
-		wantErr     bool
+		name         string
+		args         args
+		wantVersion  string
+		wantURI      string
+		wantChecksum string
+		wantErr      bool
 	}{
 		{
 			name: "Get Single Head",
@@ -168,8 +238,43 @@ func Test_getPluginVersion(t *testing.T) {
 				},
 				forceHEAD: false,
 			},
-			wantVersion: "deadbeef",
-			wantURI:     "https://uri.git",
+			wantVersion:  "deadbeef",
+			wantURI:      "https://uri.git",
+			wantChecksum: "deadbeef",
+		}, {
+			name: "Get URI with checksum algorithm",
+			args: args{
+				p: index.Platform{
+					URI:    "https://uri.git",
+					Sha256: "SHA512:DEADBEEF",
+				},
+				forceHEAD: false,
+			},
+			wantVersion:  "deadbeef",
+			wantURI:      "https://uri.git",
+			wantChecksum: "SHA512:DEADBEEF",
+		}, {
+			name: "Get URI with checksum options",
+			args: args{
+				p: index.Platform{
+					URI:    "https://uri.git",
+					Sha256: "sha256:deadbeef?opts",
+				},
+			},
+			wantVersion:  "deadbeef",
+			wantURI:      "https://uri.git",
+			wantChecksum: "sha256:deadbeef?opts",
+		}, {
+			name: "Get URI with integrity options",
+			args: args{
+				p: index.Platform{
+					URI:       "https://uri.git",
+					Integrity: "sha256-uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=?opts",
+				},
+			},
+			wantVersion:  "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+			wantURI:      "https://uri.git",
+			wantChecksum: "sha256-uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=?opts",
 		}, {
 			name: "Get HEAD force",
 			args: args{
@@ -195,11 +300,31 @@ func Test_getPluginVersion(t *testing.T) {
 			wantErr:     true,
 			wantVersion: "",
 			wantURI:     "",
+		}, {
+			name: "Get URI with integrity",
+			args: args{
+				p: index.Platform{
+					URI:       "https://uri.git",
+					Integrity: "sha384-/b2OdaZ/KfcBpOBAOF4uI5hjA+oQI5IRr5B/y7g1eLPkF8txzmRu/QgZ3YwIjeG9 sha256-uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=",
+				},
+			},
+			wantVersion:  "fdbd8e75a67f29f701a4e040385e2e23986303ea10239211af907fcbb83578b3e417cb71ce646efd0819dd8c088de1bd",
+			wantURI:      "https://uri.git",
+			wantChecksum: "sha384-/b2OdaZ/KfcBpOBAOF4uI5hjA+oQI5IRr5B/y7g1eLPkF8txzmRu/QgZ3YwIjeG9 sha256-uU0nuZNNPgilLlLX2n2r+sSE7+N6U4DukIj3rOLvzek=",
+		}, {
+			name: "URI without checksum",
+			args: args{
+				p: index.Platform{
+					Head: "https://head.git",
+					URI:  "https://uri.git",
+				},
+			},
+			wantErr: true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotVersion, gotURI, err := getPluginVersion(tt.args.p, tt.args.forceHEAD)
+			gotVersion, gotURI, gotChecksum, err := getPluginVersion(tt.args.p, tt.args.forceHEAD)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("getPluginVersion() gotVersion = %v, want %v, got err = %v want err = %v", gotVersion, tt.wantVersion, err, tt.wantErr)
 			}
@@ -209,6 +334,9 @@ func Test_getPluginVersion(t *testing.T) {
 			if gotURI != tt.wantURI {
 				t.Errorf("getPluginVersion() gotURI = %v, want %v", gotURI, tt.wantURI)
 			}
+			if gotChecksum != tt.wantChecksum {
+				t.Errorf("getPluginVersion() gotChecksum = %v, want %v", gotChecksum, tt.wantChecksum)
+			}
 		})
 	}
 }
@@ -292,7 +420,8 @@ func Test_getDownloadTarget(t *testing.T) {
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotVersion, gotURI, gotFos, bin, err := getDownloadTarget(tt.args.index, tt.args.forceHEAD)
+			gotVersion, gotURI, _, platform, _, err := Options{ForceHEAD: tt.args.forceHEAD}.getDownloadTarget(tt.args.index)
+			gotFos, bin := platform.Files, platform.Bin
 			if (err != nil) != tt.wantErr {
 				t.Errorf("getDownloadTarget() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -313,6 +442,53 @@ func Test_getDownloadTarget(t *testing.T) {
 	}
 }
 
+func TestResolveDownload(t *testing.T) {
+	plugin := index.Plugin{
+		Spec: index.PluginSpec{
+			Platforms: []index.Platform{{
+				Head:   "https://head.git",
+				URI:    "https://example.com/linux.tar.gz",
+				Sha256: "DEADBEEF",
+				Selector: &v1.LabelSelector{
+					MatchLabels: map[string]string{"os": "linux"},
+				},
+			}, {
+				URI:    "https://example.com/darwin.tar.gz",
+				Sha256: "sha512:cafe",
+				Selector: &v1.LabelSelector{
+					MatchLabels: map[string]string{"os": "darwin"},
+				},
+			}},
+		},
+	}
+	tests := []struct {
+		name         string
+		os           string
+		forceHEAD    bool
+		wantVersion  string
+		wantURL      string
+		wantChecksum string
+		wantErr      bool
+	}{
+		{"linux", "linux", false, "deadbeef", "https://example.com/linux.tar.gz", "DEADBEEF", false},
+		{"linux HEAD", "linux", true, "HEAD", "https://head.git", "", false},
+		{"darwin", "darwin", false, "cafe", "https://example.com/darwin.tar.gz", "sha512:cafe", false},
+		{"darwin HEAD", "darwin", true, "", "", "", true},
+		{"no matching platform", "windows", false, "", "", "", true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			version, url, checksum, err := ResolveDownload(plugin, tt.os, "amd64", tt.forceHEAD)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ResolveDownload() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if version != tt.wantVersion || url != tt.wantURL || checksum != tt.wantChecksum {
+				t.Errorf("ResolveDownload() = (%q, %q, %q), want (%q, %q, %q)", version, url, checksum, tt.wantVersion, tt.wantURL, tt.wantChecksum)
+			}
+		})
+	}
+}
+
 func Test_findInstalledPluginVersion(t *testing.T) {
 	type args struct {
 		installPath string
@@ -356,11 +532,21 @@ func Test_findInstalledPluginVersion(t *testing.T) {
 			wantName:      "",
 			wantInstalled: false,
 			wantErr:       true,
+		}, {
+			name: "Link outside install path",
+			args: args{
+				installPath: filepath.Join(testdataPath(t), "plugin-foo"),
+				binDir:      filepath.Join(testdataPath(t), "bin"),
+				pluginName:  "foo",
+			},
+			wantName:      "",
+			wantInstalled: true,
+			wantErr:       true,
 		},
 	}
 	for _, tt := range tests {
 		t.Run(tt.name, func(t *testing.T) {
-			gotName, gotInstalled, err := findInstalledPluginVersion(tt.args.installPath, tt.args.binDir, tt.args.pluginName)
+			gotName, gotInstalled, err := findInstalledPluginVersion(tt.args.installPath, tt.args.binDir, "kubectl-", tt.args.pluginName)
 			if (err != nil) != tt.wantErr {
 				t.Errorf("getOtherInstalledVersion() error = %v, wantErr %v", err, tt.wantErr)
 				return
@@ -375,6 +561,86 @@ func Test_findInstalledPluginVersion(t *testing.T) {
 	}
 }
 
+func TestExecutablePath(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+	if _, err := ExecutablePath(p, "foo"); err != ErrIsNotInstalled {
+		t.Fatalf("ExecutablePath() of a missing plugin error = %v, want %v", err, ErrIsNotInstalled)
+	}
+	installFake(t, p, "foo", []byte("foo"))
+	got, err := ExecutablePath(p, "foo")
+	if err != nil {
+		t.Fatalf("ExecutablePath() error = %v", err)
+	}
+	if want := filepath.Join(p.PluginVersionInstallPath("foo", "v1"), "foo"); got != want {
+		t.Errorf("ExecutablePath() = %q, want %q", got, want)
+	}
+	if err := os.Remove(got); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := ExecutablePath(p, "foo"); err == nil {
+		t.Error("ExecutablePath() of a removed executable expected error")
+	}
+}
+
+func TestListInstalledPlugins(t *testing.T) {
+	got, err := ListInstalledPlugins(filepath.Join(testdataPath(t), "index"), filepath.Join(testdataPath(t), "bin"), "kubectl-")
+	if err != nil {
+		t.Fatalf("ListInstalledPlugins() error = %v", err)
+	}
+	expected := map[string]InstalledPlugin{"foo": {Version: "deadbeef", IsHEAD: false}}
+	if !reflect.DeepEqual(got, expected) {
+		t.Fatalf("ListInstalledPlugins() = %+v, want %+v", got, expected)
+	}
+}
+
+func TestWalkInstalled(t *testing.T) {
+	p, cleanup := testPaths(t)
+	defer cleanup()
+
+	installed := map[string]string{"c": "v2", "a": "v1", "b": headVersion}
+	for name, version := range installed {
+		dir := p.PluginVersionInstallPath(name, version)
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+		bin := filepath.Join(dir, "kubectl-"+name)
+		if err := ioutil.WriteFile(bin, nil, 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := createOrUpdateLink(p.BinPath(), p.BinPrefix(), bin, name, false); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if err := os.MkdirAll(p.PluginInstallPath("not-linked"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	var got []string
+	err := WalkInstalled(p, func(name, version string, headInstalled bool) error {
+		got = append(got, fmt.Sprintf("%s:%s:%v", name, version, headInstalled))
+		return nil
+	})
+	if err != nil {
+		t.Fatalf("WalkInstalled() error = %v", err)
+	}
+	if expected := []string{"a:v1:false", "b:HEAD:true", "c:v2:false"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("WalkInstalled() walked %v, want %v", got, expected)
+	}
+
+	got = nil
+	err = WalkInstalled(p, func(name, version string, headInstalled bool) error {
+		got = append(got, name)
+		return ErrStopWalk
+	})
+	if err != nil {
+		t.Fatalf("WalkInstalled() stopped with error = %v", err)
+	}
+	if expected := []string{"a"}; !reflect.DeepEqual(got, expected) {
+		t.Fatalf("WalkInstalled() walked %v after stopping, want %v", got, expected)
+	}
+}
+
 func testdataPath(t *testing.T) string {
 	pwd, err := filepath.Abs(".")
 	if err != nil {
@@ -417,3 +683,83 @@ func Test_pluginVersionFromPath(t *testing.T) {
 		})
 	}
 }
+
+func Test_downloadTimeout(t *testing.T) {
+	opts := Options{DownloadTimeout: time.Minute}
+	tests := []struct {
+		timeout string
+		want    time.Duration
+		wantErr bool
+	}{
+		{"", time.Minute, false},
+		{"10m", 10 * time.Minute, false},
+		{"5s", 5 * time.Second, false},
+		{"ten minutes", 0, true},
+		{"0s", 0, true},
+	}
+	for _, tt := range tests {
+		got, err := opts.downloadTimeout(index.Platform{Timeout: tt.timeout})
+		if (err != nil) != tt.wantErr {
+			t.Errorf("downloadTimeout(%q) error = %v, wantErr %v", tt.timeout, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("downloadTimeout(%q) = %v, want %v", tt.timeout, got, tt.want)
+		}
+	}
+}
+
+func Test_resolveChecksum(t *testing.T) {
+	const checksums = "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9  foo-linux.tar.gz\n" +
+		"a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447  foo.tar.gz\n"
+	tests := []struct {
+		name      string
+		platform  index.Platform
+		forceHEAD bool
+		want      string
+		wantErr   bool
+	}{
+		{
+			name:     "without checksums file",
+			platform: index.Platform{URI: "https://example.com/foo-linux.tar.gz", Sha256: "deadbeef"},
+			want:     "deadbeef",
+		},
+		{
+			name: "filename from uri",
+			platform: index.Platform{URI: "https://example.com/foo-linux.tar.gz",
+				Checksums: &index.ChecksumsFile{URI: "https://example.com/checksums.txt"}},
+			want: "b94d27b9934d3e08a52e52d7da7dabfac484efe37a5380ee9088f7ace2efcde9",
+		},
+		{
+			name: "explicit filename",
+			platform: index.Platform{URI: "https://example.com/download?os=linux",
+				Checksums: &index.ChecksumsFile{URI: "https://example.com/checksums.txt", Filename: "foo.tar.gz"}},
+			want: "a948904f2f0f479b8f8197694b30184b0d2ed1c1cd2a1ec0fb85d299a192a447",
+		},
+		{
+			name: "not in checksums file",
+			platform: index.Platform{URI: "https://example.com/foo-darwin.tar.gz",
+				Checksums: &index.ChecksumsFile{URI: "https://example.com/checksums.txt"}},
+			wantErr: true,
+		},
+		{
+			name: "HEAD is not verified",
+			platform: index.Platform{Head: "https://example.com/head.tar.gz", URI: "https://example.com/foo-darwin.tar.gz",
+				Checksums: &index.ChecksumsFile{URI: "https://example.com/checksums.txt"}},
+			forceHEAD: true,
+			want:      "",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			fetcher := &sequenceFetcher{contents: []string{checksums}}
+			got, err := Options{ForceHEAD: tt.forceHEAD}.resolveChecksum(tt.platform, fetcher)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("resolveChecksum() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if err == nil && got.Sha256 != tt.want {
+				t.Errorf("resolveChecksum() checksum = %q, want %q", got.Sha256, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,77 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+// Package logging routes the log messages of the download and installation
+// packages. Messages are logged with glog unless another Logger is set, e.g.
+// by a tool embedding these packages.
+package logging
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/golang/glog"
+)
+
+// Logger receives log messages. The level of Infof is the verbosity of the
+// message like the -v flag of glog, higher levels are more verbose.
+type Logger interface {
+	Infof(level int, format string, args ...interface{})
+	Warningf(format string, args ...interface{})
+}
+
+var logger Logger = glogLogger{}
+
+// SetLogger routes all log messages to l. A nil Logger restores glog.
+func SetLogger(l Logger) {
+	if l == nil {
+		l = glogLogger{}
+	}
+	logger = l
+}
+
+// Verbose logs informational messages at its verbosity level.
+type Verbose int
+
+// V returns a Verbose for logging at the level, like glog.V.
+func V(level int) Verbose { return Verbose(level) }
+
+// Infof logs a formatted message at the verbosity level of v.
+func (v Verbose) Infof(format string, args ...interface{}) {
+	logger.Infof(int(v), format, args...)
+}
+
+// Infoln logs the operands at the verbosity level of v.
+func (v Verbose) Infoln(args ...interface{}) {
+	logger.Infof(int(v), "%s", strings.TrimSuffix(fmt.Sprintln(args...), "\n"))
+}
+
+// Warningf logs a formatted warning.
+func Warningf(format string, args ...interface{}) {
+	logger.Warningf(format, args...)
+}
+
+// glogLogger logs with glog, reporting the file and line of the caller of V or
+// Warningf.
+type glogLogger struct{}
+
+func (glogLogger) Infof(level int, format string, args ...interface{}) {
+	if glog.V(glog.Level(level)) {
+		glog.InfoDepth(2, fmt.Sprintf(format, args...))
+	}
+}
+
+func (glogLogger) Warningf(format string, args ...interface{}) {
+	glog.WarningDepth(2, fmt.Sprintf(format, args...))
+}
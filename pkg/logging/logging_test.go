@@ -0,0 +1,53 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package logging
+
+import (
+	"fmt"
+	"reflect"
+	"testing"
+)
+
+type recordingLogger struct {
+	messages []string
+}
+
+func (l *recordingLogger) Infof(level int, format string, args ...interface{}) {
+	l.messages = append(l.messages, fmt.Sprintf("I%d %s", level, fmt.Sprintf(format, args...)))
+}
+
+func (l *recordingLogger) Warningf(format string, args ...interface{}) {
+	l.messages = append(l.messages, "W "+fmt.Sprintf(format, args...))
+}
+
+func TestSetLogger(t *testing.T) {
+	l := &recordingLogger{}
+	SetLogger(l)
+	defer SetLogger(nil)
+
+	V(2).Infof("installing %s", "foo")
+	V(4).Infoln("done", 1)
+	Warningf("retrying %d", 3)
+
+	want := []string{"I2 installing foo", "I4 done 1", "W retrying 3"}
+	if !reflect.DeepEqual(l.messages, want) {
+		t.Fatalf("logged %q, want %q", l.messages, want)
+	}
+
+	SetLogger(nil)
+	if _, ok := logger.(glogLogger); !ok {
+		t.Fatalf("SetLogger(nil) set %T, want glog", logger)
+	}
+}
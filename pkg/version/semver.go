@@ -0,0 +1,68 @@
+// Copyright © 2018 Google Inc.
+//
+// Licensed under the Apache License, Version 2.0 (the "License");
+// you may not use this file except in compliance with the License.
+// You may obtain a copy of the License at
+//
+//      http://www.apache.org/licenses/LICENSE-2.0
+//
+// Unless required by applicable law or agreed to in writing, software
+// distributed under the License is distributed on an "AS IS" BASIS,
+// WITHOUT WARRANTIES OR CONDITIONS OF ANY KIND, either express or implied.
+// See the License for the specific language governing permissions and
+// limitations under the License.
+
+package version
+
+import (
+	"regexp"
+	"strconv"
+
+	"github.com/pkg/errors"
+)
+
+var (
+	// releaseRegexp matches a release version like "v0.2.1".
+	releaseRegexp = regexp.MustCompile(`^v(\d+)\.(\d+)\.(\d+)$`)
+	// describeSuffixRegexp matches what git describe appends to the release
+	// tag for later or modified commits, e.g. "-3-gabcdef-dirty".
+	describeSuffixRegexp = regexp.MustCompile(`(-\d+-g[0-9a-f]+)?(-dirty)?$`)
+)
+
+// ParseRelease parses a release version like "v0.2.1" into its major, minor
+// and patch numbers.
+func ParseRelease(v string) ([3]int, error) {
+	var parsed [3]int
+	m := releaseRegexp.FindStringSubmatch(v)
+	if m == nil {
+		return parsed, errors.Errorf("version %q is not of the form vMAJOR.MINOR.PATCH", v)
+	}
+	for i := range parsed {
+		n, err := strconv.Atoi(m[i+1])
+		if err != nil {
+			return parsed, errors.Wrapf(err, "invalid version %q", v)
+		}
+		parsed[i] = n
+	}
+	return parsed, nil
+}
+
+// AtLeast reports whether the running version is the release min or later.
+// The running version is a release or the git describe output of a build, as
+// stamped into GitTag, e.g. "v0.2.1-3-gabcdef" for a commit after v0.2.1.
+func AtLeast(running, min string) (bool, error) {
+	pv, err := ParseRelease(describeSuffixRegexp.ReplaceAllString(running, ""))
+	if err != nil {
+		return false, err
+	}
+	pm, err := ParseRelease(min)
+	if err != nil {
+		return false, err
+	}
+	for i := range pv {
+		if pv[i] != pm[i] {
+			return pv[i] > pm[i], nil
+		}
+	}
+	return true, nil
+}
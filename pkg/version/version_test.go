@@ -31,3 +31,33 @@ func TestGitTag(t *testing.T) {
 		t.Errorf("empty gitTag, expected=\"abcdef\" got=%q", v)
 	}
 }
+
+func TestAtLeast(t *testing.T) {
+	tests := []struct {
+		v, min  string
+		want    bool
+		wantErr bool
+	}{
+		{"v0.2.1", "v0.2.1", true, false},
+		{"v0.2.1", "v0.10.0", false, false},
+		{"v1.0.0", "v0.10.0", true, false},
+		{"v0.2.1-3-gabcdef", "v0.2.1", true, false},
+		{"v0.2.0-3-gabcdef-dirty", "v0.2.1", false, false},
+		{"0.2.1", "v0.2.1", false, true},
+		{"v0.2.1-rc.1", "v0.2.1", false, true},
+		{"v0.2", "v0.2.1", false, true},
+		{"v0.2.1", "unknown", false, true},
+		{"v0.2.1-dirty", "v0.2.1", true, false},
+		{"v0.2.1", "v0.2.1-3-gabcdef", false, true},
+	}
+	for _, tt := range tests {
+		got, err := AtLeast(tt.v, tt.min)
+		if (err != nil) != tt.wantErr {
+			t.Errorf("AtLeast(%q, %q) error = %v, wantErr %v", tt.v, tt.min, err, tt.wantErr)
+			continue
+		}
+		if got != tt.want {
+			t.Errorf("AtLeast(%q, %q) = %v, want %v", tt.v, tt.min, got, tt.want)
+		}
+	}
+}